@@ -1,3 +1,5 @@
 module github.com/kirill-scherba/sqlh
 
 go 1.23.4
+
+require github.com/mattn/go-sqlite3 v1.14.52
@@ -0,0 +1,369 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// SQL dialects.
+
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Dialect defines SQL database dialect specific statements parts.
+//
+// The built-in SQLite, MySQL and Postgres dialects are preconfigured Dialect
+// values. Users may define their own dialect for other databases and set it
+// with SetDialect function. The nil functions use the default behavior
+// described in the fields comments.
+type Dialect struct {
+
+	// Dialect name
+	Name string
+
+	// Placeholder returns the n-th (starting from 1) statement placeholder.
+	// Default is "?".
+	Placeholder func(n int) string
+
+	// QuoteIdent returns quoted table or column name. Default is the name as
+	// is.
+	QuoteIdent func(name string) string
+
+	// SupportsReturning is true if the database supports RETURNING clause in
+	// INSERT statement.
+	SupportsReturning bool
+
+	// RowLocking is true if the database supports SELECT ... FOR UPDATE row
+	// locking clauses.
+	RowLocking bool
+
+	// LimitClause returns the LIMIT and OFFSET clause with leading space for
+	// the given offset and limit. The limit is greater than zero or zero for
+	// all rows, the offset is greater than or equal to zero. Default is
+	// " LIMIT limit OFFSET offset" without zero offset, or " OFFSET offset"
+	// without limit.
+	LimitClause func(offset, limit int) string
+
+	// DistinctOn is true if the database supports SELECT DISTINCT ON (...)
+	// clause.
+	DistinctOn bool
+
+	// WindowFunctions is true if the database supports window functions, f.e.
+	// "count(*) OVER ()": SQLite 3.25+, MySQL 8+ and Postgres.
+	WindowFunctions bool
+
+	// UpsertClause returns the clause added to the INSERT statement to update
+	// the update columns if the row with the same conflict columns already
+	// exists. It is required by the Upsert function.
+	UpsertClause func(conflict, update []string) string
+
+	// TableColumns returns the statement which selects names and types of the
+	// existing table columns. It is required by the TableColumns function.
+	TableColumns func(table string) string
+
+	// InsertIgnore returns the insert statement which skips the conflicting
+	// rows made from the given "INSERT INTO ... VALUES(...)" statement. It is
+	// required by the InsertOrIgnore function.
+	InsertIgnore func(insert string) string
+
+	// AutoIncrement returns the autoincrement column type and key for the
+	// given column type and db_key tag value without autoincrement keywords.
+	// Default adds "autoincrement" to the key.
+	AutoIncrement func(columnType, key string) (string, string)
+
+	// CountEstimate returns the statement which selects the approximate
+	// number of the table rows from the database statistics. It is used by
+	// the CountEstimate function, the exact count is used if it is nil.
+	CountEstimate func(table string) string
+}
+
+// Built-in SQL database dialects.
+var (
+	SQLite = Dialect{
+		Name:            "sqlite",
+		WindowFunctions: true,
+		UpsertClause:    onConflictUpsert,
+		LimitClause: func(offset, limit int) string {
+			// SQLite requires LIMIT before OFFSET, -1 means no limit
+			if limit <= 0 {
+				return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+			}
+			return standardLimit(offset, limit)
+		},
+		InsertIgnore: func(insert string) string {
+			return strings.Replace(insert, "INSERT", "INSERT OR IGNORE", 1)
+		},
+		TableColumns: func(table string) string {
+			return fmt.Sprintf(
+				"SELECT name, type FROM pragma_table_info('%s');", table,
+			)
+		},
+	}
+
+	MySQL = Dialect{
+		Name:            "mysql",
+		RowLocking:      true,
+		WindowFunctions: true,
+		AutoIncrement: func(columnType, key string) (string, string) {
+			return columnType, strings.TrimLeft(key+" auto_increment", " ")
+		},
+		InsertIgnore: func(insert string) string {
+			return strings.Replace(insert, "INSERT", "INSERT IGNORE", 1)
+		},
+		LimitClause: func(offset, limit int) string {
+			// MySQL requires LIMIT before offset, the maximum unsigned bigint
+			// means no limit
+			switch {
+			case limit <= 0:
+				return fmt.Sprintf(" LIMIT %d, 18446744073709551615", offset)
+			case offset == 0:
+				return fmt.Sprintf(" LIMIT %d", limit)
+			}
+			return fmt.Sprintf(" LIMIT %d, %d", offset, limit)
+		},
+		UpsertClause: func(conflict, update []string) string {
+			var sets []string
+			for _, column := range update {
+				sets = append(sets, fmt.Sprintf("%s=VALUES(%s)", column, column))
+			}
+			return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+		},
+		TableColumns: func(table string) string {
+			return fmt.Sprintf("SELECT column_name, data_type "+
+				"FROM information_schema.columns "+
+				"WHERE table_schema = database() AND table_name = '%s';",
+				table)
+		},
+		CountEstimate: func(table string) string {
+			// The same rows number as in SHOW TABLE STATUS
+			return fmt.Sprintf("SELECT table_rows "+
+				"FROM information_schema.tables "+
+				"WHERE table_schema = database() AND table_name = '%s';",
+				table)
+		},
+	}
+
+	Postgres = Dialect{
+		Name: "postgres",
+		Placeholder: func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		},
+		SupportsReturning: true,
+		RowLocking:        true,
+		DistinctOn:        true,
+		WindowFunctions:   true,
+		UpsertClause:      onConflictUpsert,
+		InsertIgnore: func(insert string) string {
+			return insert + " ON CONFLICT DO NOTHING"
+		},
+		AutoIncrement: func(columnType, key string) (string, string) {
+			if strings.EqualFold(columnType, "bigint") {
+				return "bigserial", key
+			}
+			return "serial", key
+		},
+		TableColumns: func(table string) string {
+			return fmt.Sprintf("SELECT column_name, data_type "+
+				"FROM information_schema.columns "+
+				"WHERE table_schema = current_schema() AND table_name = '%s';",
+				table)
+		},
+		CountEstimate: func(table string) string {
+			// The planner rows estimate, -1 if the table was never analyzed
+			return fmt.Sprintf("SELECT reltuples::bigint FROM pg_class "+
+				"WHERE oid = to_regclass('%s');", table)
+		},
+	}
+)
+
+// dialect is current SQL database dialect.
+var dialect = SQLite
+
+// SetDialect sets SQL database dialect used to generate dialect specific
+// statements. The default dialect is SQLite.
+func SetDialect(d Dialect) {
+	dialect = d
+}
+
+// GetDialect returns current SQL database dialect.
+func GetDialect() Dialect {
+	return dialect
+}
+
+// driverDialects are the built-in dialects by database/sql driver names.
+var driverDialects = map[string]*Dialect{
+	"sqlite":   &SQLite,
+	"sqlite3":  &SQLite,
+	"mysql":    &MySQL,
+	"postgres": &Postgres,
+	"pgx":      &Postgres,
+}
+
+// DriverDialect returns the built-in dialect for the given database/sql driver
+// name: "sqlite" and "sqlite3" for SQLite, "mysql" for MySQL, "postgres" and
+// "pgx" for Postgres. It returns false if the driver is unknown.
+func DriverDialect(driverName string) (d Dialect, ok bool) {
+	p, ok := driverDialects[strings.ToLower(driverName)]
+	if ok {
+		d = *p
+	}
+	return
+}
+
+// String returns dialect name.
+func (d Dialect) String() string {
+	return d.Name
+}
+
+// Rebind replaces "?" placeholders in the given statement with current dialect
+// placeholders. The "?" inside quoted strings and identifiers are not
+// replaced.
+func Rebind(stmt string) string {
+	if dialect.Placeholder == nil {
+		return stmt
+	}
+
+	var b strings.Builder
+	var quote rune
+	var n int
+	for _, r := range stmt {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString(dialect.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// quoteIdent returns the table or column name quoted with current dialect.
+func quoteIdent(name string) string {
+	if dialect.QuoteIdent == nil {
+		return name
+	}
+	return dialect.QuoteIdent(name)
+}
+
+// quoteIdents returns the table or column names quoted with current dialect.
+func quoteIdents(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return quoted
+}
+
+// limitClause returns the LIMIT and OFFSET clause of current dialect. It
+// returns empty string if both offset and limit are not set.
+func limitClause(offset, limit int) string {
+	switch {
+	case limit <= 0 && offset <= 0:
+		return ""
+	case dialect.LimitClause != nil:
+		return dialect.LimitClause(max(offset, 0), max(limit, 0))
+	}
+	return standardLimit(max(offset, 0), max(limit, 0))
+}
+
+// standardLimit returns the standard SQL LIMIT and OFFSET clause used by
+// Postgres and by default.
+func standardLimit(offset, limit int) string {
+	switch {
+	case limit <= 0:
+		return fmt.Sprintf(" OFFSET %d", offset)
+	case offset == 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+}
+
+// onConflictUpsert returns the SQLite and Postgres upsert clause.
+func onConflictUpsert(conflict, update []string) string {
+	var sets []string
+	for _, column := range update {
+		sets = append(sets, fmt.Sprintf("%s=excluded.%s", column, column))
+	}
+	return fmt.Sprintf(" ON CONFLICT(%s) DO UPDATE SET %s",
+		strings.Join(conflict, ","), strings.Join(sets, ","))
+}
+
+// primaryKeyRe matches the db_key tag value with the primary key.
+var primaryKeyRe = regexp.MustCompile(`(?i)\bprimary\s+key\b`)
+
+// autoIncrementRe matches the autoincrement keywords of the db_key tag value.
+var autoIncrementRe = regexp.MustCompile(`(?i)\bauto_?increment\b`)
+
+// autoIncrementColumn returns the autoincrement column type and key of the
+// field for current dialect. The serial column types and autoincrement
+// keywords of the db_type and db_key tags are translated to the current dialect
+// ones, so the same struct creates the autoincrement column in any dialect. It
+// returns an error if the SQLite column is not the primary key, other dialects
+// allow the autoincrement on other keys, f.e. MySQL "auto_increment unique".
+func autoIncrementColumn(field reflect.StructField, columnType, key string) (
+	string, string, error) {
+
+	// Default is the SQLite autoincrement column, it should be the primary key
+	if dialect.AutoIncrement == nil {
+		if !primaryKeyRe.MatchString(key) {
+			return "", "", fmt.Errorf("autoincrement field %s should be the "+
+				"primary key", field.Name)
+		}
+		columnType, key = sqliteAutoIncrement(columnType, key)
+		return columnType, key, nil
+	}
+
+	// Map serial types to the integer types
+	switch strings.ToLower(columnType) {
+	case "serial":
+		columnType = "integer"
+	case "bigserial":
+		columnType = "bigint"
+	}
+
+	// Remove autoincrement keywords from the key
+	key = strings.Join(strings.Fields(autoIncrementRe.ReplaceAllString(key, "")),
+		" ")
+
+	columnType, key = dialect.AutoIncrement(columnType, key)
+	return columnType, key, nil
+}
+
+// sqliteAutoIncrement returns the SQLite autoincrement column type and key.
+//
+// SQLite allows AUTOINCREMENT on the INTEGER PRIMARY KEY column only, right
+// after the PRIMARY KEY keywords, so the serial types are mapped to integer and
+// the autoincrement keyword is placed right after the "primary key [asc|desc]"
+// keywords, f.e. "primary key autoincrement not null" is kept as is.
+func sqliteAutoIncrement(columnType, key string) (string, string) {
+
+	// Map serial types to the integer type
+	switch strings.ToLower(columnType) {
+	case "serial", "bigserial":
+		columnType = "integer"
+	}
+
+	// Remove autoincrement keywords from the key
+	key = strings.Join(strings.Fields(autoIncrementRe.ReplaceAllString(key, "")),
+		" ")
+
+	// Add autoincrement keyword after the primary key
+	loc := sqlitePrimaryKeyRe.FindStringIndex(key)
+	return columnType, key[:loc[1]] + " autoincrement" + key[loc[1]:]
+}
+
+// sqlitePrimaryKeyRe matches the SQLite primary key keywords with optional
+// sort order.
+var sqlitePrimaryKeyRe = regexp.MustCompile(
+	`(?i)\bprimary\s+key(\s+(asc|desc)\b)?`)
@@ -0,0 +1,465 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"testing"
+)
+
+// namedDialect is the custom dialect with ":pN" placeholders and double
+// quoted identifiers.
+var namedDialect = Dialect{
+	Name: "named",
+	Placeholder: func(n int) string {
+		return fmt.Sprintf(":p%d", n)
+	},
+	QuoteIdent: func(name string) string {
+		return `"` + name + `"`
+	},
+}
+
+func TestDialect(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	row := testUser{1, "alice", "alice@example.com", 30}
+	tests := []struct {
+		name    string
+		dialect Dialect
+		stmt    func() (string, error)
+		want    string
+	}{
+		{"sqlite insert", SQLite, func() (string, error) { return Insert(row) },
+			"INSERT INTO testuser(id,name,email,age) VALUES(?,?,?,?);"},
+		{"postgres insert", Postgres, func() (string, error) {
+			return Insert(row)
+		}, "INSERT INTO testuser(id,name,email,age) VALUES($1,$2,$3,$4);"},
+		{"custom insert", namedDialect, func() (string, error) {
+			return Insert(row)
+		}, `INSERT INTO "testuser"("id","name","email","age") ` +
+			`VALUES(:p1,:p2,:p3,:p4);`},
+		{"custom update", namedDialect, func() (string, error) {
+			return Update[testUser]("id=")
+		}, `UPDATE "testuser" SET "id"=:p1,"name"=:p2,"email"=:p3,"age"=:p4 ` +
+			`WHERE id = :p5;`},
+		{"custom delete", namedDialect, func() (string, error) {
+			return Delete[testUser]("id=", "name=")
+		}, `DELETE from "testuser" where id = :p1 AND name = :p2;`},
+		{"custom table", namedDialect, Table[testUser],
+			`CREATE TABLE IF NOT EXISTS "testuser" ("id" integer primary key, ` +
+				`"name" text, "email" text, "age" integer);`},
+		{"sqlite limit", SQLite, func() (string, error) {
+			return Select[testUser](&SelectAttr{
+				Paginator: &Paginator{Offset: 5, Limit: 10},
+			})
+		}, "SELECT * from testuser LIMIT 10 OFFSET 5;"},
+		{"mysql limit", MySQL, func() (string, error) {
+			return Select[testUser](&SelectAttr{
+				Paginator: &Paginator{Offset: 5, Limit: 10},
+			})
+		}, "SELECT * from testuser LIMIT 5, 10;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := tt.stmt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectLock(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		attr    SelectAttr
+		want    string
+	}{
+		{"postgres for update", Postgres, SelectAttr{
+			Wheres: []string{"id = $1"}, Lock: "FOR UPDATE",
+		}, "SELECT * from testuser where id = $1 FOR UPDATE;"},
+		{"mysql for share after limit", MySQL, SelectAttr{
+			Paginator: &Paginator{Limit: 1}, Lock: "FOR SHARE",
+		}, "SELECT * from testuser LIMIT 1 FOR SHARE;"},
+		{"postgres skip locked", Postgres, SelectAttr{
+			OrderBy: "id", Lock: "FOR UPDATE SKIP LOCKED",
+		}, "SELECT * from testuser ORDER BY id FOR UPDATE SKIP LOCKED;"},
+		{"sqlite lock omitted", SQLite, SelectAttr{
+			Wheres: []string{"id = ?"}, Lock: "FOR UPDATE",
+		}, "SELECT * from testuser where id = ?;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := Select[testUser](&tt.attr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testSerial is the tests struct with the serial type primary key.
+type testSerial struct {
+	ID   int32  `db:"id" db_type:"serial" db_key:"primary key"`
+	Name string `db:"name"`
+}
+
+// testBigSerial is the tests struct with the bigserial type primary key.
+type testBigSerial struct {
+	ID int64 `db:"id" db_type:"bigserial" db_key:"primary key"`
+}
+
+// testKeyOrder is the tests struct with the autoincrement keyword inside the
+// column key.
+type testKeyOrder struct {
+	ID int64 `db:"id" db_key:"not null primary key desc autoincrement unique"`
+}
+
+// testNoPrimary is the tests struct with the autoincrement field which is
+// not the primary key.
+type testNoPrimary struct {
+	ID int64 `db:"id" db_key:"autoincrement"`
+}
+
+// testUniqueAuto is the tests struct with the unique autoincrement field.
+type testUniqueAuto struct {
+	ID int64 `db:"id" db_key:"unique autoincrement"`
+}
+
+func TestAutoIncrement(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		table   func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"sqlite autoincrement", SQLite, Table[testItem],
+			"CREATE TABLE IF NOT EXISTS testitem (id integer primary key " +
+				"autoincrement, name text);", false},
+		{"sqlite serial", SQLite, Table[testSerial],
+			"CREATE TABLE IF NOT EXISTS testserial (id integer primary key " +
+				"autoincrement, name text);", false},
+		{"sqlite bigserial", SQLite, Table[testBigSerial],
+			"CREATE TABLE IF NOT EXISTS testbigserial (id integer primary " +
+				"key autoincrement);", false},
+		{"sqlite keyword after primary key", SQLite, Table[testKeyOrder],
+			"CREATE TABLE IF NOT EXISTS testkeyorder (id integer not null " +
+				"primary key desc autoincrement unique);", false},
+		{"mysql autoincrement", MySQL, Table[testItem],
+			"CREATE TABLE IF NOT EXISTS testitem (id integer primary key " +
+				"auto_increment, name text);", false},
+		{"mysql serial", MySQL, Table[testSerial],
+			"CREATE TABLE IF NOT EXISTS testserial (id integer primary key " +
+				"auto_increment, name text);", false},
+		{"postgres autoincrement", Postgres, Table[testItem],
+			"CREATE TABLE IF NOT EXISTS testitem (id serial primary key, " +
+				"name text);", false},
+		{"postgres bigserial", Postgres, Table[testBigSerial],
+			"CREATE TABLE IF NOT EXISTS testbigserial (id bigserial primary " +
+				"key);", false},
+		{"not primary key", SQLite, Table[testNoPrimary], "", true},
+		{"sqlite unique", SQLite, Table[testUniqueAuto], "", true},
+		{"mysql unique", MySQL, Table[testUniqueAuto],
+			"CREATE TABLE IF NOT EXISTS testuniqueauto (id integer unique " +
+				"auto_increment);", false},
+		{"postgres not primary key", Postgres, Table[testNoPrimary],
+			"CREATE TABLE IF NOT EXISTS testnoprimary (id serial);", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := tt.table()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The serial field is skipped on insert
+	inserts := map[string]string{
+		"sqlite":   "INSERT INTO testserial(name) VALUES(?);",
+		"postgres": "INSERT INTO testserial(name) VALUES($1);",
+	}
+	for _, d := range []Dialect{SQLite, Postgres} {
+		SetDialect(d)
+		got, err := Insert(testSerial{Name: "name"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != inserts[d.Name] {
+			t.Errorf("%s: got %q, want %q", d.Name, got, inserts[d.Name])
+		}
+	}
+}
+
+func TestInsertOrIgnore(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		want    string
+		wantErr bool
+	}{
+		{"sqlite", SQLite, "INSERT OR IGNORE INTO testuser(id,name,email," +
+			"age) VALUES(?,?,?,?);", false},
+		{"mysql", MySQL, "INSERT IGNORE INTO testuser(id,name,email,age) " +
+			"VALUES(?,?,?,?);", false},
+		{"postgres", Postgres, "INSERT INTO testuser(id,name,email,age) " +
+			"VALUES($1,$2,$3,$4) ON CONFLICT DO NOTHING;", false},
+		{"not supported", namedDialect, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := InsertOrIgnore(testUser{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistinctOn(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		attr    SelectAttr
+		want    string
+		wantErr bool
+	}{
+		{"postgres single column", Postgres, SelectAttr{
+			DistinctOn: []string{"name"}, OrderBy: "name, age DESC",
+		}, "SELECT DISTINCT ON (name) * from testuser ORDER BY name, " +
+			"age DESC;", false},
+		{"postgres two columns", Postgres, SelectAttr{
+			DistinctOn: []string{"name", "email"},
+			OrderBy:    "email, name, id DESC",
+		}, "SELECT DISTINCT ON (name, email) * from testuser ORDER BY " +
+			"email, name, id DESC;", false},
+		{"postgres alias", Postgres, SelectAttr{
+			DistinctOn: []string{"name"}, OrderBy: "u.name", Alias: "u",
+		}, "SELECT DISTINCT ON (u.name) u.* from testuser u ORDER BY u.name;",
+			false},
+		{"postgres no order by", Postgres, SelectAttr{
+			DistinctOn: []string{"name"},
+		}, "SELECT DISTINCT ON (name) * from testuser;", false},
+		{"order by other column first", Postgres, SelectAttr{
+			DistinctOn: []string{"name"}, OrderBy: "age, name",
+		}, "", true},
+		{"unknown column", Postgres, SelectAttr{
+			DistinctOn: []string{"missing"},
+		}, "", true},
+		{"sqlite unsupported", SQLite, SelectAttr{
+			DistinctOn: []string{"name"}, OrderBy: "name",
+		}, "", true},
+		{"mysql unsupported", MySQL, SelectAttr{
+			DistinctOn: []string{"name"}, OrderBy: "name",
+		}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			got, err := Select[testUser](&tt.attr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitClause(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name          string
+		dialect       Dialect
+		offset, limit int
+		want          string
+	}{
+		{"sqlite limit and offset", SQLite, 5, 10, " LIMIT 10 OFFSET 5"},
+		{"sqlite limit only", SQLite, 0, 10, " LIMIT 10"},
+		{"sqlite offset only", SQLite, 5, 0, " LIMIT -1 OFFSET 5"},
+		{"sqlite none", SQLite, 0, 0, ""},
+		{"mysql limit and offset", MySQL, 5, 10, " LIMIT 5, 10"},
+		{"mysql limit only", MySQL, 0, 10, " LIMIT 10"},
+		{"mysql offset only", MySQL, 5, 0,
+			" LIMIT 5, 18446744073709551615"},
+		{"mysql none", MySQL, 0, 0, ""},
+		{"postgres limit and offset", Postgres, 5, 10, " LIMIT 10 OFFSET 5"},
+		{"postgres limit only", Postgres, 0, 10, " LIMIT 10"},
+		{"postgres offset only", Postgres, 5, 0, " OFFSET 5"},
+		{"postgres none", Postgres, 0, 0, ""},
+		{"custom dialect standard clause", namedDialect, 5, 10,
+			" LIMIT 10 OFFSET 5"},
+		{"negative values ignored", Postgres, -5, -10, ""},
+		{"negative offset ignored", MySQL, -5, 10, " LIMIT 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			if got := limitClause(tt.offset, tt.limit); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			// The select statement ends with the clause
+			stmt, err := Select[testUser](&SelectAttr{
+				Paginator: &Paginator{Offset: tt.offset, Limit: tt.limit},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			table := "testuser"
+			if tt.dialect.QuoteIdent != nil {
+				table = tt.dialect.QuoteIdent(table)
+			}
+			if want := "SELECT * from " + table + tt.want + ";"; stmt != want {
+				t.Errorf("got statement %q, want %q", stmt, want)
+			}
+		})
+	}
+}
+
+func TestDriverDialect(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+		wantOk bool
+	}{
+		{"sqlite", "sqlite", true},
+		{"sqlite3", "sqlite", true},
+		{"mysql", "mysql", true},
+		{"postgres", "postgres", true},
+		{"pgx", "postgres", true},
+		{"Postgres", "postgres", true},
+		{"oracle", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			d, ok := DriverDialect(tt.driver)
+			if ok != tt.wantOk || d.Name != tt.want {
+				t.Errorf("got %q %v, want %q %v", d.Name, ok, tt.want,
+					tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCountEstimate(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		want    string
+		wantOk  bool
+	}{
+		{"sqlite exact count", SQLite, "", false},
+		{"custom exact count", namedDialect, "", false},
+		{"mysql table status", MySQL, "SELECT table_rows " +
+			"FROM information_schema.tables " +
+			"WHERE table_schema = database() AND table_name = 'testuser';",
+			true},
+		{"postgres planner estimate", Postgres,
+			"SELECT reltuples::bigint FROM pg_class " +
+				"WHERE oid = to_regclass('testuser');", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			got, ok, err := CountEstimate[testUser]()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	// Not struct type
+	if _, _, err := CountEstimate[int](); err == nil {
+		t.Error("got nil error for not struct type")
+	}
+}
+
+func TestTotalColumn(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	// noWindow is the dialect without window functions
+	noWindow := SQLite
+	noWindow.WindowFunctions = false
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		attr    SelectAttr
+		want    string
+		wantErr bool
+	}{
+		{"sqlite", SQLite, SelectAttr{TotalColumn: "__total",
+			OrderBy: "id", Paginator: &Paginator{Limit: 2}},
+			"SELECT *, count(*) OVER () AS __total from testuser " +
+				"ORDER BY id LIMIT 2;", false},
+		{"alias and where", SQLite, SelectAttr{TotalColumn: "__total",
+			Alias: "u", Wheres: []string{"u.age >= ?"}},
+			"SELECT u.*, count(*) OVER () AS __total from testuser u " +
+				"where u.age >= ?;", false},
+		{"postgres", Postgres, SelectAttr{TotalColumn: "__total",
+			Paginator: &Paginator{Offset: 2, Limit: 2}},
+			"SELECT *, count(*) OVER () AS __total from testuser " +
+				"LIMIT 2 OFFSET 2;", false},
+		{"no window functions", noWindow, SelectAttr{TotalColumn: "__total"},
+			"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			got, err := Select[testUser](&tt.attr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
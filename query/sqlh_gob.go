@@ -0,0 +1,82 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Gob encoded complex fields.
+
+package query
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// gobFallback is true if the complex fields are gob encoded.
+var gobFallback = true
+
+// SetGobFallback sets whether the struct, map, slice and array fields which
+// are not registered custom types are gob encoded. The gob encoded fields are
+// stored in "blob" columns: encoded on write and decoded on read. If the gob
+// fallback is off such fields return the *UnsupportedTypeError error. It is on
+// by default.
+func SetGobFallback(on bool) {
+	gobFallback = on
+}
+
+// valuerType is the driver.Valuer interface type.
+var valuerType = reflect.TypeFor[driver.Valuer]()
+
+// isGob returns true if the field is gob encoded. The embedded struct fields
+// are never gob encoded.
+func isGob(field reflect.StructField, t reflect.Type) bool {
+	return gobFallback && isComplex(field, t)
+}
+
+// isComplex returns true if the field of type t is the struct, map, slice or
+// array field which is gob encoded if the gob fallback is on.
+func isComplex(field reflect.StructField, t reflect.Type) bool {
+	if field.Anonymous || isRegisteredType(t) ||
+		t == reflect.TypeFor[time.Time]() || t.Implements(valuerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// encodeGob returns the gob encoded field f value.
+func encodeGob(f reflect.Value, name string) (any, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).EncodeValue(f); err != nil {
+		return nil, fmt.Errorf("can't encode field %s: %w", name, err)
+	}
+	return b.Bytes(), nil
+}
+
+// decodeGob sets the field f value from the gob encoded argument arg.
+func decodeGob(f reflect.Value, name string, arg any) error {
+	var b []byte
+	switch v := arg.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(arg)}
+	}
+
+	// Decode into the zero value, so the maps are not merged
+	f.SetZero()
+	if err := gob.NewDecoder(bytes.NewReader(b)).DecodeValue(f); err != nil {
+		return fmt.Errorf("can't decode field %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testPoint is the tests nested struct.
+type testPoint struct {
+	X, Y int
+}
+
+// testGob is the tests struct with the gob encoded fields.
+type testGob struct {
+	ID     int64          `db:"id"`
+	Counts map[string]int `db:"counts"`
+	Point  testPoint      `db:"point"`
+	Tags   []string       `db:"tags"`
+	Pair   [2]int         `db:"pair"`
+}
+
+func TestGob(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	stmt, err := Table[testGob]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS testgob (id integer, counts blob, " +
+		"point blob, tags blob, pair blob);"; stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+
+	all := testGob{1, map[string]int{"a": 1, "b": 2}, testPoint{3, 4},
+		[]string{"x", "y"}, [2]int{5, 6}}
+	tests := []struct {
+		name string
+		row  testGob
+		want testGob
+	}{
+		{"all fields", all, all},
+		{"map only", testGob{ID: 2, Counts: map[string]int{"a": 1}},
+			testGob{ID: 2, Counts: map[string]int{"a": 1}}},
+		{"empty map", testGob{ID: 3, Counts: map[string]int{}},
+			testGob{ID: 3, Counts: map[string]int{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The complex fields are written as bytes
+			args, err := InsertArgs(tt.row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, arg := range args[1:] {
+				if _, ok := arg.([]byte); !ok {
+					t.Errorf("got arg %d %T, want []byte", i+1, arg)
+				}
+			}
+
+			// The read row is the written one, the old map values are not
+			// merged
+			row := testGob{Counts: map[string]int{"old": 1}}
+			scan := make([]any, len(args))
+			for i := range args {
+				scan[i] = &args[i]
+			}
+			if err = ArgsAppay(&row, scan); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("got %+v, want %+v", row, tt.want)
+			}
+		})
+	}
+
+	// The fields are unsupported without gob fallback
+	SetGobFallback(false)
+	offTests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"table", func() error {
+			_, err := Table[testGob]()
+			return err
+		}},
+		{"insert args", func() error {
+			_, err := InsertArgs(all)
+			return err
+		}},
+		{"apply", func() error {
+			var row testGob
+			args := []any{int64(1), []byte{1}, nil, nil, nil}
+			scan := make([]any, len(args))
+			for i := range args {
+				scan[i] = &args[i]
+			}
+			return ArgsAppay(&row, scan)
+		}},
+	}
+	for _, tt := range offTests {
+		t.Run("no fallback "+tt.name, func(t *testing.T) {
+			err := tt.fn()
+			var ute *UnsupportedTypeError
+			if !errors.As(err, &ute) || ute.Field != "Counts" {
+				t.Errorf("got error %v, want Counts *UnsupportedTypeError",
+					err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Joined tables.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Join defines the table joined to the SELECT statement table, f.e.
+// "LEFT JOIN orders o ON t.id = o.user_id". Create it with the MakeJoin
+// function.
+type Join struct {
+	Join   string   // Join type: "JOIN", "INNER JOIN", "LEFT JOIN" or "LEFT OUTER JOIN"
+	Name   string   // Joined table name
+	Alias  string   // Joined table alias
+	On     string   // Join condition, f.e. "t.id = o.user_id"
+	Fields []string // Selected joined table columns qualified with the alias
+}
+
+// joinTypes are the supported join types.
+var joinTypes = map[string]bool{
+	"JOIN":            true,
+	"INNER JOIN":      true,
+	"LEFT JOIN":       true,
+	"LEFT OUTER JOIN": true,
+}
+
+// aliasRe is the valid table alias regular expression.
+var aliasRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MakeJoin returns the Join of the T struct database table with the given join
+// type, table alias and On condition. The selected joined table Fields are all
+// T struct database fields qualified with the alias, so the joined row is
+// scanned after the main table row in the T struct fields order.
+func MakeJoin[T any](joinType, alias, on string) Join {
+	join := Join{
+		Join:  strings.ToUpper(strings.Join(strings.Fields(joinType), " ")),
+		Name:  name[T](),
+		Alias: alias,
+		On:    on,
+	}
+	for _, field := range fields[T]() {
+		join.Fields = append(join.Fields, alias+"."+quoteIdent(field))
+	}
+	return join
+}
+
+// JoinOn returns the Join of the T struct database table joined by the column
+// with the same name in both tables, f.e. JoinOn[Order]("LEFT JOIN", "o", "t",
+// "user_id") joins "ON t.user_id = o.user_id". The Fields are set the same way
+// as in the MakeJoin function. Use the MakeJoin function with explicit On
+// condition if the key columns have different names.
+func JoinOn[T any](joinType, alias, leftAlias, col string) Join {
+	return MakeJoin[T](joinType, alias, leftAlias+"."+quoteIdent(col)+" = "+
+		alias+"."+quoteIdent(col))
+}
+
+// joinClauses returns the JOIN clauses with leading spaces made from the joins.
+// It returns an error if the join type, alias or On condition is invalid.
+func joinClauses(joins []Join) (clauses string, err error) {
+	for _, join := range joins {
+		switch {
+		case !joinTypes[join.Join]:
+			err = fmt.Errorf("invalid join type: %q", join.Join)
+		case !aliasRe.MatchString(join.Alias):
+			err = fmt.Errorf("invalid join table alias: %q", join.Alias)
+		case len(join.On) == 0:
+			err = fmt.Errorf("join %s on condition should be set", join.Name)
+		}
+		if err != nil {
+			return
+		}
+		clauses += fmt.Sprintf(" %s %s %s ON %s", join.Join,
+			quoteIdent(join.Name), join.Alias, join.On)
+	}
+	return
+}
+
+// joinColumns returns the selected columns of the statement with joins: the T
+// struct database fields qualified with the table alias followed by the joins
+// Fields.
+func joinColumns[T any](alias string, joins []Join) string {
+	var columns []string
+	for _, field := range fields[T]() {
+		columns = append(columns, alias+"."+quoteIdent(field))
+	}
+	for _, join := range joins {
+		columns = append(columns, join.Fields...)
+	}
+	return strings.Join(columns, ", ")
+}
@@ -7,19 +7,151 @@
 package query
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var ErrTypeIsNotStruct = fmt.Errorf("type is not a struct")
 
+// UnsupportedTypeError is returned when the struct field type or the database
+// value type for the struct field is not supported.
+type UnsupportedTypeError struct {
+	Field string       // Struct field name
+	Type  reflect.Type // Unsupported type
+}
+
+// Error returns the error message.
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported type %v of field %s", e.Type, e.Field)
+}
+
+// implicitNotNull defines if Table function adds "not null" to non-pointer
+// fields columns.
+var implicitNotNull bool
+
+// SetImplicitNotNull sets if Table function adds "not null" key to columns of
+// the non-pointer struct fields which db_key tag does not define nullability
+// ("null" or "not null"). The pointer fields columns stay nullable. It is off
+// by default.
+func SetImplicitNotNull(on bool) {
+	implicitNotNull = on
+}
+
+// maxInParams is the maximum number of IN list parameters in one statement.
+var maxInParams = 999
+
+// SetMaxInParams sets the maximum number of parameters of one IN list. The
+// high-level sqlh functions split the larger IN lists into chunks executed as
+// separate statements, so the statements don't exceed the database bound
+// parameters limit. The default is 999 (SQLite default limit), zero or
+// negative n disables splitting.
+func SetMaxInParams(n int) {
+	maxInParams = n
+}
+
+// MaxInParams returns the maximum number of parameters of one IN list set by
+// SetMaxInParams.
+func MaxInParams() int {
+	return maxInParams
+}
+
+// ResetDefaults restores the package configuration to the defaults: SQLite
+// dialect, UTC time location, implicit not null off, 999 IN list parameters
+// and gob fallback on. The registered custom types are not changed. It may be
+// used in tests cleanup, so the configuration changed by one test does not
+// affect others.
+func ResetDefaults() {
+	SetDialect(SQLite)
+	SetTimeLocation(time.UTC)
+	SetImplicitNotNull(false)
+	SetMaxInParams(999)
+	SetGobFallback(true)
+}
+
 // SelectAttr defines attributes for SELECT statement.
 type SelectAttr struct {
 	Paginator *Paginator // Offset and limit (optional)
 	Wheres    []string   // Where clauses (optional)
 	OrderBy   string     // Order by (optional)
+	Name      string     // Table name instead of struct based name (optional)
+
+	// Selected columns (optional). If empty all columns are selected. The
+	// column may be the expression with alias, f.e. "count(*) AS cnt", the
+	// alias must be the struct database field.
+	Columns []string
+
+	// Group by columns (optional).
+	GroupBy []string
+
+	// Distinct on columns (optional). Selects only the first row of each set
+	// of rows with equal values of these columns, f.e.
+	// "SELECT DISTINCT ON (user_id) * from orders ORDER BY user_id, created
+	// DESC". The ORDER BY must start with these columns. It is supported by
+	// Postgres only.
+	DistinctOn []string
+
+	// Table alias (optional). If set, the table is selected with this alias
+	// and the selected columns are qualified with it, f.e.
+	// "SELECT t.* from users t".
+	Alias string
+
+	// Row locking clause, f.e. "FOR UPDATE", "FOR SHARE" or "FOR UPDATE SKIP
+	// LOCKED" (optional). It is omitted if current dialect does not support
+	// row locking (SQLite).
+	Lock string
+
+	// Total rows column alias (optional). If set, the "count(*) OVER () AS
+	// alias" column with the total number of rows matching the where clauses
+	// is added to the selected columns, so the page rows and the total are
+	// selected in one query. It requires current dialect window functions
+	// support.
+	TotalColumn string
+
+	// Joined tables (optional). The Alias must be set if the joins are set.
+	// The selected columns are all T struct database fields qualified with
+	// the Alias followed by the joins Fields. Create the joins with the
+	// MakeJoin function.
+	Joins []Join
+}
+
+// name returns the attr table name or the given default table name if attr
+// is nil or its Name is not set.
+func (attr *SelectAttr) name(table string) string {
+	if attr == nil || attr.Name == "" {
+		return table
+	}
+	return attr.Name
+}
+
+// Clone returns a deep copy of the attr, so the copy may be modified without
+// changing the attr, f.e. to derive queries from the base attributes. The
+// Select function does not modify the attr. Clone of nil attr returns nil.
+func (attr *SelectAttr) Clone() *SelectAttr {
+	if attr == nil {
+		return nil
+	}
+	c := *attr
+	if attr.Paginator != nil {
+		paginator := *attr.Paginator
+		c.Paginator = &paginator
+	}
+	c.Wheres = slices.Clone(attr.Wheres)
+	c.Columns = slices.Clone(attr.Columns)
+	c.GroupBy = slices.Clone(attr.GroupBy)
+	c.DistinctOn = slices.Clone(attr.DistinctOn)
+	c.Joins = slices.Clone(attr.Joins)
+	for i := range c.Joins {
+		c.Joins[i].Fields = slices.Clone(c.Joins[i].Fields)
+	}
+	return &c
 }
 
 // Paginator defines attributes for SELECT statement.
@@ -51,9 +183,48 @@ type Paginator struct {
 // Struct tagas are used to map database fields to struct fields.
 // The tag is optional. Next tags may be used:
 //   - db:"some_field_name" - set database field name
+//   - db:"name,omitempty" - skip the field zero value on insert, so the
+//     database default is used
+//   - db:"name,readonly" - the same as db_ro:"true"
 //   - db_type:"text" - set database field type
 //   - db_key:"not null primary key" - set database field key
+//   - db_key:"primary key autoincrement" or db_type:"serial" - autoincrement
+//     primary key translated to current dialect, returns an error if the field
+//     is not the primary key
+//   - db_ro:"true" or db_key:"readonly" - read only field which is selected but
+//     never inserted or updated, f.e. generated column
+//   - db_null:"zero" - field zero value is written as NULL, f.e. empty string
+//     in the nullable unique column
+//   - db_check:"age >= 0" - column check constraint
+//   - db_collate:"nocase" - text column collation, the dialect specific name
+//     is added as is, f.e. "COLLATE nocase"
+//   - db_order:"1" - column position, the fields with db_order go first
+//     sorted by it and the other fields follow in declaration order, so the Go
+//     fields may be reordered without changing the columns order
+//   - db_index:"2" - zero based result set column position used to scan the
+//     raw queries results by position, see IndexColumns
+//
+// The blank "_" fields are not columns, their db_key tag defines the table
+// constraint, f.e. composite unique or primary key, and their db_check tag
+// defines the table check constraint:
+//
+//	_ struct{} `db_key:"unique (email, tenant_id)"`
+//	_ struct{} `db_check:"start_at < end_at"`
 func Table[T any]() (string, error) {
+	return createTable[T](true)
+}
+
+// CreateTableStrict returns a SQL CREATE TABLE statement for the given struct
+// type without the "IF NOT EXISTS" clause, so the database returns an error if
+// the table already exists. It works the same way as the Table function
+// otherwise.
+func CreateTableStrict[T any]() (string, error) {
+	return createTable[T](false)
+}
+
+// createTable returns a SQL CREATE TABLE statement for the given struct type.
+// The ifNotExists parameter adds the "IF NOT EXISTS" clause.
+func createTable[T any](ifNotExists bool) (string, error) {
 
 	// Check if type is struct
 	if err := checkType[T](); err != nil {
@@ -61,12 +232,34 @@ func Table[T any]() (string, error) {
 	}
 
 	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
-	var dbFields []string
-	for i := 0; i < t.NumField(); i++ {
+	var dbFields, constraints []string
+	for _, i := range fieldOrder(t) {
 
 		field := t.Field(i)
 
+		// Get table constraints from the blank "_" field
+		if field.Name == "_" {
+			constraint, err := tableConstraint(t, field)
+			if err != nil {
+				return "", err
+			}
+			if len(constraint) > 0 {
+				constraints = append(constraints, constraint)
+			}
+			check, err := checkConstraint(field)
+			if err != nil {
+				return "", err
+			}
+			if len(check) > 0 {
+				constraints = append(constraints, check)
+			}
+			continue
+		}
+
 		// Get field name
 		fieldName, ok := getFieldName(field)
 		if !ok {
@@ -79,245 +272,1540 @@ func Table[T any]() (string, error) {
 			return "", err
 		}
 
+		// Get field key
+		fieldKey := fieldKey(field)
+
+		// Translate autoincrement column to current dialect
+		if isAutoIncrement(field) {
+			fieldType, fieldKey, err = autoIncrementColumn(field, fieldType,
+				fieldKey)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if implicitNotNull && field.Type.Kind() != reflect.Ptr &&
+			!strings.Contains(strings.ToLower(fieldKey), "null") {
+			fieldKey = strings.TrimLeft(fieldKey+" not null", " ")
+		}
+
+		// Add column collation
+		collate, err := collateClause(field, fieldType)
+		if err != nil {
+			return "", err
+		}
+		fieldType += collate
+
+		// Add column check constraint
+		check, err := checkConstraint(field)
+		if err != nil {
+			return "", err
+		}
+		fieldKey = strings.TrimLeft(fieldKey+" "+check, " ")
+
 		dbFields = append(dbFields,
 			strings.TrimRight(
 				// Remove trailing spaces from the string
-				fmt.Sprintf("%s %s %s", strings.ToLower(fieldName), fieldType,
-					field.Tag.Get("db_key")),
+				fmt.Sprintf("%s %s %s", quoteIdent(strings.ToLower(fieldName)), fieldType,
+					fieldKey),
 				" ",
 			),
 		)
 	}
 
 	// Return CREATE TABLE statement
-	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);",
-		name[T](),
-		strings.Join(dbFields, ", "),
+	var exists string
+	if ifNotExists {
+		exists = "IF NOT EXISTS "
+	}
+	return fmt.Sprintf("CREATE TABLE %s%s (%s);", exists,
+		quoteIdent(name[T]()),
+		strings.Join(append(dbFields, constraints...), ", "),
 	), nil
 }
 
-// Insert returns a SQL INSERT statement for the given struct type.
+// constraintRe matches the composite unique or primary key table constraint.
+var constraintRe = regexp.MustCompile(`(?i)^\s*(unique|primary\s+key)\s*\((.*)\)\s*$`)
+
+// checkConstraint returns the CHECK constraint defined with the db_check tag
+// of the field, f.e. db_check:"age >= 0" returns "check (age >= 0)". The
+// expression is added as is, it may contain quoted strings. It returns empty
+// string if the tag is not set, and an error if the expression is empty or
+// its parentheses are not balanced.
+func checkConstraint(field reflect.StructField) (string, error) {
+	expr, ok := field.Tag.Lookup("db_check")
+	if !ok {
+		return "", nil
+	}
+	expr = strings.TrimSpace(expr)
+
+	// Check parentheses balance outside of quoted strings
+	var depth int
+	var quote rune
+	for _, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if len(expr) == 0 || depth != 0 || quote != 0 {
+		return "", fmt.Errorf("invalid db_check expression of field %s: %q",
+			field.Name, expr)
+	}
+
+	return fmt.Sprintf("check (%s)", expr), nil
+}
+
+// collateRe is the valid collation name regular expression, the name may be
+// quoted, f.e. "nocase", "utf8mb4_general_ci" or `"und-x-icu"`.
+var collateRe = regexp.MustCompile(`^("[A-Za-z0-9_.-]+"|[A-Za-z0-9_.-]+)$`)
+
+// textTypes are the text column base types.
+var textTypes = []string{"text", "varchar", "char", "character", "nvarchar",
+	"nchar", "string", "clob", "tinytext", "mediumtext", "longtext", "citext"}
+
+// IsTextType returns true if the database column type is the text type. The
+// type is case insensitive and may have size or other modifiers, f.e.
+// "VARCHAR(64)" or "character varying".
+func IsTextType(columnType string) bool {
+	baseType := strings.ToLower(columnType)
+	if i := strings.IndexAny(baseType, "( "); i > 0 {
+		baseType = baseType[:i]
+	}
+	return slices.Contains(textTypes, baseType)
+}
+
+// collateClause returns the " COLLATE name" column clause from the field
+// db_collate tag, f.e. db_collate:"nocase", or empty string if the tag is not
+// set. The collation name is dialect specific and is added as is. It returns
+// an error if the name is invalid or the column type is not text.
+func collateClause(field reflect.StructField, fieldType string) (string,
+	error) {
+
+	collate, ok := field.Tag.Lookup("db_collate")
+	if !ok {
+		return "", nil
+	}
+	if !collateRe.MatchString(collate) {
+		return "", fmt.Errorf("invalid db_collate %q of field %s", collate,
+			field.Name)
+	}
+
+	// Check that the column type is text
+	if !IsTextType(fieldType) {
+		return "", fmt.Errorf("db_collate of field %s requires text column "+
+			"type, got %s", field.Name, fieldType)
+	}
+
+	return " COLLATE " + collate, nil
+}
+
+// tableConstraint returns the table constraint defined with the db_key tag of
+// the blank "_" struct field, f.e. db_key:"unique (email, tenant_id)". The
+// unique and primary key constraints columns are validated against the struct
+// type t database fields. Other constraints are returned as is.
+func tableConstraint(t reflect.Type, field reflect.StructField) (string,
+	error) {
+
+	key := strings.TrimSpace(field.Tag.Get("db_key"))
+	m := constraintRe.FindStringSubmatch(key)
+	if m == nil {
+		return key, nil
+	}
+
+	// Check constraint columns
+	var columns []string
+	for _, column := range strings.Split(m[2], ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	if _, err := columnsIndex(t, columns); err != nil {
+		return "", fmt.Errorf("table constraint %q: %w", key, err)
+	}
+
+	kind := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+	return fmt.Sprintf("%s (%s)", kind,
+		strings.Join(quoteIdents(columns), ", ")), nil
+}
+
+// AddColumn returns a SQL ALTER TABLE ADD COLUMN statement for the given
+// struct type field.
 //
-// The struct may be tagged with "db" tags to specify the database field names.
-// If the "db" tag is not specified, the field name will be used as the database
-// field name. The returned string is a SQL statement that can be executed
-// directly.
-func Insert[T any]() (string, error) {
+// The fieldName parameter is the struct field name. The column name and type
+// are taken from the field the same way as in the Table function. The function
+// returns an error if the field does not exist or is not mapped to a database
+// field (tagged with db:"-").
+//
+// The added column can't be a primary key or unique, and can't be not null
+// without default value (this is SQLite limitation), so these keys are removed
+// from the db_key tag value.
+func AddColumn[T any](fieldName string) (string, error) {
 
 	// Check if type is struct
 	if err := checkType[T](); err != nil {
 		return "", err
 	}
 
-	// Get table field names
-	fields := fields[T]()
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
-	// Return INSERT statement
-	return fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s);",
-		name[T](),
-		strings.Join(fields, ","),
-		strings.TrimRight(strings.Repeat("?,", len(fields)), ","),
+	// Get struct field
+	field, ok := t.FieldByName(fieldName)
+	if !ok {
+		return "", fmt.Errorf("field %s not found", fieldName)
+	}
+
+	// Get column name
+	columnName, ok := getFieldName(field)
+	if !ok {
+		return "", fmt.Errorf("field %s is not a database field", fieldName)
+	}
+
+	// Get column type
+	columnType, err := getFieldType(field)
+	if err != nil {
+		return "", err
+	}
+
+	// Add column collation
+	collate, err := collateClause(field, columnType)
+	if err != nil {
+		return "", err
+	}
+	columnType += collate
+
+	// Return ALTER TABLE statement
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;",
+		quoteIdent(name[T]()),
+		strings.TrimRight(
+			// Remove trailing spaces from the string
+			fmt.Sprintf("%s %s %s", quoteIdent(strings.ToLower(columnName)),
+				columnType,
+				addColumnKey(fieldKey(field))),
+			" ",
+		),
 	), nil
 }
 
-// Update returns a SQL UPDATE statement for the given struct type.
+// TableColumns returns a SQL statement which selects names and types of the
+// existing columns of the T database table.
 //
-// The wheres parameter is an optional list of where clauses. If specified, the
-// where clauses will be joined with " and " and added to the SQL statement.
-func Update[T any](wheres ...string) (string, error) {
+// The statement depends on current dialect: the built-in dialects use
+// pragma_table_info on SQLite and information_schema.columns on MySQL and
+// Postgres. The statement
+// returns two columns: column name and column type.
+func TableColumns[T any]() (string, error) {
 
 	// Check if type is struct
 	if err := checkType[T](); err != nil {
 		return "", err
 	}
 
-	// Get field names
-	fields := fields[T]()
+	// Return dialect specific statement
+	if dialect.TableColumns == nil {
+		return "", fmt.Errorf("dialect %s does not support table columns",
+			dialect)
+	}
+	return dialect.TableColumns(name[T]()), nil
+}
 
-	// Where clause should be set
-	if len(wheres) == 0 {
-		return "", fmt.Errorf(
-			"where clause should be set in the Update statement",
-		)
+// CountEstimate returns a SQL statement which selects the approximate number
+// of the T database table rows from the database statistics, f.e. from
+// pg_class on Postgres and information_schema.tables on MySQL. The ok result
+// is false if current dialect does not support the estimate (SQLite).
+func CountEstimate[T any]() (stmt string, ok bool, err error) {
+
+	// Check if type is struct
+	if err = checkType[T](); err != nil {
+		return
 	}
 
-	// Return UPDATE statement
-	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
-		name[T](),
-		strings.Join(fields, "=?,")+"=?",
-		strings.Join(wheres, "? AND ")+"?",
-	), nil
+	// Return dialect specific statement
+	if dialect.CountEstimate == nil {
+		return
+	}
+	return dialect.CountEstimate(name[T]()), true, nil
 }
 
-// Select returns a SQL SELECT statement for the given struct type.
-//
-// The struct may be tagged with "db" tags to specify the database field names.
-// If the "db" tag is not specified, the field name will be used as the database
-// field name. The returned string is a SQL statement that can be executed
-// directly.
+// Migrate returns a list of SQL ALTER TABLE ADD COLUMN statements for the T
+// struct fields which columns are missing in the existing columns list.
 //
-// The wheres parameter is an optional list of where clauses. If specified, the
-// where clauses will be joined with " and " and added to the SQL statement.
-func Select[T any](attr *SelectAttr) (string, error) {
+// The columns parameter is a list of existing T database table columns, f.e.
+// selected by the TableColumns statement. Existing columns are never dropped.
+func Migrate[T any](columns []string) (stmts []string, err error) {
 
 	// Check if type is struct
-	if err := checkType[T](); err != nil {
-		return "", err
+	if err = checkType[T](); err != nil {
+		return
 	}
 
-	// Make where clause and offset limit from attr struct
-	var where string
-	var limit string
-	var orderby string
-	if attr != nil {
-		// Where clauses
-		if len(attr.Wheres) > 0 {
-			where = strings.Join(attr.Wheres, " and ")
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Make existing columns map
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[strings.ToLower(column)] = true
+	}
+
+	// Loop through the struct fields and add missing columns
+	for _, i := range fieldOrder(t) {
+		fieldName, ok := getFieldName(t.Field(i))
+		if !ok || existing[strings.ToLower(fieldName)] {
+			continue
 		}
-		if len(where) > 0 {
-			where = fmt.Sprintf(" where %s", where)
+
+		stmt, err := AddColumn[T](t.Field(i).Name)
+		if err != nil {
+			return nil, err
 		}
+		stmts = append(stmts, stmt)
+	}
 
-		// Order by
-		if len(attr.OrderBy) > 0 {
-			orderby = fmt.Sprintf(" ORDER BY %s", attr.OrderBy)
+	return
+}
+
+// Columns returns the T struct database field names in the struct fields
+// order, respecting db tags and skipping fields tagged with db:"-".
+//
+// If includeAuto is false the autoincrement and read only fields are skipped,
+// so the result is the list of columns written by the Insert statement. The
+// omitempty fields are included, though the Insert statement skips them if
+// they are zero in the inserted row. Otherwise all database fields are
+// returned. It returns nil if T is not a struct.
+func Columns[T any](includeAuto bool) (columns []string) {
+	if checkType[T]() != nil {
+		return nil
+	}
+	if includeAuto {
+		return fields[T]()
+	}
+
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, i := range fieldsIndex(t) {
+		field := t.Field(i)
+		if isReadOnly(field) || isAutoIncrement(field) {
+			continue
 		}
+		fieldName, _ := getFieldName(field)
+		columns = append(columns, fieldName)
+	}
+	return
+}
 
-		// Offset and limit
-		if attr.Paginator != nil {
-			switch {
-			// No limit and offset
-			case attr.Paginator.Limit <= 0 && attr.Paginator.Offset <= 0:
-
-			// Limit is set
-			case attr.Paginator.Limit > 0:
-				limit = fmt.Sprintf(" LIMIT %d, %d", attr.Paginator.Offset,
-					attr.Paginator.Limit)
-
-			// Limit is not set - get all rows
-			default:
-				limit = fmt.Sprintf(" LIMIT %d, ~0", attr.Paginator.Offset)
-			}
+// PrimaryKeys returns the T struct database field names of the fields tagged
+// with db_key containing "primary key".
+func PrimaryKeys[T any]() (keys []string) {
+	if checkType[T]() != nil {
+		return
+	}
+
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+		fieldName, ok := getFieldName(field)
+		if ok && strings.Contains(strings.ToLower(field.Tag.Get("db_key")),
+			"primary key") {
+			keys = append(keys, fieldName)
 		}
 	}
+	return
+}
 
-	// Return the complete SELECT statement
-	return fmt.Sprintf("SELECT * from %s%s%s%s;",
-		name[T](),
-		where,
-		orderby,
-		limit,
-	), nil
+// FieldTypes returns the T struct database field names and types the same way
+// as they are used in the Table function.
+func FieldTypes[T any]() (columns, columnTypes []string, err error) {
+
+	// Check if type is struct
+	if err = checkType[T](); err != nil {
+		return
+	}
+
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Loop through the struct fields
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+
+		fieldName, ok := getFieldName(field)
+		if !ok {
+			continue
+		}
+		fieldType, err := getFieldType(field)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns = append(columns, strings.ToLower(fieldName))
+		columnTypes = append(columnTypes, fieldType)
+	}
+
+	return
 }
 
-// Count returns a SQL COUNT statement for the given struct type.
+// addColumnKey removes keys which are not allowed in the ALTER TABLE ADD
+// COLUMN statement from the db_key tag value.
+func addColumnKey(key string) string {
+	lower := strings.ToLower(key)
+
+	// Not null column should have default value
+	remove := []string{"primary key", "unique", "autoincrement",
+		"auto_increment"}
+	if !strings.Contains(lower, "default") {
+		remove = append(remove, "not null")
+	}
+
+	// Remove not allowed keys
+	for _, r := range remove {
+		for i := strings.Index(lower, r); i >= 0; i = strings.Index(lower, r) {
+			key = key[:i] + key[i+len(r):]
+			lower = lower[:i] + lower[i+len(r):]
+		}
+	}
+
+	return strings.Join(strings.Fields(key), " ")
+}
+
+// Insert returns a SQL INSERT statement for the given struct type.
 //
 // The struct may be tagged with "db" tags to specify the database field names.
 // If the "db" tag is not specified, the field name will be used as the database
 // field name. The returned string is a SQL statement that can be executed
 // directly.
 //
-// The wheres parameter is an optional list of where clauses. If specified, the
-// where clauses will be joined with " and " and added to the SQL statement.
-func Count[T any](attr *SelectAttr) (string, error) {
+// The autoincrement fields (tagged with db_key containing "autoincrement" or
+// "auto_increment") are skipped, so the database generates their values. The
+// optional row parameter may be used to include autoincrement fields which are
+// explicitly set (not zero) in this row. The fields with db tag omitempty
+// option are included the same way. Use the InsertArgs function to get
+// arguments matching the statement created for the row.
+//
+// The T type may be a struct or a pointer to struct, both produce the same
+// statement for the same row.
+func Insert[T any](row ...T) (string, error) {
+	return InsertName[T](name[T](), row...)
+}
+
+// InsertName returns a SQL INSERT statement for the given struct type into the
+// table with the given name instead of the struct name based table name.
+//
+// It may be used to insert into the tables with the same struct but different
+// names, f.e. partitions like "logs_2024_06".
+func InsertName[T any](table string, row ...T) (string, error) {
 
 	// Check if type is struct
 	if err := checkType[T](); err != nil {
 		return "", err
 	}
 
-	// Make where clause and offset limit from attr struct
-	var where string
-	if attr != nil {
-		// Where clauses
-		if len(attr.Wheres) > 0 {
-			where = strings.Join(attr.Wheres, " and ")
-		}
-		if len(where) > 0 {
-			where = fmt.Sprintf(" where %s", where)
-		}
+	// Get table field names
+	var rowVal reflect.Value
+	if len(row) > 0 {
+		rowVal = reflect.ValueOf(row[0])
 	}
+	fields, _ := insertFields(reflect.TypeOf(new(T)).Elem(), rowVal)
 
-	// Return the complete SELECT statement
-	return fmt.Sprintf("SELECT count(*) from %s%s;", name[T](), where), nil
+	// Return INSERT statement
+	return Rebind(fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s);",
+		quoteIdent(table),
+		strings.Join(quoteIdents(fields), ","),
+		strings.TrimRight(strings.Repeat("?,", len(fields)), ","),
+	)), nil
 }
 
-// Delete returns a SQL DELETE statement for the given struct type.
-//
-// The struct may be tagged with "db" tags to specify the database field names.
-// If the "db" tag is not specified, the field name will be used as the database
-// field name. The returned string is a SQL statement that can be executed
-// directly.
+// InsertOrIgnore returns a SQL INSERT statement for the given struct type
+// which skips the row if it conflicts with the existing row by primary key or
+// unique columns.
 //
-// The wheres parameter is an optional list of where clauses. If specified, the
-// where clauses will be joined with " and " and added to the SQL statement.
-func Delete[T any](wheres ...string) (string, error) {
+// The statement is created with current dialect InsertIgnore function, f.e.
+// "INSERT OR IGNORE" in SQLite, "INSERT IGNORE" in MySQL and "INSERT ... ON
+// CONFLICT DO NOTHING" in Postgres. The autoincrement fields are included the
+// same way as in the Insert function. Use the InsertArgs function to get the
+// statement arguments.
+func InsertOrIgnore[T any](row ...T) (string, error) {
 
 	// Check if type is struct
 	if err := checkType[T](); err != nil {
 		return "", err
 	}
 
-	// Join the where statements with " and "
-	var where string
-	if len(wheres) > 0 {
-		where = strings.Join(wheres, "? AND ")
+	// Check dialect support
+	if dialect.InsertIgnore == nil {
+		return "", fmt.Errorf("dialect %s does not support insert or ignore",
+			dialect)
+	}
+
+	// Get table field names
+	var rowVal reflect.Value
+	if len(row) > 0 {
+		rowVal = reflect.ValueOf(row[0])
+	}
+	fields, _ := insertFields(reflect.TypeOf(new(T)).Elem(), rowVal)
+
+	// Return INSERT statement
+	insert := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)",
+		quoteIdent(name[T]()),
+		strings.Join(quoteIdents(fields), ","),
+		strings.TrimRight(strings.Repeat("?,", len(fields)), ","),
+	)
+	return Rebind(dialect.InsertIgnore(insert) + ";"), nil
+}
+
+// Upsert returns a SQL INSERT statement for the given struct type which
+// updates the existing row if the row with the same conflict columns values
+// already exists.
+//
+// The conflict parameter is a list of unique or primary key columns. The
+// upsert clause is created with current dialect UpsertClause function. The
+// autoincrement fields are included the same way as in the Insert function for
+// the given row. Use the InsertArgs function to get the statement arguments.
+func Upsert[T any](row T, conflict ...string) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Check dialect support
+	if dialect.UpsertClause == nil {
+		return "", fmt.Errorf("dialect %s does not support upsert", dialect)
+	}
+
+	// Get insert and update field names
+	t := reflect.TypeOf(new(T)).Elem()
+	fields, _ := insertFields(t, reflect.ValueOf(row))
+	update, _ := updateFields(t)
+
+	// Return INSERT statement with upsert clause
+	return Rebind(fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)%s;",
+		quoteIdent(name[T]()),
+		strings.Join(quoteIdents(fields), ","),
+		strings.TrimRight(strings.Repeat("?,", len(fields)), ","),
+		dialect.UpsertClause(quoteIdents(conflict), quoteIdents(update)),
+	)), nil
+}
+
+// Update returns a SQL UPDATE statement for the given struct type.
+//
+// The wheres parameter is an optional list of where clauses. If specified, the
+// where clauses will be joined with " and " and added to the SQL statement.
+//
+// The fields tagged with db_auto:"created" are not updated. Use the UpdateArgs
+// function to get arguments matching the statement.
+func Update[T any](wheres ...string) (string, error) {
+	return UpdateName[T](name[T](), wheres...)
+}
+
+// UpdateName returns a SQL UPDATE statement for the given struct type in the
+// table with the given name instead of the struct name based table name.
+func UpdateName[T any](table string, wheres ...string) (string, error) {
+	return UpdateClauses[T](table, placeholderClauses(wheres)...)
+}
+
+// UpdateClauses returns a SQL UPDATE statement for the given struct type in
+// the table with the given name.
+//
+// Unlike UpdateName it takes complete where clauses with placeholders, f.e.
+// "id IN (?,?)", and joins them with " AND " as is.
+func UpdateClauses[T any](table string, clauses ...string) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Get field names
+	fields, _ := updateFields(reflect.TypeOf(new(T)).Elem())
+
+	// Where clause should be set
+	if len(clauses) == 0 {
+		return "", fmt.Errorf(
+			"where clause should be set in the Update statement",
+		)
+	}
+
+	// Return UPDATE statement
+	return Rebind(fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
+		quoteIdent(table),
+		strings.Join(quoteIdents(fields), "=?,")+"=?",
+		strings.Join(clauses, " AND "),
+	)), nil
+}
+
+// UpdateFields returns a SQL UPDATE statement for the given struct type which
+// updates only the given cols columns.
+//
+// The cols parameter is a list of database field names which should be
+// updated. The function returns an error if any of them is not a T struct
+// database field. The wheres parameter works the same way as in the Update
+// function. Use the ColumnsArgs function to get arguments matching the
+// statement.
+func UpdateFields[T any](cols []string, wheres ...string) (string, error) {
+	return UpdateFieldsClauses[T](cols, placeholderClauses(wheres)...)
+}
+
+// UpdateFieldsClauses returns a SQL UPDATE statement for the given struct type
+// which updates only the given cols columns.
+//
+// Unlike UpdateFields it takes complete where clauses with placeholders, f.e.
+// "id IN (?,?)", and joins them with " AND " as is.
+func UpdateFieldsClauses[T any](cols []string, clauses ...string) (string,
+	error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Check columns
+	if len(cols) == 0 {
+		return "", fmt.Errorf("columns should be set in the Update statement")
+	}
+	if _, err := columnsIndex(reflect.TypeOf(new(T)).Elem(), cols); err != nil {
+		return "", err
+	}
+
+	// Where clause should be set
+	if len(clauses) == 0 {
+		return "", fmt.Errorf(
+			"where clause should be set in the Update statement",
+		)
+	}
+
+	// Return UPDATE statement
+	return Rebind(fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
+		quoteIdent(name[T]()),
+		strings.Join(quoteIdents(cols), "=?,")+"=?",
+		strings.Join(clauses, " AND "),
+	)), nil
+}
+
+// UpdateExpr returns a SQL UPDATE statement for the given struct type which
+// sets the columns to the SQL expressions, f.e. "count = count + ?".
+//
+// The sets parameter maps database field names to the expressions which are
+// added to the statement as is and should not contain user input. The columns
+// are sorted by name, so the expressions placeholders arguments should be
+// ordered by the columns names. The function returns an error if any of the
+// columns is not a T struct database field. The wheres parameter works the
+// same way as in the Update function.
+func UpdateExpr[T any](sets map[string]string, wheres ...string) (string,
+	error) {
+	return UpdateExprClauses[T](sets, placeholderClauses(wheres)...)
+}
+
+// UpdateExprClauses returns a SQL UPDATE statement for the given struct type
+// which sets the columns to the SQL expressions.
+//
+// Unlike UpdateExpr it takes complete where clauses with placeholders, f.e.
+// "id IN (?,?)", and joins them with " AND " as is.
+func UpdateExprClauses[T any](sets map[string]string, clauses ...string) (
+	string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Check columns
+	if len(sets) == 0 {
+		return "", fmt.Errorf("columns should be set in the Update statement")
+	}
+	cols := slices.Sorted(maps.Keys(sets))
+	if _, err := columnsIndex(reflect.TypeOf(new(T)).Elem(), cols); err != nil {
+		return "", err
+	}
+
+	// Where clause should be set
+	if len(clauses) == 0 {
+		return "", fmt.Errorf(
+			"where clause should be set in the Update statement",
+		)
+	}
+
+	// Make set clauses
+	setClauses := make([]string, len(cols))
+	for i, col := range cols {
+		setClauses[i] = quoteIdent(col) + " = " + sets[col]
+	}
+
+	// Return UPDATE statement
+	return Rebind(fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
+		quoteIdent(name[T]()),
+		strings.Join(setClauses, ", "),
+		strings.Join(clauses, " AND "),
+	)), nil
+}
+
+// Select returns a SQL SELECT statement for the given struct type.
+//
+// The struct may be tagged with "db" tags to specify the database field names.
+// If the "db" tag is not specified, the field name will be used as the database
+// field name. The returned string is a SQL statement that can be executed
+// directly.
+//
+// The wheres parameter is an optional list of where clauses. If specified, the
+// where clauses will be joined with " and " and added to the SQL statement.
+func Select[T any](attr *SelectAttr) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Make select statement parts
+	body, tail, err := selectParts[T](attr)
+	if err != nil {
+		return "", err
+	}
+
+	// Return the complete SELECT statement
+	return Rebind(body + tail + ";"), nil
+}
+
+// Union returns a SQL SELECT statement which combines the rows selected with
+// the a and b attributes, f.e. "SELECT * from t where a = ? UNION ALL SELECT *
+// from t where b = ?;". The all parameter keeps duplicate rows (UNION ALL).
+//
+// Both selects use the same struct type, so they produce the same columns if
+// the a and b Columns are equal. The a attributes OrderBy and Paginator are
+// applied to the whole union, the b attributes must not have them. The
+// placeholders are numbered through the whole statement, so the statement
+// arguments are the a where arguments followed by the b ones.
+func Union[T any](a, b *SelectAttr, all bool) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Check b attributes
+	if b != nil && (len(b.OrderBy) > 0 || len(b.Lock) > 0 ||
+		(b.Paginator != nil && (b.Paginator.Limit > 0 ||
+			b.Paginator.Offset > 0))) {
+		return "", fmt.Errorf("union second select can't have order by, " +
+			"limit, offset or lock")
+	}
+	if a != nil && len(a.Lock) > 0 {
+		return "", fmt.Errorf("union select can't have lock")
+	}
+
+	// Make select statements parts
+	bodyA, tail, err := selectParts[T](a)
+	if err != nil {
+		return "", err
+	}
+	bodyB, _, err := selectParts[T](b)
+	if err != nil {
+		return "", err
+	}
+
+	// Return the complete SELECT statement
+	union := " UNION "
+	if all {
+		union = " UNION ALL "
+	}
+	return Rebind(bodyA + union + bodyB + tail + ";"), nil
+}
+
+// selectParts returns the SELECT statement body with columns, table and where
+// clause, and its tail with order by, limit and lock clauses made from the attr
+// struct.
+func selectParts[T any](attr *SelectAttr) (body, tail string, err error) {
+
+	// Make where clause and offset limit from attr struct
+	var where string
+	var limit string
+	var orderby string
+	var lock string
+	var columns = "*"
+	var joins string
+	if attr != nil {
+		// Selected columns qualified with table alias
+		if columns, err = selectColumns[T](attr); err != nil {
+			return
+		}
+
+		// Joined tables and their columns
+		if len(attr.Joins) > 0 {
+			if len(attr.Alias) == 0 {
+				err = fmt.Errorf("table alias should be set in the select " +
+					"with joins")
+				return
+			}
+			if len(attr.Columns) == 0 {
+				columns = joinColumns[T](attr.Alias, attr.Joins)
+			}
+			if joins, err = joinClauses(attr.Joins); err != nil {
+				return
+			}
+		}
+
+		// Distinct on columns
+		if len(attr.DistinctOn) > 0 {
+			if columns, err = distinctOn[T](attr, columns); err != nil {
+				return
+			}
+		}
+
+		// Total rows window column
+		if len(attr.TotalColumn) > 0 {
+			if !dialect.WindowFunctions {
+				err = fmt.Errorf("dialect %s does not support window functions",
+					dialect)
+				return
+			}
+			columns += ", count(*) OVER () AS " + quoteIdent(attr.TotalColumn)
+		}
+
+		// Where clauses
+		if len(attr.Wheres) > 0 {
+			where = strings.Join(attr.Wheres, " and ")
+		}
+		if len(where) > 0 {
+			where = fmt.Sprintf(" where %s", where)
+		}
+
+		// Group by
+		if len(attr.GroupBy) > 0 {
+			where += " GROUP BY " + strings.Join(quoteIdents(attr.GroupBy), ", ")
+		}
+
+		// Order by
+		if len(attr.OrderBy) > 0 {
+			orderby = fmt.Sprintf(" ORDER BY %s", attr.OrderBy)
+		}
+
+		// Offset and limit in current dialect form
+		if attr.Paginator != nil {
+			limit = limitClause(attr.Paginator.Offset, attr.Paginator.Limit)
+		}
+
+		// Row locking
+		if len(attr.Lock) > 0 && dialect.RowLocking {
+			lock = " " + attr.Lock
+		}
+	}
+
+	// Table name with optional alias
+	table := quoteIdent(attr.name(name[T]()))
+	if attr != nil && len(attr.Alias) > 0 {
+		table += " " + attr.Alias
+	}
+	table += joins
+
+	// Return the statement parts
+	body = fmt.Sprintf("SELECT %s from %s%s", columns, table, where)
+	tail = orderby + limit + lock
+	return
+}
+
+// expressionRe matches the selected column expression with alias, f.e.
+// "count(*) AS cnt".
+var expressionRe = regexp.MustCompile(`(?is)^(.+?)\s+as\s+([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// selectColumns returns the selected columns list made from the attr Columns
+// and Alias. The plain columns must be the T struct database fields, they are
+// quoted and qualified with the table alias. The expressions with alias, f.e.
+// "sum(amount) AS total", are added as is, and their aliases must be the T
+// struct database fields.
+func selectColumns[T any](attr *SelectAttr) (string, error) {
+
+	// All columns
+	if len(attr.Columns) == 0 {
+		if len(attr.Alias) > 0 {
+			return attr.Alias + ".*", nil
+		}
+		return "*", nil
+	}
+
+	// Split columns to plain columns and expressions. The selected columns are
+	// made in the new slice, so the attr Columns are never modified by alias
+	// qualifying and the same attr produces the same statement on each call
+	t := reflect.TypeOf(new(T)).Elem()
+	selected := make([]string, len(attr.Columns))
+	for i, column := range attr.Columns {
+		if m := expressionRe.FindStringSubmatch(column); m != nil {
+			if _, err := columnsIndex(t, []string{m[2]}); err != nil {
+				return "", err
+			}
+			selected[i] = m[1] + " AS " + quoteIdent(m[2])
+			continue
+		}
+		if _, err := columnsIndex(t, []string{column}); err != nil {
+			return "", err
+		}
+		selected[i] = quoteIdent(column)
+		if len(attr.Alias) > 0 {
+			selected[i] = attr.Alias + "." + selected[i]
+		}
+	}
+
+	return strings.Join(selected, ", "), nil
+}
+
+// distinctOn returns the selected columns with the DISTINCT ON clause made
+// from the attr DistinctOn columns. It returns an error if current dialect
+// does not support DISTINCT ON, the columns are not the T struct database
+// fields, or the attr OrderBy does not start with these columns.
+func distinctOn[T any](attr *SelectAttr, columns string) (string, error) {
+
+	// Check dialect support
+	if !dialect.DistinctOn {
+		return "", fmt.Errorf("dialect %s does not support distinct on", dialect)
+	}
+
+	// Check columns
+	t := reflect.TypeOf(new(T)).Elem()
+	if _, err := columnsIndex(t, attr.DistinctOn); err != nil {
+		return "", err
+	}
+
+	// Check that order by starts with distinct on columns
+	distinct := make(map[string]bool, len(attr.DistinctOn))
+	for _, column := range attr.DistinctOn {
+		distinct[strings.ToLower(column)] = true
+	}
+	if len(attr.OrderBy) > 0 {
+		orders := strings.Split(attr.OrderBy, ",")
+		for i := 0; i < len(attr.DistinctOn); i++ {
+			var column string
+			if i < len(orders) {
+				if fields := strings.Fields(orders[i]); len(fields) > 0 {
+					column = strings.ToLower(strings.Trim(fields[0], "\"`"))
+					column = column[strings.LastIndex(column, ".")+1:]
+				}
+			}
+			if !distinct[column] {
+				return "", fmt.Errorf("order by must start with distinct on "+
+					"columns: %s", strings.Join(attr.DistinctOn, ", "))
+			}
+		}
+	}
+
+	// Qualify distinct on columns with table alias
+	quoted := quoteIdents(attr.DistinctOn)
+	if len(attr.Alias) > 0 {
+		for i := range quoted {
+			quoted[i] = attr.Alias + "." + quoted[i]
+		}
+	}
+
+	return fmt.Sprintf("DISTINCT ON (%s) %s", strings.Join(quoted, ", "),
+		columns), nil
+}
+
+// Count returns a SQL COUNT statement for the given struct type.
+//
+// The struct may be tagged with "db" tags to specify the database field names.
+// If the "db" tag is not specified, the field name will be used as the database
+// field name. The returned string is a SQL statement that can be executed
+// directly.
+//
+// The wheres parameter is an optional list of where clauses. If specified, the
+// where clauses will be joined with " and " and added to the SQL statement.
+// The attr Alias is added after the table name, f.e. "from users t", so the
+// where clauses may be qualified with it the same way as in the Select
+// function.
+func Count[T any](attr *SelectAttr) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Table name with optional alias
+	table := quoteIdent(attr.name(name[T]()))
+	if attr != nil && len(attr.Alias) > 0 {
+		table += " " + attr.Alias
+	}
+
+	// Make where clause and offset limit from attr struct
+	var where string
+	if attr != nil {
+		// Where clauses
+		if len(attr.Wheres) > 0 {
+			where = strings.Join(attr.Wheres, " and ")
+		}
+		if len(where) > 0 {
+			where = fmt.Sprintf(" where %s", where)
+		}
+
+		// Group by
+		if len(attr.GroupBy) > 0 {
+			where += " GROUP BY " + strings.Join(quoteIdents(attr.GroupBy), ", ")
+		}
+	}
+
+	// Return the complete SELECT statement
+	return Rebind(fmt.Sprintf("SELECT count(*) from %s%s;", table,
+		where)), nil
+}
+
+// CountSelect returns a SQL SELECT statement which counts the rows returned by
+// the given select statement, f.e. the number of groups of the grouped select:
+// "SELECT count(*) FROM (SELECT ... GROUP BY name) t;".
+func CountSelect(selectStmt string) string {
+	selectStmt = strings.TrimRight(strings.TrimSpace(selectStmt), ";")
+	return "SELECT count(*) FROM (" + selectStmt + ") t;"
+}
+
+// GroupCount returns a SQL SELECT statement which counts rows of the given
+// struct type grouped by the given column, f.e.
+// "SELECT status, count(*) from t GROUP BY status;".
+//
+// The column must be one of the struct database fields. The attr parameter is
+// used the same way as in the Count function.
+func GroupCount[T any](column string, attr *SelectAttr) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Check group column
+	t := reflect.TypeOf(new(T)).Elem()
+	if _, err := columnsIndex(t, []string{column}); err != nil {
+		return "", err
+	}
+
+	// Table name with optional alias
+	table := quoteIdent(attr.name(name[T]()))
+	if attr != nil && len(attr.Alias) > 0 {
+		table += " " + attr.Alias
+	}
+
+	// Make where clause from attr struct
+	var where string
+	if attr != nil && len(attr.Wheres) > 0 {
+		where = fmt.Sprintf(" where %s", strings.Join(attr.Wheres, " and "))
+	}
+
+	// Return the complete SELECT statement
+	return Rebind(fmt.Sprintf("SELECT %s, count(*) from %s%s GROUP BY %s;",
+		quoteIdent(column), table, where, quoteIdent(column))), nil
+}
+
+// Delete returns a SQL DELETE statement for the given struct type.
+//
+// The struct may be tagged with "db" tags to specify the database field names.
+// If the "db" tag is not specified, the field name will be used as the database
+// field name. The returned string is a SQL statement that can be executed
+// directly.
+//
+// The wheres parameter is an optional list of where fields with condition
+// operator, f.e. "id=". The "?" placeholder is appended to each of them, and
+// the resulting clauses are joined with " AND " and added to the SQL statement.
+func Delete[T any](wheres ...string) (string, error) {
+	return DeleteName[T](name[T](), wheres...)
+}
+
+// DeleteClauses returns a SQL DELETE statement for the given struct type from
+// the table with the given name.
+//
+// Unlike DeleteName it takes complete where clauses with placeholders, f.e.
+// "id IN (?,?)", and joins them with " AND " as is.
+func DeleteClauses[T any](table string, clauses ...string) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Join where clauses with " AND "
+	var where string
+	if len(clauses) > 0 {
+		where = fmt.Sprintf(" where %s", strings.Join(clauses, " AND "))
+	}
+
+	// Return the complete DELETE statement
+	return Rebind(fmt.Sprintf("DELETE from %s%s;",
+		quoteIdent(table), where)), nil
+}
+
+// DeleteName returns a SQL DELETE statement for the given struct type from the
+// table with the given name instead of the struct name based table name.
+func DeleteName[T any](table string, wheres ...string) (string, error) {
+
+	// Check if type is struct
+	if err := checkType[T](); err != nil {
+		return "", err
+	}
+
+	// Add placeholder to each where clause and join them with " AND "
+	var where string
+	if len(wheres) > 0 {
+		where = " where " + wherePlaceholders(wheres)
+	}
+
+	// Return the complete DELETE statement
+	return Rebind(fmt.Sprintf("DELETE from %s%s;",
+		quoteIdent(table), where)), nil
+}
+
+// operatorRe matches the Where condition field with the trailing condition
+// operator, f.e. "o.value>" or "name LIKE".
+var operatorRe = regexp.MustCompile(
+	`(?is)^(.*?)\s*(<>|!=|>=|<=|=|>|<|\bnot\s+like|\blike|\bnot\s+in|\bin)\s*$`)
+
+// WhereField returns the Where condition field with normalized operator
+// spacing and trailing space before the placeholder, f.e. "o.value>" and
+// "o.value >" are "o.value > ". The fields without trailing operator get the
+// trailing space only. It is used to add the placeholder to the where
+// clauses, f.e. in the Update and Delete functions.
+func WhereField(field string) string {
+	if m := operatorRe.FindStringSubmatch(field); m != nil && m[1] != "" {
+		return m[1] + " " + strings.Join(strings.Fields(m[2]), " ") + " "
+	}
+	return strings.TrimRight(field, " ") + " "
+}
+
+// wherePlaceholders returns the where clauses with placeholders joined with
+// " AND ", f.e. "id = ? AND name LIKE ?" for "id=" and "name LIKE" wheres.
+func wherePlaceholders(wheres []string) string {
+	return strings.Join(placeholderClauses(wheres), " AND ")
+}
+
+// placeholderClauses returns the where clauses with placeholders, f.e.
+// "id = ?" and "name LIKE ?" for "id=" and "name LIKE" wheres.
+func placeholderClauses(wheres []string) []string {
+	clauses := make([]string, 0, len(wheres))
+	for _, w := range wheres {
+		clauses = append(clauses, WhereField(w)+"?")
+	}
+	return clauses
+}
+
+// Args returns the arguments array for the given struct type. The given struct
+// may be a pointer to struct or struct.
+//
+// It loops through the given struct fields and get field values.
+// Supported types are string, float64, time.Time, int64 and bool.
+// If unsupported type is found, it returns the *UnsupportedTypeError error.
+func Args(row any) ([]interface{}, error) {
+
+	// Get row value and type from the given row
+	rowVal := reflect.ValueOf(row)
+	rowType := rowVal.Type()
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+		rowType = rowType.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return nil, ErrTypeIsNotStruct
+	}
+
+	// Make arguments array for the given struct database fields
+	index := fieldsIndex(rowType)
+	args := make([]interface{}, 0, len(index))
+	for _, i := range index {
+		arg, err := fieldValue(rowVal.Field(i), rowType.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, &arg)
+	}
+
+	return args, nil
+}
+
+// InsertArgs returns the arguments array of the given struct row for the
+// INSERT statement created by the Insert function for this row. The given
+// struct may be a pointer to struct or struct.
+//
+// The zero value autoincrement fields are skipped the same way as in the Insert
+// function.
+func InsertArgs(row any) ([]any, error) {
+
+	// Get row value and type from the given row
+	rowVal := reflect.ValueOf(row)
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return nil, ErrTypeIsNotStruct
+	}
+
+	// Make arguments array for the insert fields
+	_, idx := insertFields(rowVal.Type(), rowVal)
+	args := make([]any, 0, len(idx))
+	for _, i := range idx {
+		arg, err := fieldValue(rowVal.Field(i), rowVal.Type().Field(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// UpdateArgs returns the arguments array of the given struct row for the
+// UPDATE statement created by the Update function. The given struct may be a
+// pointer to struct or struct.
+func UpdateArgs(row any) ([]any, error) {
+
+	// Get row value and type from the given row
+	rowVal := reflect.ValueOf(row)
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return nil, ErrTypeIsNotStruct
+	}
+
+	// Make arguments array for the update fields
+	_, idx := updateFields(rowVal.Type())
+	args := make([]any, 0, len(idx))
+	for _, i := range idx {
+		arg, err := fieldValue(rowVal.Field(i), rowVal.Type().Field(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// ColumnValue returns the value of the given struct row field mapped to the
+// column database field name. The given struct may be a pointer to struct or
+// struct.
+func ColumnValue(row any, column string) (any, error) {
+
+	// Get row value from the given row
+	rowVal := reflect.ValueOf(row)
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return nil, ErrTypeIsNotStruct
+	}
+
+	// Find the field by database field name
+	for i := 0; i < rowVal.NumField(); i++ {
+		fieldName, ok := getFieldName(rowVal.Type().Field(i))
+		if ok && strings.EqualFold(fieldName, column) {
+			return rowVal.Field(i).Interface(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("column %s not found", column)
+}
+
+// SetColumnValue sets the given pointer to struct row field mapped to the
+// column database field name from the value. The value is set the same way as
+// the scanned values in the ArgsAppay function.
+func SetColumnValue(row any, column string, value any) error {
+
+	// Get row value from the given pointer to row. The row may be a pointer to
+	// pointer to struct, f.e. when the *T rows are inserted
+	rowVal := reflect.ValueOf(row)
+	if rowVal.Kind() != reflect.Ptr {
+		return ErrTypeIsNotStruct
+	}
+	for rowVal.Kind() == reflect.Ptr {
+		if rowVal.IsNil() {
+			return ErrTypeIsNotStruct
+		}
+		rowVal = rowVal.Elem()
+	}
+	if rowVal.Kind() != reflect.Struct {
+		return ErrTypeIsNotStruct
+	}
+
+	// Find the field by database field name
+	for i := 0; i < rowVal.NumField(); i++ {
+		field := rowVal.Type().Field(i)
+		fieldName, ok := getFieldName(field)
+		if ok && strings.EqualFold(fieldName, column) {
+			return setField(rowVal.Field(i), field, value)
+		}
+	}
+
+	return fmt.Errorf("column %s not found", column)
+}
+
+// AutoIncrementColumn returns the database field name of the T struct integer
+// autoincrement field. It returns false if the struct has no such field or has
+// more than one autoincrement field.
+func AutoIncrementColumn[T any]() (column string, ok bool) {
+
+	// Check if type is struct
+	if checkType[T]() != nil {
+		return
+	}
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Find integer autoincrement field
+	for _, i := range fieldsIndex(t) {
+		field := t.Field(i)
+		if !isAutoIncrement(field) {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+			reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+			reflect.Uint32, reflect.Uint64:
+		default:
+			return "", false
+		}
+		if ok {
+			return "", false
+		}
+		column, _ = getFieldName(field)
+		ok = true
+	}
+
+	return
+}
+
+// Returning returns the given INSERT statement with the RETURNING clause of the
+// given columns. Use it if current dialect SupportsReturning.
+func Returning(stmt string, columns ...string) string {
+	return strings.TrimSuffix(stmt, ";") + " RETURNING " +
+		strings.Join(quoteIdents(columns), ", ") + ";"
+}
+
+// ColumnsArgs returns the arguments array of the given struct row fields
+// mapped to the cols database field names, in the cols order. The given
+// struct may be a pointer to struct or struct. It returns an error if any of
+// the cols is not the struct database field.
+func ColumnsArgs(row any, cols []string) ([]any, error) {
+
+	// Get row value from the given row
+	rowVal := reflect.ValueOf(row)
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return nil, ErrTypeIsNotStruct
+	}
+
+	// Get fields indexes
+	idx, err := columnsIndex(rowVal.Type(), cols)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make arguments array for the columns fields
+	args := make([]any, 0, len(idx))
+	for _, i := range idx {
+		arg, err := fieldValue(rowVal.Field(i), rowVal.Type().Field(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// AutoTime sets automatic timestamps fields of the given pointer to struct row.
+//
+// The timestamps fields are time.Time fields tagged with db_auto tag:
+//   - db_auto:"created" - the field is set to current time on insert if it is
+//     zero, and is never updated;
+//   - db_auto:"updated" - the field is set to current time on update.
+//
+// The insert parameter defines if the row is going to be inserted or updated.
+func AutoTime(row any, insert bool) error {
+
+	// Get row value from the given pointer to row
+	rowVal := reflect.ValueOf(row)
+	for rowVal.Kind() == reflect.Ptr {
+		if rowVal.IsNil() {
+			return ErrTypeIsNotStruct
+		}
+		rowVal = rowVal.Elem()
+	}
+
+	// Check if row is struct
+	if rowVal.Kind() != reflect.Struct {
+		return ErrTypeIsNotStruct
+	}
+
+	// Loop through the struct fields and set timestamps
+	now := reflect.ValueOf(time.Now())
+	rowType := rowVal.Type()
+	for i := 0; i < rowVal.NumField(); i++ {
+		f := rowVal.Field(i)
+		if f.Type() != now.Type() {
+			continue
+		}
+
+		switch rowType.Field(i).Tag.Get("db_auto") {
+		case "created":
+			if insert && f.IsZero() {
+				f.Set(now)
+			}
+		case "updated":
+			if !insert {
+				f.Set(now)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ArgsAppay sets fields values of the given pointer to struct row from the args
+// array.
+//
+// It loops through the given struct database fields and sets field values from
+// the corresponding arguments in the given args array. The args array must be
+// made by the Args function for the same struct type: the fields skipped by
+// Args (tagged with db:"-" and blank "_" fields) have no arguments.
+// Supported types are string, float64, time.Time, int64 and bool.
+// If unsupported type is found, it returns the *UnsupportedTypeError error.
+func ArgsAppay(row any, args []interface{}) (err error) {
+
+	rowVal := reflect.ValueOf(row).Elem()
+	rowType := reflect.TypeOf(row).Elem()
+	if rowVal.Kind() == reflect.Ptr {
+		rowVal = rowVal.Elem()
+		rowType = rowType.Elem()
+	}
+
+	// Check if the given value is a struct
+	if rowVal.Kind() != reflect.Struct {
+		return ErrTypeIsNotStruct
+	}
+
+	// Check that the arguments match the struct database fields
+	index := fieldsIndex(rowType)
+	if len(args) != len(index) {
+		return fmt.Errorf("struct %s has %d database fields but got %d "+
+			"arguments", rowType, len(index), len(args))
 	}
 
-	// Add the where statement to the SQL query
-	if len(where) > 0 {
-		where = fmt.Sprintf(" where %s?", where)
+	// Loop through the struct database fields in the Args function order
+	for n, i := range index {
+
+		// Get the current field and its value
+		f := rowVal.Field(i)
+		arg := reflect.ValueOf(args[n]).Elem().Interface()
+
+		// Set the field value based on the type of the argument
+		if err = setField(f, rowType.Field(i), arg); err != nil {
+			return
+		}
 	}
 
-	// Return the complete DELETE statement
-	return fmt.Sprintf("DELETE from %s%s;", name[T](), where), nil
+	return
 }
 
-// Args returns the arguments array for the given struct type. The given struct
-// may be a pointer to struct or struct.
+// IndexColumns returns the result set columns names made from the T struct
+// fields db_index tags for the result set with n columns. The db_index tag is
+// the zero based result set column position bound to the field, f.e.
+// db_index:"2", regardless of the field declaration order and the column
+// name. The returned columns contain the fields database names at their
+// positions and empty names at the positions without fields, so the row may be
+// scanned with the ArgsAppayNamed function.
 //
-// It loops through the given struct fields and get field values.
-// Supported types are string, float64, time.Time, int64 and bool.
-// If unsupported type is found, it returns an error.
-func Args(row any) ([]interface{}, error) {
+// It returns nil columns if the struct has no db_index tags. It returns an
+// error if the db_index is invalid, is duplicated or is out of the result set
+// columns.
+func IndexColumns[T any](n int) (columns []string, err error) {
 
-	// Get row value and type from the given row
-	rowVal := reflect.ValueOf(row)
-	rowType := rowVal.Type()
-	if rowVal.Kind() == reflect.Ptr {
-		rowVal = rowVal.Elem()
-		rowType = rowType.Elem()
+	// Check if type is struct
+	if err = checkType[T](); err != nil {
+		return
 	}
-
-	// Check if row is struct
-	if rowVal.Kind() != reflect.Struct {
-		return nil, ErrTypeIsNotStruct
+	t := reflect.TypeOf(new(T)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
 
-	// Make arguments array for the given struct
-	args := make([]interface{}, 0, rowVal.NumField())
-	for i := 0; i < rowVal.NumField(); i++ {
-
-		// Skip not db fields tagged with "-"
-		if rowType.Field(i).Tag.Get("db") == "-" {
+	// Set fields names at their db_index positions
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("db_index")
+		if !ok {
 			continue
 		}
-
-		arg := rowVal.Field(i).Interface()
-		args = append(args, &arg)
+		fieldName, ok := getFieldName(field)
+		if !ok {
+			continue
+		}
+		pos, e := strconv.Atoi(tag)
+		switch {
+		case e != nil || pos < 0:
+			return nil, fmt.Errorf("invalid db_index %q of field %s", tag,
+				field.Name)
+		case pos >= n:
+			return nil, fmt.Errorf("db_index %d of field %s is out of %d "+
+				"result set columns", pos, field.Name, n)
+		}
+		if columns == nil {
+			columns = make([]string, n)
+		}
+		if columns[pos] != "" {
+			return nil, fmt.Errorf("duplicate db_index %d of field %s", pos,
+				field.Name)
+		}
+		columns[pos] = fieldName
 	}
 
-	return args, nil
+	return
 }
 
-// ArgsAppay sets fields values of the given pointer to struct row from the args
-// array.
+// ArgsAppayNamed sets fields values of the given pointer to struct row from the
+// args array scanned from the result set with the given columns.
 //
-// It loops through the given struct fields and sets field values from the
-// corresponding arguments in the given args array.
-// Supported types are string, float64, time.Time, int64 and bool.
-// If unsupported type is found, it returns an error.
-func ArgsAppay(row any, args []interface{}) (err error) {
+// Unlike ArgsAppay it matches each column to the struct field by its database
+// field name (the db tag or lower case field name) instead of by position.
+// Columns without matching struct field are skipped, and struct fields without
+// matching column are left unchanged.
+//
+// The struct fields may be tagged with table qualified names, f.e. db:"t.id"
+// and db:"o.id", to scan join results with the same column names in different
+// tables. Such fields match the qualified column names (when the query uses
+// aliases like `t.id AS "t.id"`) or the not qualified column names in the
+// order of the fields declaration.
+//
+// The fields of the embedded structs and pointers to structs are matched too,
+// f.e. to scan join results into struct embedding both tables structs. The
+// embedded struct pointer is allocated only if any of its columns is not NULL,
+// so it stays nil for the LEFT JOIN rows without match.
+func ArgsAppayNamed(row any, columns []string, args []any) (err error) {
 
 	rowVal := reflect.ValueOf(row).Elem()
 	rowType := reflect.TypeOf(row).Elem()
@@ -331,45 +1819,291 @@ func ArgsAppay(row any, args []interface{}) (err error) {
 		return ErrTypeIsNotStruct
 	}
 
-	// Loop through the struct fields
-	for i := 0; i < rowVal.NumField(); i++ {
+	// Make database field name to struct fields paths map, and not qualified
+	// column name to qualified struct fields paths map
+	index := make(map[string][][]int, rowVal.NumField())
+	qualified := make(map[string][][]int)
+	for _, path := range namedFields(rowType, nil) {
+		fieldName, _ := getFieldName(rowType.FieldByIndex(path))
+		fieldName = strings.ToLower(fieldName)
+		index[fieldName] = append(index[fieldName], path)
+		if j := strings.LastIndex(fieldName, "."); j >= 0 {
+			column := fieldName[j+1:]
+			qualified[column] = append(qualified[column], path)
+		}
+	}
 
-		// Skip not db fields tagged with "-"
-		if rowType.Field(i).Tag.Get("db") == "-" {
+	// Loop through the result set columns
+	for i, column := range columns {
+
+		// Find struct field by column name, or get next qualified struct field
+		// for not qualified column name. The same column names of the embedded
+		// structs fields are matched in the order of the fields declaration
+		column = strings.ToLower(column)
+		var path []int
+		switch {
+		case len(index[column]) > 0:
+			path = index[column][0]
+			if len(index[column]) > 1 {
+				index[column] = index[column][1:]
+			}
+		case len(qualified[column]) > 0:
+			path = qualified[column][0]
+			qualified[column] = qualified[column][1:]
+		default:
+			// Skip columns without struct field
 			continue
 		}
 
-		// Get the current field and its value
-		f := rowVal.Field(i)
+		// Get the field, the embedded struct pointers are allocated for not
+		// NULL values only
 		arg := reflect.ValueOf(args[i]).Elem().Interface()
+		f, ok := fieldByPath(rowVal, path, arg != nil)
+		if !ok {
+			continue
+		}
 
 		// Set the field value based on the type of the argument
-		switch v := arg.(type) {
-		case string:
+		if err = setField(f, rowType.FieldByIndex(path), arg); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// namedFields returns the struct type t database fields paths (indexes
+// sequences) for the ArgsAppayNamed function. The fields of the embedded
+// structs and pointers to structs without db tag are included in place of the
+// embedded field.
+func namedFields(t reflect.Type, parent []int) (paths [][]int) {
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+		if _, ok := getFieldName(field); !ok {
+			continue
+		}
+		path := append(append([]int{}, parent...), i)
+
+		// Embedded struct fields
+		if ft := field.Type; field.Anonymous && field.Tag.Get("db") == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != reflect.TypeFor[time.Time]() {
+				paths = append(paths, namedFields(ft, path)...)
+				continue
+			}
+		}
+
+		paths = append(paths, path)
+	}
+	return
+}
+
+// fieldByPath returns the struct value v field by the path made by the
+// namedFields function. The nil embedded struct pointers are allocated if the
+// alloc parameter is true, otherwise the function returns false for the field
+// inside nil embedded struct pointer.
+func fieldByPath(v reflect.Value, path []int, alloc bool) (reflect.Value,
+	bool) {
+	for n, i := range path {
+		if n > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return v, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// setField sets the struct field f value from the scanned argument arg.
+//
+// The field parameter is the struct field description used to get field tags
+// and field name for the error message.
+// Supported types are string, float64, time.Time, int64 and bool. The NULL
+// (nil) argument sets the field zero value, nil for pointer fields.
+// If unsupported type is found, it returns the *UnsupportedTypeError error.
+func setField(f reflect.Value, field reflect.StructField, arg any) (err error) {
+	name := field.Name
+
+	// Set zero value for NULL, f.e. for the LEFT JOIN right table fields
+	if arg == nil {
+		f.SetZero()
+		return
+	}
+
+	// Set array field
+	if isArray(field) {
+		return decodeArray(f, name, arg)
+	}
+
+	// Set registered custom type field
+	if ok, err := decodeType(f, name, arg); ok {
+		return err
+	}
+
+	// Set pointer field to the new value
+	if f.Kind() == reflect.Ptr {
+		v := reflect.New(f.Type().Elem())
+		if err = setField(v.Elem(), field, arg); err == nil {
+			f.Set(v)
+		}
+		return
+	}
+
+	// Set bool field from any of the bool column representations
+	if f.Kind() == reflect.Bool {
+		return setBool(f, name, arg)
+	}
+
+	// Set time field in the time location
+	if f.Type() == reflect.TypeFor[time.Time]() {
+		return setTime(f, name, arg)
+	}
+
+	// Set gob encoded complex field
+	if isGob(field, f.Type()) {
+		return decodeGob(f, name, arg)
+	}
+
+	// Set the field value based on the type of the argument
+	switch v := arg.(type) {
+	case string:
+		// Set the field value based on the type of the field
+		switch {
+		case f.Kind() == reflect.String:
 			f.SetString(v)
-		case float64:
+		case isBytes(f.Type()):
+			f.SetBytes([]byte(v))
+		default:
+			// Numbers returned as text
+			err = setNumber(f, name, v)
+		}
+	case float64:
+		// Set the field value based on the type of the field
+		switch f.Kind() {
+		case reflect.String:
+			// Decimal columns returned as float, f.e. by SQLite
+			f.SetString(strconv.FormatFloat(v, 'f', -1, 64))
+		case reflect.Float32, reflect.Float64:
 			f.SetFloat(v)
-		case time.Time:
-			f.Set(reflect.ValueOf(v))
-		case int64:
-			// Set the field value based on the type of the field
-			switch f.Kind() {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				f.SetInt(v)
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				f.SetUint(uint64(v))
-			case reflect.Bool:
-				f.SetBool(v == 1)
-			}
 		default:
-			// Return an error if unsupported type is found
-			err = fmt.Errorf(
-				"unknown value type for field %s: %T",
-				rowVal.Type().Field(i).Name, v,
-			)
+			err = &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+		}
+	case time.Time:
+		f.Set(reflect.ValueOf(v))
+	case []byte:
+		// Set the field value based on the type of the field
+		switch {
+		case f.Kind() == reflect.String:
+			f.SetString(string(v))
+		case isBytes(f.Type()):
+			f.SetBytes(append([]byte(nil), v...))
+		case isNumber(f.Kind()):
+			// Numbers returned as text, f.e. by MySQL text protocol
+			err = setNumber(f, name, string(v))
+		default:
+			err = &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+		}
+	case int64:
+		// Set the field value based on the type of the field
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f.SetInt(v)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f.SetUint(uint64(v))
+		case reflect.Float32, reflect.Float64:
+			f.SetFloat(float64(v))
+		case reflect.String:
+			// Decimal columns without fraction returned as integer
+			f.SetString(strconv.FormatInt(v, 10))
+		default:
+			err = &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+		}
+	default:
+		// Return an error if unsupported type is found
+		err = &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+	}
+
+	return
+}
+
+// isNumber returns true if the kind is integer, unsigned integer or float.
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// setBool sets the bool struct field f value from the database bool column
+// value.
+//
+// The bool columns are returned differently by the drivers: as bool, as int64
+// 0/1 integers, as []byte with one raw bit byte (MySQL bit(1) columns), or as
+// text "0"/"1" or "true"/"false". The name parameter is the struct field name
+// used in the error message.
+func setBool(f reflect.Value, name string, arg any) (err error) {
+	var s string
+	switch v := arg.(type) {
+	case bool:
+		f.SetBool(v)
+		return
+	case int64:
+		f.SetBool(v != 0)
+		return
+	case []byte:
+		// Raw bit value
+		if len(v) == 1 && v[0] <= 1 {
+			f.SetBool(v[0] == 1)
+			return
 		}
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+	}
+
+	// Parse text value
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("can't parse field %s value %q: %w", name, s, err)
 	}
+	f.SetBool(b)
+
+	return
+}
 
+// setNumber sets the numeric struct field f value parsed from the string s.
+//
+// The name parameter is the struct field name used in the error message. It
+// returns an error if the field is not numeric or the string can't be parsed.
+func setNumber(f reflect.Value, name, s string) (err error) {
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, f.Type().Bits()); err == nil {
+			f.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, f.Type().Bits()); err == nil {
+			f.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		if fl, err = strconv.ParseFloat(s, f.Type().Bits()); err == nil {
+			f.SetFloat(fl)
+		}
+	default:
+		return &UnsupportedTypeError{Field: name, Type: reflect.TypeFor[[]byte]()}
+	}
+	if err != nil {
+		err = fmt.Errorf("can't parse field %s value %q: %w", name, s, err)
+	}
 	return
 }
 
@@ -394,6 +2128,13 @@ func checkType[T any]() (err error) {
 	return
 }
 
+// Name returns table name from struct name.
+//
+// The table name is the lower case version of the T struct name.
+func Name[T any]() string {
+	return name[T]()
+}
+
 // name returns table name from struct name.
 //
 // It takes type T as an argument and returns the table name as a string.
@@ -427,7 +2168,7 @@ func fields[T any]() (fields []string) {
 	}
 
 	// Loop through the struct fields
-	for i := 0; i < t.NumField(); i++ {
+	for _, i := range fieldOrder(t) {
 		// Get the field
 		field := t.Field(i)
 
@@ -440,6 +2181,282 @@ func fields[T any]() (fields []string) {
 	return
 }
 
+// insertFields returns a list of struct field names and field indexes used in
+// the INSERT statement.
+//
+// It takes the struct type t and optional struct value row. The read only
+// fields are skipped. The autoincrement and omitempty fields are skipped if the
+// row is not valid or the row field is zero.
+func insertFields(t reflect.Type, row reflect.Value) (fields []string,
+	idx []int) {
+
+	// If the type is a pointer, get the type of the struct it points to
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if row.Kind() == reflect.Ptr {
+		if row.IsNil() {
+			row = reflect.Value{}
+		} else {
+			row = row.Elem()
+		}
+	}
+
+	// Loop through the struct fields
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+
+		// Skip not db fields
+		fieldName, ok := getFieldName(field)
+		if !ok {
+			continue
+		}
+
+		// Skip read only fields
+		if isReadOnly(field) {
+			continue
+		}
+
+		// Skip autoincrement and omitempty fields which are not set in the row
+		if (isAutoIncrement(field) || hasOption(field, "omitempty")) &&
+			(!row.IsValid() || row.Field(i).IsZero()) {
+			continue
+		}
+
+		fields = append(fields, fieldName)
+		idx = append(idx, i)
+	}
+	return
+}
+
+// updateFields returns a list of struct field names and field indexes used in
+// the UPDATE statement.
+//
+// It takes the struct type t. The read only fields and fields tagged with
+// db_auto:"created" are skipped.
+func updateFields(t reflect.Type) (fields []string, idx []int) {
+
+	// If the type is a pointer, get the type of the struct it points to
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Loop through the struct fields
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+
+		// Skip not db fields and created timestamps
+		fieldName, ok := getFieldName(field)
+		if !ok || field.Tag.Get("db_auto") == "created" || isReadOnly(field) {
+			continue
+		}
+
+		fields = append(fields, fieldName)
+		idx = append(idx, i)
+	}
+	return
+}
+
+// fieldValue returns the struct field value used as statement argument.
+//
+// Named byte slice types like json.RawMessage are converted to []byte,
+// registered custom types are encoded with their encode functions, array
+// fields are encoded with the registered array codec, and time values are
+// converted to the time location set by SetTimeLocation. The zero values of
+// the fields tagged with db_null:"zero" are returned as nil (NULL).
+func fieldValue(f reflect.Value, field reflect.StructField) (any, error) {
+	if isNullZero(field) && f.IsZero() {
+		return nil, nil
+	}
+	switch f.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer,
+		reflect.Complex64, reflect.Complex128:
+		return nil, &UnsupportedTypeError{Field: field.Name, Type: field.Type}
+	}
+	if isArray(field) {
+		return encodeArray(f)
+	}
+	if v, ok, err := encodeType(f); ok {
+		return v, err
+	}
+	if f.Kind() == reflect.Slice && isBytes(f.Type()) {
+		return f.Bytes(), nil
+	}
+	if isGob(field, f.Type()) {
+		return encodeGob(f, field.Name)
+	}
+	if f.Kind() == reflect.Ptr && isGob(field, f.Type().Elem()) {
+		if f.IsNil() {
+			return nil, nil
+		}
+		return encodeGob(f.Elem(), field.Name)
+	}
+	if !gobFallback && isComplex(field, f.Type()) {
+		return nil, &UnsupportedTypeError{Field: field.Name, Type: field.Type}
+	}
+	return timeValue(f.Interface()), nil
+}
+
+// isBytes returns true if the type t is a byte slice or a named type based on
+// byte slice.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// columnsIndex returns the struct type t field indexes mapped to the cols
+// database field names. It returns an error if any of the cols is not the
+// struct database field.
+func columnsIndex(t reflect.Type, cols []string) (idx []int, err error) {
+
+	// If the type is a pointer, get the type of the struct it points to
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Make database field name to struct field index map
+	index := make(map[string]int, t.NumField())
+	for _, i := range fieldOrder(t) {
+		if fieldName, ok := getFieldName(t.Field(i)); ok {
+			index[strings.ToLower(fieldName)] = i
+		}
+	}
+
+	// Get columns fields indexes
+	for _, col := range cols {
+		i, ok := index[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("column %s not found in struct %s", col,
+				t.Name())
+		}
+		idx = append(idx, i)
+	}
+
+	return
+}
+
+// isReadOnly returns true if the field is tagged with db_ro:"true", with the
+// db tag readonly option or with db_key containing "readonly". The read only
+// fields are computed by database (f.e. generated columns) and are selected
+// but never inserted or updated.
+func isReadOnly(field reflect.StructField) bool {
+	return field.Tag.Get("db_ro") == "true" || hasOption(field, "readonly") ||
+		strings.Contains(strings.ToLower(field.Tag.Get("db_key")), "readonly")
+}
+
+// hasOption returns true if the db tag of the field has the given option after
+// the field name, f.e. db:"name,omitempty". The supported options are:
+//
+//	omitempty	skip zero value on insert, so the database default is used
+//	readonly	select but never insert or update, the same as db_ro:"true"
+func hasOption(field reflect.StructField, option string) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("db"), ",")
+	for _, o := range strings.Split(options, ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldKey returns the db_key tag value of the field without the "readonly"
+// key which is not SQL.
+func fieldKey(field reflect.StructField) string {
+	key := field.Tag.Get("db_key")
+	if i := strings.Index(strings.ToLower(key), "readonly"); i >= 0 {
+		key = strings.Join(strings.Fields(key[:i]+key[i+len("readonly"):]), " ")
+	}
+	return key
+}
+
+// isNullZero returns true if the field is tagged with db_null:"zero", which
+// means the field zero value is stored as NULL. NULL is read as zero value for
+// any field.
+func isNullZero(field reflect.StructField) bool {
+	return field.Tag.Get("db_null") == "zero"
+}
+
+// isAutoIncrement returns true if the field is tagged with db_key containing
+// "autoincrement" or "auto_increment", or with db_type "serial" or
+// "bigserial".
+func isAutoIncrement(field reflect.StructField) bool {
+	switch strings.ToLower(field.Tag.Get("db_type")) {
+	case "serial", "bigserial":
+		return true
+	}
+	key := strings.ToLower(field.Tag.Get("db_key"))
+	return strings.Contains(key, "autoincrement") ||
+		strings.Contains(key, "auto_increment")
+}
+
+// fieldsIndexCache is the struct type to its database fields indexes cache.
+var fieldsIndexCache sync.Map
+
+// fieldsIndex returns indexes of the struct type t database fields in the
+// declaration order. The Args and ArgsAppay functions use these indexes to
+// make and apply arguments, so the n-th argument always belongs to the n-th
+// database field. The indexes are calculated once per type and cached.
+func fieldsIndex(t reflect.Type) []int {
+	if index, ok := fieldsIndexCache.Load(t); ok {
+		return index.([]int)
+	}
+
+	// Get database fields indexes
+	index := make([]int, 0, t.NumField())
+	for _, i := range fieldOrder(t) {
+		if _, ok := getFieldName(t.Field(i)); ok {
+			index = append(index, i)
+		}
+	}
+
+	// Clip the cached slice, so appending to it never writes to the cache
+	index = slices.Clip(index)
+	fieldsIndexCache.Store(t, index)
+	return index
+}
+
+// fieldOrderCache caches the struct types fields orders by struct type.
+var fieldOrderCache sync.Map
+
+// fieldOrder returns the struct type t fields indexes in the database columns
+// order. The fields tagged with db_order, f.e. db_order:"1", go first sorted by
+// the tag value, and the fields without db_order (or with not integer value)
+// follow in the declaration order. So the Go fields may be reordered without
+// changing the table columns, insert columns and arguments order.
+func fieldOrder(t reflect.Type) []int {
+	if order, ok := fieldOrderCache.Load(t); ok {
+		return order.([]int)
+	}
+
+	// Get db_order tags values
+	order := make([]int, t.NumField())
+	positions := make(map[int]int)
+	for i := range order {
+		order[i] = i
+		if pos, err := strconv.Atoi(t.Field(i).Tag.Get("db_order")); err == nil {
+			positions[i] = pos
+		}
+	}
+
+	// Sort ordered fields first keeping declaration order of equal positions
+	// and not ordered fields
+	slices.SortStableFunc(order, func(a, b int) int {
+		posA, okA := positions[a]
+		posB, okB := positions[b]
+		switch {
+		case okA && okB:
+			return cmp.Compare(posA, posB)
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return 0
+	})
+
+	fieldOrderCache.Store(t, order)
+	return order
+}
+
 // getFieldName returns a SQL fields name using db tag.
 //
 // It takes a reflect.StructField as an argument and returns a string
@@ -447,14 +2464,19 @@ func fields[T any]() (fields []string) {
 // indicates if the field name was set successfully.
 //
 // The function first checks if the field has the db tag set.
-// If the tag is set, the function returns the value of the tag as the
-// field name.
+// If the tag is set, the function returns the first comma separated segment
+// of the tag as the field name, the rest segments are the options, f.e.
+// db:"name,omitempty". The empty name segment means the default name.
 // If the tag is not set, the function returns the name of the field
 // as the field name by calling strings.ToLower on the field name.
-// If the tag is set to "-", the function returns an empty string and
-// false indicating that the field name was not set successfully.
+// If the tag is set to "-" or the field is blank "_" field, the function
+// returns an empty string and false indicating that the field name was not set
+// successfully.
 func getFieldName(field reflect.StructField) (fieldName string, ok bool) {
-	fieldName = field.Tag.Get("db")
+	if field.Name == "_" {
+		return
+	}
+	fieldName, _, _ = strings.Cut(field.Tag.Get("db"), ",")
 	switch fieldName {
 	case "":
 		fieldName = strings.ToLower(field.Name)
@@ -477,11 +2499,34 @@ func getFieldName(field reflect.StructField) (fieldName string, ok bool) {
 //	float32, float64: "double"
 //	bool: "bit"
 //	string: "text"
+//	[]byte: "blob"
+//	time.Time: "timestamp"
+//	registered custom types: "text"
+//	struct, map, slice and array gob encoded types: "blob"
+//
+// The slice fields tagged with db_type:"array" get the slice element type with
+// "[]" suffix, f.e. "text[]" for []string.
 //
 // If the type is not supported, the function returns an error.
 func getFieldType(field reflect.StructField) (fieldType string, err error) {
 
 	fieldType = field.Tag.Get("db_type")
+	if isArray(field) {
+		// Array column type is the slice element type with "[]" suffix
+		elemType, err := getFieldType(reflect.StructField{
+			Name: field.Name, Type: field.Type.Elem(),
+		})
+		return elemType + "[]", err
+	}
+	if fieldType == "" && isRegisteredType(field.Type) {
+		fieldType = "text"
+	}
+	if fieldType == "" && isGob(field, field.Type) {
+		fieldType = "blob"
+	}
+	if fieldType == "" && field.Type == reflect.TypeFor[time.Time]() {
+		fieldType = "timestamp"
+	}
 	if fieldType == "" {
 		switch field.Type.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -497,9 +2542,21 @@ func getFieldType(field reflect.StructField) (fieldType string, err error) {
 			fieldType = "bit"
 		case reflect.String:
 			fieldType = "text"
+		case reflect.Ptr:
+			// Pointer fields are nullable columns of the pointed type
+			return getFieldType(reflect.StructField{
+				Name: field.Name, Type: field.Type.Elem(), Tag: field.Tag,
+			})
+		case reflect.Slice:
+			// Byte slices including named types like json.RawMessage
+			if field.Type.Elem().Kind() == reflect.Uint8 {
+				fieldType = "blob"
+				break
+			}
+			err = &UnsupportedTypeError{Field: field.Name, Type: field.Type}
 		default:
 			// If the type is not supported, return an error
-			err = fmt.Errorf("unsupported type: %s", field.Type.Kind())
+			err = &UnsupportedTypeError{Field: field.Name, Type: field.Type}
 		}
 	}
 
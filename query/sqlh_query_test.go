@@ -0,0 +1,1184 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testUser is the query package tests struct.
+type testUser struct {
+	ID    int64  `db:"id" db_key:"primary key"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	Age   int    `db:"age"`
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		wheres []string
+		want   string
+	}{
+		{"no conditions", nil, "DELETE from testuser;"},
+		{"one condition", []string{"id="}, "DELETE from testuser where id = ?;"},
+		{"two conditions", []string{"id=", "name="},
+			"DELETE from testuser where id = ? AND name = ?;"},
+		{"three conditions", []string{"id=", "name LIKE", "age>"},
+			"DELETE from testuser where id = ? AND name LIKE ? AND age > ?;"},
+		{"condition without operator", []string{"id =", "name"},
+			"DELETE from testuser where id = ? AND name ?;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Delete[testUser](tt.wheres...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		columns []string
+		want    []string
+	}{
+		{"all columns exist", []string{"id", "name", "email", "age"}, nil},
+		{"columns case insensitive", []string{"ID", "Name", "EMAIL", "age"},
+			nil},
+		{"missing columns", []string{"id", "name"}, []string{
+			"ALTER TABLE testuser ADD COLUMN email text;",
+			"ALTER TABLE testuser ADD COLUMN age integer;",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Migrate[testUser](tt.columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testItem is the query package tests struct with autoincrement primary key.
+type testItem struct {
+	ID   int64  `db:"id" db_key:"primary key autoincrement"`
+	Name string `db:"name"`
+}
+
+func TestInsertAutoIncrement(t *testing.T) {
+	tests := []struct {
+		name     string
+		row      []testItem
+		wantStmt string
+		wantArgs []any
+	}{
+		{"without row", nil, "INSERT INTO testitem(name) VALUES(?);", nil},
+		{"zero id skipped", []testItem{{0, "auto"}},
+			"INSERT INTO testitem(name) VALUES(?);", []any{"auto"}},
+		{"explicit id included", []testItem{{42, "explicit"}},
+			"INSERT INTO testitem(id,name) VALUES(?,?);",
+			[]any{int64(42), "explicit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Insert(tt.row...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			if tt.row == nil {
+				return
+			}
+			args, err := InsertArgs(tt.row[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// testPayload is the named byte slice type.
+type testPayload []byte
+
+func TestTableBytes(t *testing.T) {
+	type document struct {
+		Raw     json.RawMessage `db:"raw"`
+		Payload testPayload     `db:"payload"`
+		Bytes   []byte          `db:"bytes"`
+		Text    json.RawMessage `db:"text" db_type:"text"`
+	}
+
+	stmt, err := Table[document]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE TABLE IF NOT EXISTS document (raw blob, payload blob, " +
+		"bytes blob, text text);"
+	if stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+
+	tests := []struct {
+		name string
+		row  document
+		want []any
+	}{
+		{"values", document{json.RawMessage(`{"a":1}`), testPayload("p"),
+			[]byte("b"), json.RawMessage(`[]`)},
+			[]any{[]byte(`{"a":1}`), []byte("p"), []byte("b"), []byte(`[]`)}},
+		{"nil values", document{}, []any{[]byte(nil), []byte(nil),
+			[]byte(nil), []byte(nil)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := InsertArgs(tt.row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("got args %#v, want %#v", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name string
+		attr *SelectAttr
+		want string
+	}{
+		{"no attributes", &SelectAttr{}, "SELECT count(*) from testuser;"},
+		{"where clauses", &SelectAttr{Wheres: []string{"age > ?", "name = ?"}},
+			"SELECT count(*) from testuser where age > ? and name = ?;"},
+		{"alias", &SelectAttr{Alias: "t", Wheres: []string{"t.age > ?"}},
+			"SELECT count(*) from testuser t where t.age > ?;"},
+		{"table name", &SelectAttr{Name: "users"},
+			"SELECT count(*) from users;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count[testUser](tt.attr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testComputed is the tests struct with read only fields.
+type testComputed struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Upper string `db:"upper" db_ro:"true"`
+	Len   int    `db:"len,readonly"`
+	Words int    `db:"words" db_key:"not null readonly"`
+}
+
+func TestReadonly(t *testing.T) {
+	row := testComputed{1, "a", "A", 1, 1}
+	tests := []struct {
+		name string
+		stmt func() (string, error)
+		want string
+	}{
+		{"insert", func() (string, error) { return Insert(row) },
+			"INSERT INTO testcomputed(id,name) VALUES(?,?);"},
+		{"update", func() (string, error) { return Update[testComputed]("id=") },
+			"UPDATE testcomputed SET id=?,name=? WHERE id = ?;"},
+		{"select", func() (string, error) {
+			return Select[testComputed](&SelectAttr{})
+		}, "SELECT * from testcomputed;"},
+		{"table", Table[testComputed], "CREATE TABLE IF NOT EXISTS " +
+			"testcomputed (id integer, name text, upper text, len integer, " +
+			"words integer not null);"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.stmt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Read columns contain read only fields, write values do not
+	if got, want := Columns[testComputed](true),
+		[]string{"id", "name", "upper", "len", "words"}; !slices.Equal(got,
+		want) {
+		t.Errorf("got read columns %q, want %q", got, want)
+	}
+	args, err := InsertArgs(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{int64(1), "a"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got insert args %#v, want %#v", args, want)
+	}
+}
+
+// testProfile is the tests struct with skipped fields.
+type testProfile struct {
+	ID       int64  `db:"id" db_key:"primary key autoincrement"`
+	Nickname string `db:"nick,omitempty"`
+	Secret   string `db:"-"`
+	Bio      string
+}
+
+func TestColumns(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name        string
+		columns     func(includeAuto bool) []string
+		insert      func() (string, error)
+		wantAll     []string
+		wantWritten []string
+	}{
+		{"plain struct", Columns[testUser], func() (string, error) {
+			return Insert(testUser{})
+		}, []string{"id", "name", "email", "age"},
+			[]string{"id", "name", "email", "age"}},
+		{"autoincrement", Columns[testItem], func() (string, error) {
+			return Insert(testItem{})
+		}, []string{"id", "name"}, []string{"name"}},
+		{"read only", Columns[testComputed], func() (string, error) {
+			return Insert(testComputed{})
+		}, []string{"id", "name", "upper", "len", "words"},
+			[]string{"id", "name"}},
+		{"omitempty and skipped fields", Columns[testProfile],
+			func() (string, error) {
+				return Insert(testProfile{Nickname: "nick"})
+			}, []string{"id", "nick", "bio"}, []string{"nick", "bio"}},
+		{"not struct", Columns[int], nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.columns(true); !slices.Equal(got, tt.wantAll) {
+				t.Errorf("got all columns %q, want %q", got, tt.wantAll)
+			}
+			got := tt.columns(false)
+			if !slices.Equal(got, tt.wantWritten) {
+				t.Errorf("got written columns %q, want %q", got,
+					tt.wantWritten)
+			}
+			if tt.insert == nil {
+				return
+			}
+
+			// The written columns are the Insert statement columns
+			stmt, err := tt.insert()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stmt, "("+strings.Join(got, ",")+")") {
+				t.Errorf("insert statement %q columns are not %q", stmt, got)
+			}
+		})
+	}
+}
+
+func TestUpdateFields(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		cols    []string
+		wheres  []string
+		want    string
+		wantErr bool
+	}{
+		{"one column", []string{"name"}, []string{"id="},
+			"UPDATE testuser SET name=? WHERE id = ?;", false},
+		{"columns in given order", []string{"age", "email"},
+			[]string{"id=", "name="},
+			"UPDATE testuser SET age=?,email=? WHERE id = ? AND name = ?;",
+			false},
+		{"without where", []string{"age"}, nil, "", true},
+		{"unknown column", []string{"data"}, nil, "", true},
+		{"no columns", nil, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpdateFields[testUser](tt.cols, tt.wheres...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testNullable is the tests struct with pointer and explicitly nullable
+// fields.
+type testNullable struct {
+	ID    int64   `db:"id" db_key:"primary key"`
+	Name  string  `db:"name"`
+	Nick  *string `db:"nick"`
+	Note  string  `db:"note" db_key:"null"`
+	Code  string  `db:"code" db_key:"unique not null"`
+	Score float64 `db:"score" db_ro:"true"`
+}
+
+func TestImplicitNotNull(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name string
+		on   bool
+		want string
+	}{
+		{"off by default", false, "CREATE TABLE IF NOT EXISTS testnullable " +
+			"(id integer primary key, name text, nick text, note text null, " +
+			"code text unique not null, score double);"},
+		{"on", true, "CREATE TABLE IF NOT EXISTS testnullable " +
+			"(id integer primary key not null, name text not null, " +
+			"nick text, note text null, code text unique not null, " +
+			"score double not null);"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetImplicitNotNull(tt.on)
+			t.Cleanup(ResetDefaults)
+
+			got, err := Table[testNullable]()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTableStrict(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name  string
+		table func() (string, error)
+		want  string
+	}{
+		{"if not exists", Table[testUser], "CREATE TABLE IF NOT EXISTS " +
+			"testuser (id integer primary key, name text, email text, " +
+			"age integer);"},
+		{"strict", CreateTableStrict[testUser], "CREATE TABLE testuser " +
+			"(id integer primary key, name text, email text, age integer);"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.table()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testSkipped is the tests struct with skipped fields between database
+// fields.
+type testSkipped struct {
+	ID    int64  `db:"id"`
+	Temp  string `db:"-"`
+	Name  string `db:"name"`
+	_     int
+	Email string `db:"email"`
+	Cache []int  `db:"-"`
+	Age   int    `db:"age"`
+}
+
+func TestArgsSkippedFields(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	typ := reflect.TypeFor[testSkipped]()
+	if got, want := fieldsIndex(typ), []int{0, 2, 4, 6}; !slices.Equal(got,
+		want) {
+		t.Fatalf("got fields index %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		args []any
+		want testSkipped
+	}{
+		{"all fields", []any{int64(1), "alice", "a@", int64(30)},
+			testSkipped{ID: 1, Temp: "temp", Name: "alice", Email: "a@",
+				Cache: []int{1}, Age: 30}},
+		{"NULL fields", []any{int64(2), nil, "b@", nil},
+			testSkipped{ID: 2, Temp: "temp", Email: "b@", Cache: []int{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Apply values to the scan arguments made by Args
+			row := testSkipped{Temp: "temp", Cache: []int{1}}
+			args, err := Args(&row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args) != len(tt.args) {
+				t.Fatalf("got %d args, want %d", len(args), len(tt.args))
+			}
+			for i, arg := range args {
+				*arg.(*any) = tt.args[i]
+			}
+			if err = ArgsAppay(&row, args); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("got %+v, want %+v", row, tt.want)
+			}
+
+			// Insert arguments are in the same order
+			stmt, err := Insert(row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "INSERT INTO testskipped(id,name,email,age) " +
+				"VALUES(?,?,?,?);"; stmt != want {
+				t.Errorf("got %q, want %q", stmt, want)
+			}
+		})
+	}
+}
+
+func TestUnion(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		a, b    *SelectAttr
+		all     bool
+		want    string
+		wantErr bool
+	}{
+		{"union all", SQLite, &SelectAttr{Wheres: []string{"age > ?"}},
+			&SelectAttr{Wheres: []string{"name = ?"}}, true,
+			"SELECT * from testuser where age > ? UNION ALL " +
+				"SELECT * from testuser where name = ?;", false},
+		{"union with order and limit", SQLite, &SelectAttr{
+			Wheres: []string{"age > ?"}, OrderBy: "id",
+			Paginator: &Paginator{Limit: 5}}, &SelectAttr{}, false,
+			"SELECT * from testuser where age > ? UNION " +
+				"SELECT * from testuser ORDER BY id LIMIT 5;", false},
+		{"postgres placeholders numbered", Postgres, &SelectAttr{
+			Wheres: []string{"age > ?"}}, &SelectAttr{
+			Wheres: []string{"name = ?"}}, true,
+			"SELECT * from testuser where age > $1 UNION ALL " +
+				"SELECT * from testuser where name = $2;", false},
+		{"second order by", SQLite, &SelectAttr{}, &SelectAttr{OrderBy: "id"},
+			false, "", true},
+		{"second limit", SQLite, &SelectAttr{}, &SelectAttr{
+			Paginator: &Paginator{Limit: 1}}, false, "", true},
+		{"lock", Postgres, &SelectAttr{Lock: "FOR UPDATE"}, &SelectAttr{},
+			false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := Union[testUser](tt.a, tt.b, tt.all)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testMember is the tests struct with the composite unique constraint.
+type testMember struct {
+	ID       int64    `db:"id" db_key:"primary key"`
+	Email    string   `db:"email"`
+	TenantID int64    `db:"tenant_id"`
+	_        struct{} `db_key:"unique (email, tenant_id)"`
+}
+
+// testMemberPK is the tests struct with the composite primary key.
+type testMemberPK struct {
+	Email    string   `db:"email"`
+	TenantID int64    `db:"tenant_id"`
+	_        struct{} `db_key:"PRIMARY  KEY (tenant_id,email)"`
+}
+
+// testMemberBad is the tests struct with unknown constraint column.
+type testMemberBad struct {
+	Email string   `db:"email"`
+	_     struct{} `db_key:"unique (email, tenant_id)"`
+}
+
+func TestTableConstraint(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		stmt    func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"composite unique", SQLite, Table[testMember],
+			"CREATE TABLE IF NOT EXISTS testmember (id integer primary key, " +
+				"email text, tenant_id integer, unique (email, tenant_id));",
+			false},
+		{"composite primary key", SQLite, Table[testMemberPK],
+			"CREATE TABLE IF NOT EXISTS testmemberpk (email text, " +
+				"tenant_id integer, primary key (tenant_id, email));", false},
+		{"quoted columns", namedDialect, Table[testMember],
+			`CREATE TABLE IF NOT EXISTS "testmember" ("id" integer primary ` +
+				`key, "email" text, "tenant_id" integer, ` +
+				`unique ("email", "tenant_id"));`, false},
+		{"unknown column", SQLite, Table[testMemberBad], "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := tt.stmt()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The blank field is not a column
+	if got, want := Columns[testMember](true), []string{"id", "email",
+		"tenant_id"}; !slices.Equal(got, want) {
+		t.Errorf("got columns %q, want %q", got, want)
+	}
+}
+
+func TestSelectAttrClone(t *testing.T) {
+
+	// base returns the base attributes, a new value for each call
+	base := func() *SelectAttr {
+		return &SelectAttr{
+			Paginator: &Paginator{Offset: 5, Limit: 10},
+			Wheres:    []string{"age > ?"},
+			OrderBy:   "t.id",
+			Columns:   []string{"id", "name"},
+			GroupBy:   []string{"name"},
+			Alias:     "t",
+			Joins: []Join{MakeJoin[testProfile]("LEFT JOIN", "p",
+				"t.id = p.user_id")},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *SelectAttr)
+	}{
+		{"append where", func(c *SelectAttr) {
+			c.Wheres = append(c.Wheres, "name = ?")
+		}},
+		{"change where", func(c *SelectAttr) { c.Wheres[0] = "age < ?" }},
+		{"change paginator", func(c *SelectAttr) { c.Paginator.Limit = 1 }},
+		{"change columns", func(c *SelectAttr) { c.Columns[1] = "email" }},
+		{"change group by", func(c *SelectAttr) { c.GroupBy[0] = "email" }},
+		{"change join", func(c *SelectAttr) {
+			c.Joins[0].On = "t.id = p.id"
+			c.Joins[0].Fields[0] = "p.other"
+		}},
+		{"change scalars", func(c *SelectAttr) {
+			c.OrderBy, c.Alias, c.Name = "t.name", "u", "users"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attr := base()
+			c := attr.Clone()
+			if !reflect.DeepEqual(c, attr) {
+				t.Fatalf("got clone %+v, want %+v", c, attr)
+			}
+
+			// The modified copy does not change the original
+			tt.modify(c)
+			if !reflect.DeepEqual(attr, base()) {
+				t.Errorf("got original %+v, want %+v", attr, base())
+			}
+			if reflect.DeepEqual(c, attr) {
+				t.Error("got clone equal to original after modification")
+			}
+		})
+	}
+
+	// The Select function does not modify the attr
+	attr := base()
+	for range 2 {
+		if _, err := Select[testUser](attr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(attr, base()) {
+		t.Errorf("got attr after select %+v, want %+v", attr, base())
+	}
+
+	// Clone of nil attr is nil
+	if c := (*SelectAttr)(nil).Clone(); c != nil {
+		t.Errorf("got %+v, want nil", c)
+	}
+}
+
+func TestSelectAliasRepeated(t *testing.T) {
+	tests := []struct {
+		name string
+		attr SelectAttr
+		want string
+	}{
+		{"alias", SelectAttr{Alias: "u"}, "SELECT u.* from testuser u;"},
+		{"alias and columns", SelectAttr{Alias: "u",
+			Columns: []string{"id", "name"}},
+			"SELECT u.id, u.name from testuser u;"},
+		{"alias and join", SelectAttr{Alias: "u", Joins: []Join{
+			MakeJoin[testItem]("JOIN", "i", "u.id = i.id")}},
+			"SELECT u.id, u.name, u.email, u.age, i.id, i.name " +
+				"from testuser u JOIN testitem i ON u.id = i.id;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The alias is not added to the cached columns, so each call
+			// returns the same statement and the columns are not changed
+			for i := range 3 {
+				got, err := Select[testUser](&tt.attr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("call %d: got %q, want %q", i+1, got, tt.want)
+				}
+			}
+			if got := Columns[testUser](true); !slices.Equal(got,
+				[]string{"id", "name", "email", "age"}) {
+				t.Errorf("got columns %q after select with alias", got)
+			}
+		})
+	}
+}
+
+// testChecked is the tests struct with the column and table check
+// constraints.
+type testChecked struct {
+	ID      int64    `db:"id" db_key:"primary key"`
+	Age     int      `db:"age" db_check:"age >= 0"`
+	Status  string   `db:"status" db_key:"not null" db_check:"status IN ('a)', 'b')"`
+	StartAt int64    `db:"start_at"`
+	EndAt   int64    `db:"end_at"`
+	_       struct{} `db_check:"start_at < end_at"`
+}
+
+func TestCheckConstraint(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	stmt, err := Table[testChecked]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS testchecked (id integer primary " +
+		"key, age integer check (age >= 0), status text not null " +
+		"check (status IN ('a)', 'b')), start_at integer, end_at integer, " +
+		"check (start_at < end_at));"; stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+
+	tests := []struct {
+		name    string
+		tag     reflect.StructTag
+		want    string
+		wantErr bool
+	}{
+		{"expression", `db_check:"age >= 0"`, "check (age >= 0)", false},
+		{"trimmed", `db_check:"  age >= 0 "`, "check (age >= 0)", false},
+		{"nested parentheses", `db_check:"(a > 0) AND (b > 0)"`,
+			"check ((a > 0) AND (b > 0))", false},
+		{"quoted parenthesis", `db_check:"name <> ')'"`,
+			"check (name <> ')')", false},
+		{"no tag", `db:"age"`, "", false},
+		{"empty", `db_check:""`, "", true},
+		{"unbalanced", `db_check:"age >= (0"`, "", true},
+		{"closed before opened", `db_check:"a) OR (b"`, "", true},
+		{"unclosed quote", `db_check:"name <> 'x"`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkConstraint(reflect.StructField{Name: "Age",
+				Tag: tt.tag})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testOptions is the tests struct with the db tag options.
+type testOptions struct {
+	ID     int64  `db:"id" db_key:"primary key"`
+	Nick   string `db:"nick,omitempty" db_key:"default 'guest'"`
+	Score  int    `db:",omitempty"`
+	Status string `db:"status, readonly"`
+}
+
+func TestTagOptions(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name string
+		stmt func() (string, error)
+		want string
+	}{
+		{"table", Table[testOptions],
+			"CREATE TABLE IF NOT EXISTS testoptions (id integer primary key, " +
+				"nick text default 'guest', score integer, status text);"},
+		{"insert zero values", func() (string, error) {
+			return Insert(testOptions{ID: 1})
+		}, "INSERT INTO testoptions(id) VALUES(?);"},
+		{"insert set values", func() (string, error) {
+			return Insert(testOptions{ID: 1, Nick: "bob", Score: 5})
+		}, "INSERT INTO testoptions(id,nick,score) VALUES(?,?,?);"},
+		{"update", func() (string, error) {
+			return Update[testOptions]("id=")
+		}, "UPDATE testoptions SET id=?,nick=?,score=? WHERE id = ?;"},
+		{"select", func() (string, error) {
+			return Select[testOptions](&SelectAttr{Wheres: []string{"nick = ?"}})
+		}, "SELECT * from testoptions where nick = ?;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.stmt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The insert arguments match the insert statement columns
+	args, err := InsertArgs(testOptions{ID: 1, Score: 5, Status: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{int64(1), 5}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got insert args %#v, want %#v", args, want)
+	}
+
+	// The named scan matches the column name without options
+	var row testOptions
+	id, nick, status := any(int64(1)), any("bob"), any("active")
+	if err = ArgsAppayNamed(&row, []string{"id", "nick", "status"},
+		[]any{&id, &nick, &status}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (testOptions{1, "bob", 0, "active"}); row != want {
+		t.Errorf("got %+v, want %+v", row, want)
+	}
+}
+
+func TestResetDefaults(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name   string
+		mutate func()
+		check  func() bool // Returns true if the setting is the default
+	}{
+		{"dialect", func() { SetDialect(Postgres) },
+			func() bool { return GetDialect().Name == "sqlite" }},
+		{"time location", func() {
+			SetTimeLocation(time.FixedZone("UTC+3", 3*60*60))
+		},
+			func() bool { return timeLocation == time.UTC }},
+		{"implicit not null", func() { SetImplicitNotNull(true) },
+			func() bool { return !implicitNotNull }},
+		{"max in params", func() { SetMaxInParams(10) },
+			func() bool { return MaxInParams() == 999 }},
+		{"gob fallback", func() { SetGobFallback(false) },
+			func() bool { return gobFallback }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mutate()
+			if tt.check() {
+				t.Fatal("setting is not changed")
+			}
+			ResetDefaults()
+			if !tt.check() {
+				t.Error("setting is not restored")
+			}
+		})
+	}
+
+	// The statements after reset are the default dialect statements
+	SetDialect(Postgres)
+	SetImplicitNotNull(true)
+	ResetDefaults()
+	stmt, err := Table[testUser]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS testuser (id integer primary key, " +
+		"name text, email text, age integer);"; stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+}
+
+func TestUpdateExpr(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		sets    map[string]string
+		wheres  []string
+		want    string
+		wantErr bool
+	}{
+		{"increment", SQLite, map[string]string{"age": "age + ?"},
+			[]string{"id="}, "UPDATE testuser SET age = age + ? WHERE id = ?;",
+			false},
+		{"columns sorted", SQLite, map[string]string{"name": "upper(name)",
+			"age": "age * ?"}, []string{"id>", "age<"},
+			"UPDATE testuser SET age = age * ?, name = upper(name) " +
+				"WHERE id > ? AND age < ?;", false},
+		{"postgres placeholders", Postgres, map[string]string{
+			"age": "age + ?"}, []string{"id="},
+			"UPDATE testuser SET age = age + $1 WHERE id = $2;", false},
+		{"no columns", SQLite, nil, []string{"id="}, "", true},
+		{"unknown column", SQLite, map[string]string{"count": "count + 1"},
+			[]string{"id="}, "", true},
+		{"no where", SQLite, map[string]string{"age": "age + 1"}, nil, "",
+			true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := UpdateExpr[testUser](tt.sets, tt.wheres...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testIndexed is the tests struct with the fields bound to the result set
+// positions.
+type testIndexed struct {
+	Age  int    `db:"age" db_index:"3"`
+	Name string `db:"name" db_index:"0"`
+	ID   int64  `db:"id" db_index:"1"`
+	Note string `db:"-" db_index:"2"`
+}
+
+func TestIndexColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns func(n int) ([]string, error)
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		{"out of order fields", IndexColumns[testIndexed], 4,
+			[]string{"name", "id", "", "age"}, false},
+		{"extra result columns", IndexColumns[testIndexed], 6,
+			[]string{"name", "id", "", "age", "", ""}, false},
+		{"no db_index tags", IndexColumns[testUser], 4, nil, false},
+		{"out of result set", IndexColumns[testIndexed], 3, nil, true},
+		{"duplicate", IndexColumns[struct {
+			A int `db_index:"0"`
+			B int `db_index:"0"`
+		}], 2, nil, true},
+		{"invalid", IndexColumns[struct {
+			A int `db_index:"first"`
+		}], 2, nil, true},
+		{"negative", IndexColumns[struct {
+			A int `db_index:"-1"`
+		}], 2, nil, true},
+		{"not struct", IndexColumns[int], 2, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.columns(tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinOn(t *testing.T) {
+	tests := []struct {
+		name string
+		join Join
+		want Join
+	}{
+		{"shared id column", JoinOn[testItem]("LEFT JOIN", "i", "u", "id"),
+			Join{Join: "LEFT JOIN", Name: "testitem", Alias: "i",
+				On:     "u.id = i.id",
+				Fields: []string{"i.id", "i.name"}}},
+		{"join type normalized", JoinOn[testItem]("left  join", "i", "t",
+			"name"), Join{Join: "LEFT JOIN", Name: "testitem", Alias: "i",
+			On:     "t.name = i.name",
+			Fields: []string{"i.id", "i.name"}}},
+		{"same as make join", JoinOn[testItem]("JOIN", "i", "u", "id"),
+			MakeJoin[testItem]("JOIN", "i", "u.id = i.id")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.join, tt.want) {
+				t.Errorf("got %+v, want %+v", tt.join, tt.want)
+			}
+		})
+	}
+
+	// The generated join is used in the select statement
+	got, err := Select[testUser](&SelectAttr{Alias: "u", Joins: []Join{
+		JoinOn[testItem]("LEFT JOIN", "i", "u", "id")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT u.id, u.name, u.email, u.age, i.id, i.name " +
+		"from testuser u LEFT JOIN testitem i ON u.id = i.id;"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// testOrderedA and testOrderedB are the tests structs with the same columns
+// declared in different Go fields order and ordered by the db_order tags.
+type testOrderedA struct {
+	Note string `db:"note"`
+	Age  int    `db:"age" db_order:"3"`
+	Name string `db:"name" db_order:"2"`
+	Tag  string `db:"tag"`
+	ID   int64  `db:"id" db_order:"1" db_key:"primary key"`
+}
+type testOrderedB struct {
+	ID   int64  `db:"id" db_order:"1" db_key:"primary key"`
+	Note string `db:"note"`
+	Name string `db:"name" db_order:"2"`
+	Tag  string `db:"tag"`
+	Age  int    `db:"age" db_order:"3"`
+}
+
+func TestFieldOrder(t *testing.T) {
+	a := testOrderedA{Note: "n", Age: 30, Name: "alice", Tag: "t", ID: 1}
+	b := testOrderedB{ID: 1, Note: "n", Name: "alice", Tag: "t", Age: 30}
+
+	// table returns the statement with the table name replaced to compare
+	// the A and B structs statements
+	table := func(stmt string, err error) (string, error) {
+		stmt = strings.ReplaceAll(stmt, "testordereda", "t")
+		return strings.ReplaceAll(stmt, "testorderedb", "t"), err
+	}
+
+	tests := []struct {
+		name string
+		a, b func() (any, error)
+		want any
+	}{
+		{"columns", func() (any, error) {
+			return Columns[testOrderedA](true), nil
+		}, func() (any, error) {
+			return Columns[testOrderedB](true), nil
+		}, []string{"id", "name", "age", "note", "tag"}},
+		{"table", func() (any, error) {
+			return table(Table[testOrderedA]())
+		}, func() (any, error) {
+			return table(Table[testOrderedB]())
+		}, "CREATE TABLE IF NOT EXISTS t (id integer primary key, name text, " +
+			"age integer, note text, tag text);"},
+		{"insert", func() (any, error) {
+			return table(Insert[testOrderedA]())
+		}, func() (any, error) {
+			return table(Insert[testOrderedB]())
+		}, "INSERT INTO t(id,name,age,note,tag) VALUES(?,?,?,?,?);"},
+		{"insert args", func() (any, error) {
+			return InsertArgs(a)
+		}, func() (any, error) {
+			return InsertArgs(b)
+		}, []any{int64(1), "alice", 30, "n", "t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotA, err := tt.a()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotB, err := tt.b()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotA, tt.want) {
+				t.Errorf("got A %v, want %v", gotA, tt.want)
+			}
+			if !reflect.DeepEqual(gotB, tt.want) {
+				t.Errorf("got B %v, want %v", gotB, tt.want)
+			}
+		})
+	}
+
+	// Equal and not integer positions keep the declaration order
+	type partial struct {
+		C int `db:"c" db_order:"x"`
+		B int `db:"b" db_order:"1"`
+		A int `db:"a" db_order:"1"`
+		D int `db:"d"`
+	}
+	if got, want := Columns[partial](true), []string{"b", "a", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("got partial order %q, want %q", got, want)
+	}
+
+	// The scanned values are applied in the columns order
+	var row testOrderedB
+	args, err := Args(&row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []any{int64(1), "alice", int64(30), "n", "t"} {
+		*args[i].(*any) = v
+	}
+	if err = ArgsAppay(&row, args); err != nil {
+		t.Fatal(err)
+	}
+	if row != b {
+		t.Errorf("got applied row %+v, want %+v", row, b)
+	}
+
+	// The primary keys follow the columns order
+	type keys struct {
+		Name string `db:"name" db_order:"2" db_key:"primary key"`
+		ID   int64  `db:"id" db_order:"1" db_key:"primary key"`
+	}
+	if got, want := PrimaryKeys[keys](), []string{"id", "name"}; !slices.Equal(got, want) {
+		t.Errorf("got primary keys %q, want %q", got, want)
+	}
+}
+
+// testCollated is the tests struct with the collated text columns.
+type testCollated struct {
+	ID    int64  `db:"id" db_key:"primary key"`
+	Name  string `db:"name" db_key:"unique" db_collate:"nocase"`
+	Title string `db:"title" db_type:"varchar(64)" db_collate:"utf8mb4_general_ci"`
+	Code  string `db:"code" db_collate:"\"und-x-icu\""`
+}
+
+func TestCollate(t *testing.T) {
+	tests := []struct {
+		name    string
+		stmt    func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"table", Table[testCollated], "CREATE TABLE IF NOT EXISTS " +
+			"testcollated (id integer primary key, " +
+			"name text COLLATE nocase unique, " +
+			"title varchar(64) COLLATE utf8mb4_general_ci, " +
+			`code text COLLATE "und-x-icu");`, false},
+		{"add column", func() (string, error) {
+			return AddColumn[testCollated]("Title")
+		}, "ALTER TABLE testcollated ADD COLUMN title varchar(64) " +
+			"COLLATE utf8mb4_general_ci;", false},
+		{"not text column", Table[struct {
+			Age int `db:"age" db_collate:"nocase"`
+		}], "", true},
+		{"invalid name", Table[struct {
+			Name string `db:"name" db_collate:"nocase; DROP TABLE x"`
+		}], "", true},
+		{"empty name", Table[struct {
+			Name string `db:"name" db_collate:""`
+		}], "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.stmt()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTextType(t *testing.T) {
+	tests := []struct {
+		columnType string
+		want       bool
+	}{
+		{"text", true},
+		{"VARCHAR(64)", true},
+		{"character varying", true},
+		{"longtext", true},
+		{"integer", false},
+		{"blob", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsTextType(tt.columnType); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.columnType, got, tt.want)
+		}
+	}
+}
+
+func TestCountSelect(t *testing.T) {
+	got := CountSelect("SELECT name from testuser GROUP BY name;")
+	want := "SELECT count(*) FROM (SELECT name from testuser GROUP BY name) t;"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
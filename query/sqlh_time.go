@@ -0,0 +1,87 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Time values support.
+
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// timeLocation is the location of time.Time values written to and read from
+// the database.
+var timeLocation = time.UTC
+
+// timeLayouts are the layouts of time values returned by the drivers as text,
+// f.e. by SQLite for datetime columns.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// SetTimeLocation sets the location of time.Time values. The time.Time struct
+// fields are converted to this location before they are written to the
+// database, and the time values read from the database are returned in this
+// location. The text time values without time zone are parsed in this
+// location. The default location is UTC, the nil loc sets UTC.
+func SetTimeLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	timeLocation = loc
+}
+
+// timeValue returns the time.Time or not nil *time.Time value v converted to
+// the time location. Other values are returned as is.
+func timeValue(v any) any {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(timeLocation)
+	case *time.Time:
+		if t != nil {
+			return t.In(timeLocation)
+		}
+	}
+	return v
+}
+
+// setTime sets the time.Time struct field f value from the database time
+// value. The name parameter is the struct field name used in the error
+// message.
+func setTime(f reflect.Value, name string, arg any) (err error) {
+	var s string
+	switch v := arg.(type) {
+	case time.Time:
+		f.Set(reflect.ValueOf(v.In(timeLocation)))
+		return
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return &UnsupportedTypeError{Field: name, Type: reflect.TypeOf(v)}
+	}
+
+	// Parse text value
+	for _, layout := range timeLayouts {
+		t, e := time.ParseInLocation(layout, s, timeLocation)
+		if e == nil {
+			f.Set(reflect.ValueOf(t.In(timeLocation)))
+			return
+		}
+	}
+
+	return fmt.Errorf("can't parse field %s time value %q", name, s)
+}
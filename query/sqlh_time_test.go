@@ -0,0 +1,75 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+// testEvent is the tests struct with the time field.
+type testEvent struct {
+	ID int64     `db:"id"`
+	At time.Time `db:"at"`
+}
+
+func TestTimeLocation(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+	at := time.Date(2024, 6, 1, 12, 30, 15, 0, moscow)
+
+	tests := []struct {
+		name    string
+		loc     *time.Location
+		src     any
+		want    time.Time
+		wantErr bool
+	}{
+		{"time value", nil, at, at.UTC(), false},
+		{"time value in location", moscow, at.UTC(), at, false},
+		{"text with zone", nil, "2024-06-01 12:30:15+03:00", at.UTC(), false},
+		{"text without zone in location", moscow, []byte("2024-06-01 12:30:15"),
+			at, false},
+		{"text without zone in UTC", nil, "2024-06-01T09:30:15", at.UTC(),
+			false},
+		{"RFC3339", moscow, "2024-06-01T09:30:15Z", at, false},
+		{"date only", nil, "2024-06-01",
+			time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"NULL", nil, nil, time.Time{}, false},
+		{"invalid text", nil, "yesterday", time.Time{}, true},
+		{"unsupported type", nil, int64(1), time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTimeLocation(tt.loc)
+			t.Cleanup(ResetDefaults)
+
+			// Read the value
+			var row testEvent
+			id, src := any(int64(1)), tt.src
+			err := ArgsAppay(&row, []any{&id, &src})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !row.At.Equal(tt.want) || row.At.Location() != tt.want.Location() {
+				t.Errorf("got %v, want %v", row.At, tt.want)
+			}
+
+			// The written value is in the location
+			args, err := InsertArgs(testEvent{1, at})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := args[1].(time.Time)
+			if !w.Equal(at) || w.Location() != timeLocation {
+				t.Errorf("got written %v, want %v", w, at.In(timeLocation))
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Custom types support.
+
+package query
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// typeCodec contains custom type encode and decode functions.
+type typeCodec struct {
+	encode func(v any) (driver.Value, error)
+	decode func(f reflect.Value, src any) error
+}
+
+// types contains registered custom types codecs by type, it is guarded by the
+// typesMu mutex.
+var (
+	types   = make(map[reflect.Type]typeCodec)
+	typesMu sync.RWMutex
+)
+
+// Register built-in custom types.
+func init() {
+	RegisterType(reflect.TypeFor[*big.Int](), encodeBigInt, decodeBigInt)
+}
+
+// RegisterType registers custom goType encode and decode functions.
+//
+// The encode function converts the field value to the database value when the
+// row is written. The decode function sets the field f value from the src
+// value returned by the database driver when the row is read. The src value is
+// never nil: the NULL database value sets the field to its zero value.
+//
+// The registered types columns are created with "text" type by default. Use
+// db_type tag to set other database field type.
+//
+// The *big.Int type is registered by default and stored as decimal string.
+// The types may be registered concurrently with the queries, but usually they
+// are registered once on the program start.
+func RegisterType(goType reflect.Type, encode func(v any) (driver.Value, error),
+	decode func(f reflect.Value, src any) error) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[goType] = typeCodec{encode, decode}
+}
+
+// typeCodecOf returns the registered custom type t codec. The ok result is
+// false if the type is not registered.
+func typeCodecOf(t reflect.Type) (codec typeCodec, ok bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	codec, ok = types[t]
+	return
+}
+
+// RegisterStringEnum registers E enum type stored in database as its string
+// name in a text column.
+//
+// The E type should implement fmt.Stringer interface which is used to write
+// the enum value. The parse function is used to read the enum value and
+// should return an error for unknown string.
+//
+// Example:
+//
+//	type Status int
+//
+//	func (s Status) String() string { ... }
+//	func ParseStatus(s string) (Status, error) { ... }
+//
+//	query.RegisterStringEnum(ParseStatus)
+func RegisterStringEnum[E fmt.Stringer](parse func(string) (E, error)) {
+	RegisterType(reflect.TypeFor[E](),
+		func(v any) (driver.Value, error) {
+			return v.(fmt.Stringer).String(), nil
+		},
+		func(f reflect.Value, src any) error {
+			s, err := stringValue(src)
+			if err != nil {
+				return err
+			}
+			v, err := parse(s)
+			if err != nil {
+				return err
+			}
+			f.Set(reflect.ValueOf(v))
+			return nil
+		},
+	)
+}
+
+// isRegisteredType returns true if the type t is registered custom type.
+func isRegisteredType(t reflect.Type) bool {
+	_, ok := typeCodecOf(t)
+	return ok
+}
+
+// encodeType returns the database value of the registered custom type field
+// f. The ok result is false if the field type is not registered.
+func encodeType(f reflect.Value) (v any, ok bool, err error) {
+	codec, ok := typeCodecOf(f.Type())
+	if !ok {
+		return
+	}
+	v, err = codec.encode(f.Interface())
+	return
+}
+
+// decodeType sets the registered custom type field f value from the scanned
+// argument arg. The ok result is false if the field type is not registered.
+func decodeType(f reflect.Value, name string, arg any) (ok bool, err error) {
+
+	// Check if the field type is registered
+	codec, ok := typeCodecOf(f.Type())
+	if !ok {
+		return
+	}
+
+	// Set zero value for NULL
+	if arg == nil {
+		f.SetZero()
+		return
+	}
+
+	// Decode value
+	if err = codec.decode(f, arg); err != nil {
+		err = fmt.Errorf("can't decode field %s: %w", name, err)
+	}
+
+	return
+}
+
+// stringValue returns string from the string or []byte database value.
+func stringValue(src any) (string, error) {
+	switch v := src.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("unexpected value type %T", src)
+}
+
+// encodeBigInt encodes *big.Int value to decimal string.
+func encodeBigInt(v any) (driver.Value, error) {
+	i := v.(*big.Int)
+	if i == nil {
+		return nil, nil
+	}
+	return i.String(), nil
+}
+
+// decodeBigInt sets *big.Int field from decimal string or integer.
+func decodeBigInt(f reflect.Value, src any) error {
+	i := new(big.Int)
+	switch v := src.(type) {
+	case int64:
+		i.SetInt64(v)
+	default:
+		s, err := stringValue(src)
+		if err != nil {
+			return err
+		}
+		if _, ok := i.SetString(s, 10); !ok {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+	}
+	f.Set(reflect.ValueOf(i))
+	return nil
+}
+
+// ArrayValue is the array value returned by the array codec, f.e. by the
+// pq.Array function of the github.com/lib/pq package.
+type ArrayValue interface {
+	driver.Valuer
+	sql.Scanner
+}
+
+// arrayCodec is the registered array codec.
+var arrayCodec func(a any) ArrayValue
+
+// RegisterArrayCodec registers the array codec used to write and read slice
+// fields tagged with db_type:"array", f.e. Postgres array columns. The codec
+// function gets the slice on write, or the pointer to slice on read, and
+// returns the value which implements driver.Valuer and sql.Scanner
+// interfaces.
+//
+// Example:
+//
+//	query.RegisterArrayCodec(func(a any) query.ArrayValue {
+//		return pq.Array(a)
+//	})
+func RegisterArrayCodec(codec func(a any) ArrayValue) {
+	arrayCodec = codec
+}
+
+// isArray returns true if the field is a slice (except []byte) tagged with
+// db_type:"array".
+func isArray(field reflect.StructField) bool {
+	return field.Tag.Get("db_type") == "array" &&
+		field.Type.Kind() == reflect.Slice && !isBytes(field.Type)
+}
+
+// encodeArray returns the database value of the array field f.
+func encodeArray(f reflect.Value) (any, error) {
+	if arrayCodec == nil {
+		return nil, fmt.Errorf("array codec is not registered")
+	}
+	if f.IsNil() {
+		return nil, nil
+	}
+	return arrayCodec(f.Interface()).Value()
+}
+
+// decodeArray sets the array field f value from the scanned argument arg. The
+// NULL array sets the field to nil slice.
+func decodeArray(f reflect.Value, name string, arg any) error {
+	if arg == nil {
+		f.SetZero()
+		return nil
+	}
+	if arrayCodec == nil {
+		return fmt.Errorf("array codec is not registered")
+	}
+	if err := arrayCodec(f.Addr().Interface()).Scan(arg); err != nil {
+		return fmt.Errorf("can't decode field %s: %w", name, err)
+	}
+	return nil
+}
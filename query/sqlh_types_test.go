@@ -0,0 +1,490 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStatus is the string enum tests type.
+type testStatus int
+
+const (
+	statusActive testStatus = iota + 1
+	statusBlocked
+)
+
+var statusNames = map[testStatus]string{
+	statusActive:  "active",
+	statusBlocked: "blocked",
+}
+
+func (s testStatus) String() string { return statusNames[s] }
+
+// parseStatus returns the testStatus by its name.
+func parseStatus(name string) (testStatus, error) {
+	for s, n := range statusNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status %q", name)
+}
+
+func init() {
+	RegisterStringEnum(parseStatus)
+}
+
+// testAccount is the tests struct with the string enum field.
+type testAccount struct {
+	ID     int64      `db:"id"`
+	Status testStatus `db:"status"`
+}
+
+func TestStringEnum(t *testing.T) {
+	stmt, err := Table[testAccount]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS testaccount (id integer, " +
+		"status text);"; stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+
+	tests := []struct {
+		name    string
+		src     any
+		want    testStatus
+		wantErr bool
+	}{
+		{"string", "active", statusActive, false},
+		{"bytes", []byte("blocked"), statusBlocked, false},
+		{"NULL", nil, 0, false},
+		{"unknown name", "deleted", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The scan arguments are pointers as made by the Args function
+			var row testAccount
+			id, src := any(int64(1)), tt.src
+			err := ArgsAppay(&row, []any{&id, &src})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if row.Status != tt.want {
+				t.Errorf("got status %v, want %v", row.Status, tt.want)
+			}
+
+			// Write the read value back as its name
+			if row.Status == 0 {
+				return
+			}
+			args, err := InsertArgs(row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args[1] != tt.want.String() {
+				t.Errorf("got written value %#v, want %q", args[1],
+					tt.want.String())
+			}
+		})
+	}
+}
+
+// testLevel is the string enum type registered concurrently with the queries.
+type testLevel int
+
+func (l testLevel) String() string { return strconv.Itoa(int(l)) }
+
+func TestRegisterTypeConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		RegisterStringEnum(func(s string) (testLevel, error) {
+			l, err := strconv.Atoi(s)
+			return testLevel(l), err
+		})
+	}()
+	for range 10 {
+		if _, err := InsertArgs(testAccount{1, statusActive}); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Wait()
+
+	if !isRegisteredType(reflect.TypeFor[testLevel]()) {
+		t.Error("testLevel type is not registered")
+	}
+}
+
+// testNumbers is the tests struct with numeric fields.
+type testNumbers struct {
+	I int     `db:"i"`
+	U uint8   `db:"u"`
+	F float64 `db:"f"`
+}
+
+func TestNumbersFromBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		i, u, f any
+		want    testNumbers
+		wantErr bool
+	}{
+		{"text protocol values", []byte("42"), []byte("7"), []byte("3.14"),
+			testNumbers{42, 7, 3.14}, false},
+		{"negative int", []byte("-42"), []byte("0"), []byte("-1e3"),
+			testNumbers{-42, 0, -1000}, false},
+		{"binary protocol values", int64(42), int64(7), 3.14,
+			testNumbers{42, 7, 3.14}, false},
+		{"invalid int", []byte("4x2"), []byte("7"), []byte("3.14"),
+			testNumbers{}, true},
+		{"uint overflow", []byte("42"), []byte("256"), []byte("3.14"),
+			testNumbers{}, true},
+		{"negative uint", []byte("42"), []byte("-1"), []byte("3.14"),
+			testNumbers{}, true},
+		{"invalid float", []byte("42"), []byte("7"), []byte("pi"),
+			testNumbers{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var row testNumbers
+			i, u, f := tt.i, tt.u, tt.f
+			err := ArgsAppay(&row, []any{&i, &u, &f})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if row != tt.want {
+				t.Errorf("got %+v, want %+v", row, tt.want)
+			}
+		})
+	}
+}
+
+// jsonArray is the tests array codec value which stores the slice as JSON
+// text, like pq.Array stores it as Postgres array literal.
+type jsonArray struct{ a any }
+
+func (j jsonArray) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.a)
+	return string(b), err
+}
+
+func (j jsonArray) Scan(src any) error {
+	s, err := stringValue(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), j.a)
+}
+
+// testTagged is the tests struct with the array field.
+type testTagged struct {
+	ID   int64    `db:"id"`
+	Tags []string `db:"tags" db_type:"array"`
+}
+
+func TestArray(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	// Array column type is the element type array
+	SetDialect(Postgres)
+	stmt, err := Table[testTagged]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS testtagged (id integer, " +
+		"tags text[]);"; stmt != want {
+		t.Errorf("got %q, want %q", stmt, want)
+	}
+
+	tests := []struct {
+		name    string
+		codec   bool
+		tags    []string
+		want    any // Written value
+		wantErr bool
+	}{
+		{"three elements", true, []string{"a", "b,c", `"d"`},
+			`["a","b,c","\"d\""]`, false},
+		{"empty array", true, []string{}, "[]", false},
+		{"NULL array", true, nil, nil, false},
+		{"no codec", false, []string{"a"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RegisterArrayCodec(nil)
+			if tt.codec {
+				RegisterArrayCodec(func(a any) ArrayValue {
+					return jsonArray{a}
+				})
+			}
+			t.Cleanup(func() { RegisterArrayCodec(nil) })
+
+			// Write the row
+			args, err := InsertArgs(testTagged{1, tt.tags})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if args[1] != tt.want {
+				t.Fatalf("got written value %#v, want %#v", args[1], tt.want)
+			}
+
+			// Read the written value back
+			var row testTagged
+			id, src := any(int64(1)), args[1]
+			if err = ArgsAppay(&row, []any{&id, &src}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row.Tags, tt.tags) {
+				t.Errorf("got tags %#v, want %#v", row.Tags, tt.tags)
+			}
+		})
+	}
+}
+
+// testFlags is the tests struct with the bool field.
+type testFlags struct {
+	ID     int64 `db:"id"`
+	Active bool  `db:"active"`
+}
+
+func TestBoolScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    bool
+		wantErr bool
+	}{
+		{"bool", true, true, false},
+		{"int64 one", int64(1), true, false},
+		{"int64 zero", int64(0), false, false},
+		{"bit byte one", []byte{1}, true, false},
+		{"bit byte zero", []byte{0}, false, false},
+		{"text byte one", []byte("1"), true, false},
+		{"text byte zero", []byte("0"), false, false},
+		{"string true", "true", true, false},
+		{"string false", "false", false, false},
+		{"NULL", nil, false, false},
+		{"invalid text", "yes", false, true},
+		{"unsupported type", 1.5, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := testFlags{Active: !tt.want}
+			id, src := any(int64(1)), tt.src
+			err := ArgsAppay(&row, []any{&id, &src})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && row.Active != tt.want {
+				t.Errorf("got %v, want %v", row.Active, tt.want)
+			}
+		})
+	}
+}
+
+// testChannel is the tests struct with the unsupported field type.
+type testChannel struct {
+	ID     int64    `db:"id"`
+	Events chan int `db:"events"`
+}
+
+// testComplex is the tests struct with the unsupported field type.
+type testComplex struct {
+	ID    int64      `db:"id"`
+	Value complex128 `db:"value"`
+}
+
+func TestUnsupportedTypeError(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name      string
+		fn        func() error
+		wantField string
+		wantType  reflect.Type
+	}{
+		{"table chan field", func() error {
+			_, err := Table[testChannel]()
+			return err
+		}, "Events", reflect.TypeFor[chan int]()},
+		{"insert args chan field", func() error {
+			_, err := InsertArgs(testChannel{Events: make(chan int)})
+			return err
+		}, "Events", reflect.TypeFor[chan int]()},
+		{"table complex field", func() error {
+			_, err := Table[testComplex]()
+			return err
+		}, "Value", reflect.TypeFor[complex128]()},
+		{"apply unsupported value", func() error {
+			var row testEvent
+			id, at := any(int64(1)), any(1.5)
+			return ArgsAppay(&row, []any{&id, &at})
+		}, "At", reflect.TypeFor[float64]()},
+		{"apply integer to unsupported field", func() error {
+			var row testComplex
+			id, value := any(int64(1)), any(int64(2))
+			return ArgsAppay(&row, []any{&id, &value})
+		}, "Value", reflect.TypeFor[int64]()},
+		{"apply bytes to unsupported field", func() error {
+			var row testComplex
+			id, value := any(int64(1)), any([]byte("2"))
+			return ArgsAppay(&row, []any{&id, &value})
+		}, "Value", reflect.TypeFor[[]byte]()},
+		{"apply returns first error", func() error {
+			var row testComplex
+			id, value := any(1.5), any(int64(2))
+			return ArgsAppay(&row, []any{&id, &value})
+		}, "ID", reflect.TypeFor[float64]()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			var ute *UnsupportedTypeError
+			if !errors.As(err, &ute) {
+				t.Fatalf("got error %v, want *UnsupportedTypeError", err)
+			}
+			if ute.Field != tt.wantField || ute.Type != tt.wantType {
+				t.Errorf("got field %s type %v, want field %s type %v",
+					ute.Field, ute.Type, tt.wantField, tt.wantType)
+			}
+		})
+	}
+}
+
+// testNulls is the tests struct with not pointer fields of each supported
+// kind, like the right table fields of the LEFT JOIN.
+type testNulls struct {
+	I      int        `db:"i"`
+	I8     int8       `db:"i8"`
+	U      uint16     `db:"u"`
+	F32    float32    `db:"f32"`
+	F      float64    `db:"f"`
+	B      bool       `db:"b"`
+	S      string     `db:"s"`
+	Bytes  []byte     `db:"bytes"`
+	At     time.Time  `db:"at"`
+	Status testStatus `db:"status"`
+	Ptr    *int64     `db:"ptr"`
+}
+
+func TestNullScan(t *testing.T) {
+	n := int64(5)
+	filled := testNulls{1, 2, 3, 4.5, 6.5, true, "s", []byte("b"),
+		time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), statusActive, &n}
+
+	tests := []struct {
+		name string
+		null int // Index of the NULL value, -1 for all values
+	}{
+		{"all NULL", -1},
+		{"int NULL", 0},
+		{"int8 NULL", 1},
+		{"uint NULL", 2},
+		{"float32 NULL", 3},
+		{"float64 NULL", 4},
+		{"bool NULL", 5},
+		{"string NULL", 6},
+		{"bytes NULL", 7},
+		{"time NULL", 8},
+		{"enum NULL", 9},
+		{"pointer NULL", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Driver values of the filled row with the NULL values
+			values := []any{int64(1), int64(2), int64(3), 4.5, 6.5, true, "s",
+				[]byte("b"), filled.At, "active", int64(5)}
+			args := make([]any, len(values))
+			for i := range values {
+				if tt.null < 0 || tt.null == i {
+					values[i] = nil
+				}
+				args[i] = &values[i]
+			}
+
+			// The NULL fields of the filled row become zero without error
+			row := filled
+			if err := ArgsAppay(&row, args); err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.ValueOf(row)
+			for i := range got.NumField() {
+				zero := got.Field(i).IsZero()
+				if null := tt.null < 0 || tt.null == i; zero != null {
+					t.Errorf("field %s: got %v, want zero %v",
+						got.Type().Field(i).Name, got.Field(i), null)
+				}
+			}
+		})
+	}
+}
+
+// testBlob is the tests struct with the bytes and string fields.
+type testBlob struct {
+	Data []byte `db:"data"`
+	Text string `db:"text"`
+}
+
+func TestBytesField(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     any
+		text     any
+		wantData []byte
+		wantText string
+	}{
+		{"string into bytes", "hello", "world", []byte("hello"), "world"},
+		{"bytes into string", []byte("hello"), []byte("world"),
+			[]byte("hello"), "world"},
+		{"empty string into bytes", "", "", []byte{}, ""},
+		{"NULL", nil, nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var row testBlob
+			data, text := tt.data, tt.text
+			if err := ArgsAppay(&row, []any{&data, &text}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row.Data, tt.wantData) {
+				t.Errorf("got data %#v, want %#v", row.Data, tt.wantData)
+			}
+			if row.Text != tt.wantText {
+				t.Errorf("got text %q, want %q", row.Text, tt.wantText)
+			}
+
+			// The named scan sets the same values
+			var named testBlob
+			if err := ArgsAppayNamed(&named, []string{"text", "data"},
+				[]any{&text, &data}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(named, row) {
+				t.Errorf("got named %+v, want %+v", named, row)
+			}
+		})
+	}
+}
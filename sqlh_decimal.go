@@ -0,0 +1,42 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Decimal numbers.
+
+package sqlh
+
+import (
+	"database/sql/driver"
+	"strconv"
+)
+
+// Decimal is the exact decimal number, f.e. money amount, kept as text.
+//
+// Use it for the DECIMAL and NUMERIC columns instead of float64 which loses
+// precision. The column type should be set with db_type tag, f.e.:
+//
+//	Amount sqlh.Decimal `db:"amount" db_type:"decimal(10,2)"`
+//
+// The decimal values returned by the drivers as text are set as is, and the
+// values returned as numbers (f.e. by SQLite) are formatted without exponent.
+type Decimal string
+
+// Value implements the driver.Valuer interface. The empty decimal is written
+// as NULL.
+func (d Decimal) Value() (driver.Value, error) {
+	if d == "" {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+// Float64 returns the decimal as float64 number.
+func (d Decimal) Float64() (float64, error) {
+	return strconv.ParseFloat(string(d), 64)
+}
+
+// String returns the decimal text.
+func (d Decimal) String() string {
+	return string(d)
+}
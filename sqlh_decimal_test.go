@@ -0,0 +1,123 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// payment is the tests struct with the decimal field.
+type payment struct {
+	ID     int64   `db:"id" db_key:"primary key"`
+	Amount Decimal `db:"amount" db_type:"decimal(10,2)"`
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Decimal
+	}{
+		{"fraction", "1234.56"},
+		{"small fraction", "0.1"},
+		{"negative", "-99.99"},
+		{"integer", "100"},
+		{"zero", "0"},
+		{"empty is NULL", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[payment](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, payment{1, tt.amount}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Get[payment](db, Eq("id", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Amount != tt.amount {
+				t.Errorf("got amount %q, want %q", got.Amount, tt.amount)
+			}
+		})
+	}
+
+	// The column type is the db_type tag
+	stmt, err := query.Table[payment]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt, "amount decimal(10,2)") {
+		t.Errorf("got %q, want decimal(10,2) amount column", stmt)
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any // Driver value
+		want Decimal
+	}{
+		{"text protocol bytes", []byte("12345678901234567890.12"),
+			"12345678901234567890.12"},
+		{"string", "1234.56", "1234.56"},
+		{"float without exponent", 1e21, "1000000000000000000000"},
+		{"float fraction", 1234.56, "1234.56"},
+		{"integer", int64(42), "42"},
+		{"NULL", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := payment{Amount: "old"}
+			id, src := any(int64(1)), tt.src
+			if err := query.ArgsAppay(&row, []any{&id, &src}); err != nil {
+				t.Fatal(err)
+			}
+			if row.Amount != tt.want {
+				t.Errorf("got %q, want %q", row.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalMethods(t *testing.T) {
+	tests := []struct {
+		name      string
+		d         Decimal
+		wantValue driver.Value
+		wantFloat float64
+		wantErr   bool
+	}{
+		{"number", "1234.56", "1234.56", 1234.56, false},
+		{"empty", "", nil, 0, true},
+		{"not number", "abc", "abc", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.d.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.wantValue {
+				t.Errorf("got value %#v, want %#v", v, tt.wantValue)
+			}
+			f, err := tt.d.Float64()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if f != tt.wantFloat {
+				t.Errorf("got float %v, want %v", f, tt.wantFloat)
+			}
+			if tt.d.String() != string(tt.d) {
+				t.Errorf("got string %q, want %q", tt.d.String(), tt.d)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Database driver errors helper functions.
+
+package sqlh
+
+import (
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Retry function parameters set by SetRetry.
+var (
+	retryAttempts   int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+)
+
+// SetRetry sets the Retry function parameters: the maximum number of attempts,
+// the delay before the second attempt which is doubled before each next
+// attempt, and the maximum delay. The defaults are 5 attempts, 10ms backoff and
+// 1s maximum backoff.
+func SetRetry(attempts int, backoff, maxBackoff time.Duration) {
+	retryAttempts, retryBackoff, retryMaxBackoff = attempts, backoff, maxBackoff
+}
+
+// Retry calls the fn function and retries it while it returns the lock timeout
+// or serialization failure error, see IsLockTimeout and IsSerializationFailure.
+// Other errors, f.e. constraint violations, are returned immediately.
+//
+// The delay between attempts grows exponentially up to the maximum backoff,
+// see SetRetry. The function returns the last fn error if all attempts fail.
+//
+// Example:
+//
+//	err := sqlh.Retry(func() error {
+//		return sqlh.Insert(db, row)
+//	})
+func Retry(fn func() error) (err error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= retryAttempts ||
+			!(IsLockTimeout(err) || IsSerializationFailure(err)) {
+			return
+		}
+
+		// Wait before next attempt
+		time.Sleep(backoff)
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+}
+
+// driverError contains the database driver error codes.
+type driverError struct {
+	sqlState string // SQLSTATE code (Postgres drivers)
+	mysql    int    // MySQL error number
+	sqlite   int    // SQLite extended result code
+}
+
+// IsDuplicateKey returns true if the err is the database driver unique or
+// primary key constraint violation error: SQLite SQLITE_CONSTRAINT_UNIQUE and
+// SQLITE_CONSTRAINT_PRIMARYKEY, MySQL 1062 and Postgres 23505.
+func IsDuplicateKey(err error) bool {
+	return isDriverError(err, func(e driverError) bool {
+		return e.sqlState == "23505" || e.mysql == 1062 ||
+			e.sqlite == 2067 || e.sqlite == 1555
+	})
+}
+
+// IsLockTimeout returns true if the err is the database driver lock error:
+// SQLite SQLITE_BUSY and SQLITE_LOCKED, MySQL 1205 (lock wait timeout) and
+// Postgres 55P03 (lock not available).
+func IsLockTimeout(err error) bool {
+	return isDriverError(err, func(e driverError) bool {
+		return e.sqlState == "55P03" || e.mysql == 1205 ||
+			e.sqlite&0xff == 5 || e.sqlite&0xff == 6
+	})
+}
+
+// IsSerializationFailure returns true if the err is the database driver
+// transaction serialization error which should be retried: MySQL 1213
+// (deadlock) and Postgres 40001 (serialization failure) and 40P01 (deadlock).
+func IsSerializationFailure(err error) bool {
+	return isDriverError(err, func(e driverError) bool {
+		return e.sqlState == "40001" || e.sqlState == "40P01" ||
+			e.mysql == 1213
+	})
+}
+
+// isDriverError returns true if any of the database driver errors in the err
+// chain matches the match function.
+//
+// The driver errors are detected without importing the drivers packages:
+// by the SQLState method (pgx, lib/pq), by the Number field (go-sql-driver
+// mysql), by the ExtendedCode and Code fields (mattn go-sqlite3), by the Code
+// method (modernc sqlite) and by the Code string field (lib/pq).
+func isDriverError(err error, match func(e driverError) bool) bool {
+	for _, e := range unwrapAll(err) {
+		if d, ok := newDriverError(e); ok && match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDriverError returns the database driver error codes of the err error. It
+// returns false if the err is not the known database driver error.
+func newDriverError(err error) (d driverError, ok bool) {
+
+	// Errors with methods
+	if e, is := err.(interface{ SQLState() string }); is {
+		d.sqlState, ok = e.SQLState(), true
+		return
+	}
+	if e, is := err.(interface{ Code() int }); is {
+		d.sqlite, ok = e.Code(), true
+		return
+	}
+
+	// Errors with fields
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	field := func(name string, kind ...reflect.Kind) (reflect.Value, bool) {
+		f := v.FieldByName(name)
+		return f, f.IsValid() && slices.Contains(kind, f.Kind())
+	}
+	uints := []reflect.Kind{reflect.Uint16, reflect.Int, reflect.Int32}
+	if f, is := field("Number", uints...); is {
+		d.mysql, ok = intValue(f), true
+	} else if f, is := field("ExtendedCode", uints...); is {
+		d.sqlite, ok = intValue(f), true
+	} else if f, is := field("Code", uints...); is {
+		d.sqlite, ok = intValue(f), true
+	} else if f, is := field("Code", reflect.String); is {
+		d.sqlState, ok = f.String(), true
+	}
+
+	return
+}
+
+// intValue returns the integer or unsigned integer value v as int.
+func intValue(v reflect.Value) int {
+	if v.CanUint() {
+		return int(v.Uint())
+	}
+	return int(v.Int())
+}
+
+// unwrapAll returns the err and all errors wrapped by it.
+func unwrapAll(err error) (errs []error) {
+	if err == nil {
+		return
+	}
+	errs = append(errs, err)
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		errs = append(errs, unwrapAll(e.Unwrap())...)
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			errs = append(errs, unwrapAll(err)...)
+		}
+	}
+	return
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The simulated database drivers errors.
+type (
+	pgxError     struct{ code string }   // pgx: SQLState method
+	pqError      struct{ Code string }   // lib/pq: Code string field
+	mysqlError   struct{ Number uint16 } // go-sql-driver/mysql
+	moderncError struct{ code int }      // modernc sqlite: Code method
+	unknownError struct{ Code float64 }  // not a driver error
+)
+
+func (e pgxError) Error() string     { return "pgx " + e.code }
+func (e pgxError) SQLState() string  { return e.code }
+func (e *pqError) Error() string     { return "pq " + e.Code }
+func (e *mysqlError) Error() string  { return fmt.Sprint("mysql ", e.Number) }
+func (e moderncError) Error() string { return fmt.Sprint("sqlite ", e.code) }
+func (e moderncError) Code() int     { return e.code }
+func (e unknownError) Error() string { return "unknown" }
+
+func TestDriverErrors(t *testing.T) {
+
+	// Real SQLite driver duplicate key error
+	db := openTestDB(t)
+	sqliteDup := Insert(db, testUsers[0])
+	if sqliteDup == nil {
+		t.Fatal("duplicate insert succeeded")
+	}
+
+	tests := []struct {
+		name          string
+		err           error
+		duplicate     bool
+		lock          bool
+		serialization bool
+	}{
+		{"sqlite duplicate", sqliteDup, true, false, false},
+		{"wrapped sqlite duplicate", fmt.Errorf("insert: %w", sqliteDup),
+			true, false, false},
+		{"pgx unique violation", pgxError{"23505"}, true, false, false},
+		{"pgx serialization", pgxError{"40001"}, false, false, true},
+		{"pgx deadlock", pgxError{"40P01"}, false, false, true},
+		{"pgx lock not available", pgxError{"55P03"}, false, true, false},
+		{"pq unique violation", &pqError{"23505"}, true, false, false},
+		{"mysql duplicate", &mysqlError{1062}, true, false, false},
+		{"mysql lock wait", &mysqlError{1205}, false, true, false},
+		{"mysql deadlock", &mysqlError{1213}, false, false, true},
+		{"modernc busy", moderncError{5}, false, true, false},
+		{"modernc busy snapshot", moderncError{517}, false, true, false},
+		{"modernc locked", moderncError{6}, false, true, false},
+		{"modernc primary key", moderncError{1555}, true, false, false},
+		{"joined errors", errors.Join(errors.New("other"),
+			&mysqlError{1062}), true, false, false},
+		{"unknown error", unknownError{23505}, false, false, false},
+		{"nil pointer error", (*pqError)(nil), false, false, false},
+		{"plain error", errors.New("23505"), false, false, false},
+		{"nil", nil, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDuplicateKey(tt.err); got != tt.duplicate {
+				t.Errorf("got IsDuplicateKey %v, want %v", got, tt.duplicate)
+			}
+			if got := IsLockTimeout(tt.err); got != tt.lock {
+				t.Errorf("got IsLockTimeout %v, want %v", got, tt.lock)
+			}
+			if got := IsSerializationFailure(tt.err); got != tt.serialization {
+				t.Errorf("got IsSerializationFailure %v, want %v", got,
+					tt.serialization)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+	SetRetry(3, 0, 0)
+
+	errOther := errors.New("other")
+
+	tests := []struct {
+		name         string
+		errs         []error // Errors returned by the attempts
+		wantAttempts int
+		wantErr      error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"retry lock", []error{moderncError{5}, nil}, 2, nil},
+		{"retry serialization", []error{pgxError{"40001"},
+			&mysqlError{1213}, nil}, 3, nil},
+		{"attempts exhausted", []error{moderncError{5}, moderncError{5},
+			moderncError{5}, nil}, 3, moderncError{5}},
+		{"duplicate not retried", []error{&mysqlError{1062}, nil}, 1,
+			&mysqlError{1062}},
+		{"other error not retried", []error{errOther, nil}, 1, errOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Retry(func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts,
+					tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryBusy(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+	SetRetry(50, time.Millisecond, 10*time.Millisecond)
+
+	// Two connections to the same database file without busy timeout
+	path := filepath.Join(t.TempDir(), "test.db")
+	open := func() *sql.DB {
+		db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	db1, db2 := open(), open()
+	if err := CreateTable[testUser](db1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock the database with the write transaction of first connection
+	tx, err := db1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = InsertTx(tx, testUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second connection write fails with busy error
+	err = Insert(db2, testUsers[1])
+	if !IsLockTimeout(err) {
+		t.Fatalf("got error %v, want lock timeout", err)
+	}
+
+	// The retried write succeeds after the transaction is committed
+	attempts := 0
+	time.AfterFunc(20*time.Millisecond, func() { tx.Commit() })
+	err = Retry(func() error {
+		attempts++
+		return Insert(db2, testUsers[1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts < 2 {
+		t.Errorf("got %d attempts, want retries", attempts)
+	}
+
+	// The constraint error is not retried
+	attempts = 0
+	err = Retry(func() error {
+		attempts++
+		return Insert(db2, testUsers[1])
+	})
+	if !IsDuplicateKey(err) || attempts != 1 {
+		t.Errorf("got error %v after %d attempts, want duplicate key after 1",
+			err, attempts)
+	}
+}
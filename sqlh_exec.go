@@ -8,13 +8,66 @@
 package sqlh
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kirill-scherba/sqlh/query"
 )
 
-var numRows = 10 // number of rows to get in select query
+// defaultNumRows is the default number of rows to get in select query. It is
+// accessed atomically, so it may be changed while the List functions are
+// called concurrently.
+var defaultNumRows atomic.Int64
+
+func init() { ResetDefaults() }
+
+// querier is the interface implemented by *sql.DB and *sql.Tx used to execute
+// select queries.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows,
+		error)
+}
+
+// ErrMultipleRowsFound is returned by the Get functions if more than one row
+// matches the where conditions.
+var ErrMultipleRowsFound = errors.New("multiple rows found")
+
+// ErrWhereClauseRequired is returned by the Get and Delete functions if they
+// are called without where conditions.
+var ErrWhereClauseRequired = errors.New("the where clause is required")
+
+// ErrLongInList is returned by the List functions if the IN list longer than
+// query.MaxInParams is used with the order, the position or the number of rows.
+// Such list is split into chunks selected with separate statements, so it may
+// be used to select all matching rows only.
+var ErrLongInList = errors.New(
+	"long IN list can't be used with order, offset or limit")
+
+// NotFoundError is returned by Get function when the row is not found in the
+// Table database table. It matches sql.ErrNoRows in errors.Is function.
+type NotFoundError struct {
+	Table string
+}
+
+// Error returns the error message.
+func (e *NotFoundError) Error() string {
+	return e.Table + " not found"
+}
+
+// Is reports whether the target error is sql.ErrNoRows.
+func (e *NotFoundError) Is(target error) bool {
+	return target == sql.ErrNoRows
+}
 
 // UpdateAttr struct contains row and where condition and used in Update
 // function as attrs parameter.
@@ -27,28 +80,159 @@ type UpdateAttr[T any] struct {
 	Wheres []Where
 }
 
-// Where struct contains where condition as field and value.
-type Where struct {
+// ListAttr is the List functions attribute: Where, Limit, Offset, Lock,
+// Orders, Projection, GroupColumns, DistinctColumns, Alias or SetName. It is
+// used by the ListAttrs, ListRowsAttrs and ListContextAttrs functions and
+// other functions which select rows with attributes, f.e. ListRange and
+// ListPage.
+type ListAttr interface {
+	isListAttr()
+}
+
+func (Limit) isListAttr()           {}
+func (Offset) isListAttr()          {}
+func (Lock) isListAttr()            {}
+func (Orders) isListAttr()          {}
+func (Projection) isListAttr()      {}
+func (GroupColumns) isListAttr()    {}
+func (DistinctColumns) isListAttr() {}
+func (Alias) isListAttr()           {}
+func (SetName) isListAttr()         {}
+
+// Limit is the List functions attribute which sets number of rows to get. It
+// overrides the numRows value. Limit(0) gets all rows.
+type Limit int
+
+// Offset is the List functions attribute which sets number of rows to skip
+// before starting to get rows. It overrides the previous parameter value.
+type Offset int
 
-	// Database table field Name and Condition Operator, f.e. "id="
-	// 	=	Equal
-	// 	>	Greater than
-	// 	<	Less than
-	// 	>=	Greater than or equal
-	// 	<=	Less than or equal
-	// 	<>	Not equal. In some versions of SQL it may be written as !=
-	// 	BETWEEN	Between a certain range
-	// 	LIKE	Search for a pattern
-	// 	IN	To specify multiple possible values for a column
-	Field string
+// Lock is the List functions attribute which sets the row locking clause,
+// f.e. "FOR UPDATE". Use it inside transaction to lock selected rows. It is
+// omitted if current dialect does not support row locking (SQLite).
+type Lock string
 
-	// Field value
-	Value any
+// ForUpdate returns the "FOR UPDATE" row locking List functions attribute.
+func ForUpdate() Lock { return "FOR UPDATE" }
+
+// ForShare returns the "FOR SHARE" row locking List functions attribute.
+func ForShare() Lock { return "FOR SHARE" }
+
+// Order defines the ORDER BY column and direction.
+type Order struct {
+	Col  string // Database column name
+	Desc bool   // Descending order
 }
 
-// SetNumRows sets numer of rows in List function.
+// Orders is the List functions attribute which sets the ORDER BY clause
+// instead of the orderBy parameter. Create it with the OrderBy function.
+type Orders []Order
+
+// OrderBy returns the List functions attribute which sets the ORDER BY clause
+// from the given orders, f.e.:
+//
+//	sqlh.OrderBy(sqlh.Order{"created_at", true}, sqlh.Order{"name", false})
+//
+// produces "ORDER BY created_at DESC, name ASC". The columns are validated
+// against the T struct database fields and are qualified with the Alias
+// attribute if it is set. The table qualified columns, f.e. "b.amount" in
+// Join2, are added as is.
+func OrderBy(orders ...Order) Orders { return orders }
+
+// Projection is the List functions attribute which sets the selected columns.
+// Create it with the Project function.
+type Projection []string
+
+// Project returns the List functions attribute which selects only the given
+// columns instead of all T struct database fields. The columns are validated
+// against the T struct database fields. The struct fields which are not
+// selected are left zero.
+//
+// The column may be the aggregate expression with alias, the alias must be the
+// T struct database field, f.e. to select the orders totals per user:
+//
+//	type UserTotal struct {
+//		UserID int     `db:"user_id"`
+//		Cnt    int     `db:"cnt"`
+//		Total  float64 `db:"total"`
+//	}
+//	sqlh.ListAttrs[UserTotal](db, 0, "", sqlh.SetName("orders"),
+//		sqlh.Project("user_id", "count(*) AS cnt", "sum(amount) AS total"),
+//		sqlh.GroupBy("user_id"))
+//
+// The expressions are added to the statement as is, so they should not
+// contain user input.
+func Project(columns ...string) Projection { return columns }
+
+// GroupColumns is the List functions attribute which sets the GROUP BY
+// columns. Create it with the GroupBy function.
+type GroupColumns []string
+
+// GroupBy returns the List functions attribute which groups the selected rows
+// by the given columns, see Project.
+func GroupBy(columns ...string) GroupColumns { return columns }
+
+// DistinctColumns is the List functions attribute which sets the DISTINCT ON
+// columns. Create it with the DistinctOn function.
+type DistinctColumns []string
+
+// DistinctOn returns the List functions attribute which selects only the first
+// row of each set of rows with equal values of the given columns, f.e. the
+// latest order of each user:
+//
+//	sqlh.ListAttrs[Order](db, 0, "", sqlh.DistinctOn("user_id"),
+//		sqlh.OrderBy(sqlh.Order{"user_id", false}, sqlh.Order{"created", true}))
+//
+// The order by must start with these columns. It is supported by Postgres
+// only, the List functions return an error in other dialects.
+func DistinctOn(columns ...string) DistinctColumns { return columns }
+
+// Alias is the List functions attribute which sets the table alias, f.e.
+// sqlh.Alias("t") selects "SELECT t.* from users t". The Where conditions
+// fields which start with not qualified T struct column name are qualified
+// with the alias, f.e. Where{"name=", v} becomes "t.name = ?".
+type Alias string
+
+// SetName is the List functions attribute which sets the database table name
+// instead of the T struct name based table name, f.e. to read from the
+// partition table like "logs_2024_06".
+type SetName string
+
+// SetNumRows sets the default number of rows in List function. The n must be
+// 1 or greater, the smaller values are ignored and the default is not changed
+// (use the Limit(0) attribute to get all rows). It is safe for concurrent use,
+// but it changes the default for all callers, so use the ListRows function or
+// the Limit attribute to set number of rows per call.
 func SetNumRows(n int) {
-	numRows = n
+	if n < 1 {
+		return
+	}
+	defaultNumRows.Store(int64(n))
+}
+
+// GetNumRows returns the default number of rows in List function set by
+// SetNumRows.
+func GetNumRows() int {
+	return int(defaultNumRows.Load())
+}
+
+// ResetDefaults restores the sqlh and query packages configuration to the
+// defaults: the number of rows in List function, the Retry parameters, no query
+// hook and the query package settings, see query.ResetDefaults. It may be used
+// in tests cleanup, so the configuration changed by one test does not affect
+// others:
+//
+//	t.Cleanup(sqlh.ResetDefaults)
+func ResetDefaults() {
+	defaultNumRows.Store(10)
+	SetRetry(5, 10*time.Millisecond, time.Second)
+	SetQueryHook(nil)
+	query.ResetDefaults()
+}
+
+// Columns returns the T struct database field names, see query.Columns.
+func Columns[T any](includeAuto bool) []string {
+	return query.Columns[T](includeAuto)
 }
 
 // Insert inserts rows into the T database table.
@@ -57,46 +241,293 @@ func SetNumRows(n int) {
 // corresponding database table. The function starts a transaction and prepares
 // an insert statement. Each row is then inserted in a loop. If any error occurs,
 // the transaction is rolled back. Otherwise, the transaction is committed.
+//
+// The autoincrement fields are inserted only if they are set (not zero) in the
+// row, otherwise the database generates their values.
+//
+// If the T struct implements the BeforeInserter interface its BeforeInsert
+// method is called for each row before insert. The time.Time fields tagged
+// with db_auto:"created" are set to current time if they are zero.
+//
+// The T type may be a struct or a pointer to struct, so the []*T rows are
+// inserted without dereferencing. The nil pointer rows return an error.
 func Insert[T any](db *sql.DB, rows ...T) (err error) {
+	return InsertName(db, query.Name[T](), rows...)
+}
 
-	// Create insert statement
-	insertStmt, err := query.Insert[T]()
-	if err != nil {
+// InsertSlice inserts the rows slice into T database table. It works the same
+// way as the Insert function: all rows are inserted in one transaction with
+// one prepared statement. The empty slice is not inserted and returns nil.
+func InsertSlice[T any](db *sql.DB, rows []T) (err error) {
+	if len(rows) == 0 {
+		return
+	}
+	return insertContext(context.Background(), db, query.Name[T](), rows...)
+}
+
+// InsertName inserts rows into the database table with the given name instead
+// of the T struct name based table name, f.e. into the partition table like
+// "logs_2024_06". It works the same way as the Insert function.
+func InsertName[T any](db *sql.DB, table string, rows ...T) (err error) {
+	return insertContext(context.Background(), db, table, rows...)
+}
+
+// InsertConcurrent inserts rows into T database table using the given number of
+// concurrent workers. The rows are split into the workers parts and each
+// worker inserts its part in its own transaction the same way as the Insert
+// function.
+//
+// The number of workers is limited by the number of rows and by the db
+// maximum number of open connections if it is set, so the workers do not
+// exhaust the connections pool. The first worker error cancels the other
+// workers transactions and is returned. The parts of the workers which are
+// already committed stay inserted.
+func InsertConcurrent[T any](db *sql.DB, rows []T, workers int) (err error) {
+
+	// Limit number of workers
+	if maxOpen := db.Stats().MaxOpenConnections; maxOpen > 0 {
+		workers = min(workers, maxOpen)
+	}
+	workers = min(max(workers, 1), len(rows))
+	if workers == 0 {
 		return
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start workers, each worker inserts its part of rows
+	var wg sync.WaitGroup
+	var once sync.Once
+	table := query.Name[T]()
+	size := (len(rows) + workers - 1) / workers
+	for start := 0; start < len(rows); start += size {
+		part := rows[start:min(start+size, len(rows))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e := insertContext(ctx, db, table, part...); e != nil {
+				// Save the first error and cancel other workers
+				once.Do(func() { err = e; cancel() })
+			}
+		}()
+	}
+	wg.Wait()
+
+	return
+}
+
+// insertContext inserts rows into the table database table in the transaction
+// started with the given context.
+func insertContext[T any](ctx context.Context, db *sql.DB, table string,
+	rows ...T) (err error) {
+
 	// Start transaction
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
 
-	// Create prepared insert statement
-	stmt, err := tx.Prepare(insertStmt)
-	if err != nil {
+	// Insert rows
+	if err = insertTx(tx, table, rows...); err != nil {
 		tx.Rollback()
 		return
 	}
-	defer stmt.Close()
+
+	// Commit transaction and return
+	err = tx.Commit()
+	return
+}
+
+// insertTx inserts rows into the table database table within the given
+// transaction.
+func insertTx[T any](tx *sql.Tx, table string, rows ...T) (err error) {
+	_, err = insertRowsTx(tx, func(row T) (string, error) {
+		return query.InsertName(table, row)
+	}, rows...)
+	return
+}
+
+// insertRowsTx inserts rows within the given transaction using the insert
+// statements created by the insertStmt function for each row. It returns the
+// number of inserted rows reported by the database.
+func insertRowsTx[T any](tx *sql.Tx, insertStmt func(row T) (string, error),
+	rows ...T) (inserted int64, err error) {
+
+	// Prepared insert statements by statement text. The statement depends on
+	// the autoincrement fields set in the row
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
 
 	// Insert rows
-	for _, row := range rows {
+	for i, row := range rows {
+
+		// Check nil row before hooks, f.e. when the *T rows are inserted
+		if v := reflect.ValueOf(&row).Elem(); v.Kind() == reflect.Ptr &&
+			v.IsNil() {
+			return 0, fmt.Errorf("can't insert nil row %d", i)
+		}
+
+		// Call before insert hook
+		if err = beforeInsert(&row); err != nil {
+			return
+		}
+
+		// Set created timestamps
+		if err = query.AutoTime(&row, true); err != nil {
+			return
+		}
+
+		// Create insert statement for the row
+		rowStmt, err := insertStmt(row)
+		if err != nil {
+			return 0, err
+		}
+
+		// Create prepared insert statement
+		stmt, ok := stmts[rowStmt]
+		if !ok {
+			stmt, err = tx.Prepare(rowStmt)
+			if err != nil {
+				return 0, err
+			}
+			stmts[rowStmt] = stmt
+		}
+
 		// Get arguments from the row
-		args, err := query.Args(row)
+		args, err := query.InsertArgs(row)
 		if err != nil {
-			tx.Rollback()
-			return err
+			return 0, err
 		}
 		// Execute insert statement with arguments
-		_, err = stmt.Exec(args...)
+		res, err := stmt.Exec(args...)
 		if err != nil {
-			tx.Rollback()
-			return err
+			return 0, err
+		}
+
+		// Count inserted rows
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	return
+}
+
+// InsertOne inserts the row into T database table and returns the row with
+// the generated autoincrement field value.
+//
+// The generated value is got with the RETURNING clause if current dialect
+// supports it (Postgres), or with the sql.Result LastInsertId method. If the T
+// struct has no integer autoincrement field (f.e. it has composite or text
+// primary key), or the autoincrement field is already set in the row, the row
+// is returned unchanged. The hooks and created timestamps are processed the
+// same way as in the Insert function and are returned in the row too. The nil
+// pointer row returns an error. The pointer row is copied before the hooks, so
+// the caller's struct is not changed and the new pointer is returned.
+func InsertOne[T any](db *sql.DB, row T) (inserted T, err error) {
+
+	// Check nil row before hooks and copy the pointer row, f.e. when the *T
+	// row is inserted
+	if v := reflect.ValueOf(&row).Elem(); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			err = errors.New("can't insert nil row")
+			return
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+		row = c.Interface().(T)
+	}
+
+	// Call before insert hook
+	if err = beforeInsert(&row); err != nil {
+		return
+	}
+
+	// Set created timestamps
+	if err = query.AutoTime(&row, true); err != nil {
+		return
+	}
+
+	// Create insert statement and get arguments from the row
+	insertStmt, err := query.Insert(row)
+	if err != nil {
+		return
+	}
+	args, err := query.InsertArgs(row)
+	if err != nil {
+		return
+	}
+
+	// Insert row without getting autoincrement value
+	column, ok := query.AutoIncrementColumn[T]()
+	if ok {
+		if v, e := query.ColumnValue(row, column); e != nil ||
+			!reflect.ValueOf(v).IsZero() {
+			ok = false
+		}
+	}
+	if !ok {
+		_, err = db.Exec(insertStmt, args...)
+		return row, err
+	}
+
+	// Insert row and get autoincrement value
+	var id int64
+	if query.GetDialect().SupportsReturning {
+		err = db.QueryRow(query.Returning(insertStmt, column), args...).Scan(&id)
+	} else {
+		var res sql.Result
+		if res, err = db.Exec(insertStmt, args...); err == nil {
+			id, err = res.LastInsertId()
 		}
 	}
+	if err != nil {
+		return
+	}
+
+	// Set autoincrement field
+	if err = query.SetColumnValue(&row, column, id); err != nil {
+		return
+	}
+	inserted = row
+
+	return
+}
+
+// InsertOrIgnore inserts rows into T database table skipping the rows which
+// conflict with the existing rows by primary key or unique columns.
+//
+// It works the same way as the Insert function but uses the current dialect
+// insert or ignore statement, see query.InsertOrIgnore. It returns the number
+// of actually inserted rows, the ignored rows are not counted.
+func InsertOrIgnore[T any](db *sql.DB, rows ...T) (inserted int64, err error) {
+
+	// Start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	// Insert rows
+	inserted, err = insertRowsTx(tx, func(row T) (string, error) {
+		return query.InsertOrIgnore(row)
+	}, rows...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
 	// Commit transaction and return
-	err = tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return
 }
 
@@ -106,8 +537,21 @@ func Insert[T any](db *sql.DB, rows ...T) (err error) {
 // UpdateAttr contains row and where condition.
 // The function executes UPDATE statement for each UpdateAttr in the list.
 //
+// If the T struct implements the BeforeUpdater interface its BeforeUpdate
+// method is called for each row before update. The time.Time fields tagged
+// with db_auto:"updated" are set to current time, and the fields tagged with
+// db_auto:"created" are not updated.
+//
 // The function returns error if something failed during the update process.
 func Update[T any](db *sql.DB, attrs ...UpdateAttr[T]) (err error) {
+	return UpdateName(db, query.Name[T](), attrs...)
+}
+
+// UpdateName updates rows in the database table with the given name instead
+// of the T struct name based table name. It works the same way as the Update
+// function.
+func UpdateName[T any](db *sql.DB, table string, attrs ...UpdateAttr[T]) (
+	err error) {
 
 	// Start transaction
 	tx, err := db.Begin()
@@ -115,132 +559,220 @@ func Update[T any](db *sql.DB, attrs ...UpdateAttr[T]) (err error) {
 		return
 	}
 
+	// Update rows
+	if err = updateTx(tx, table, attrs...); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	// Commit transaction and return
+	err = tx.Commit()
+
+	return
+}
+
+// updateTx updates rows in the table database table within the given
+// transaction.
+func updateTx[T any](tx *sql.Tx, table string, attrs ...UpdateAttr[T]) (
+	err error) {
+
 	// Update rows
 	for _, attr := range attrs {
 
-		// Create where clause
-		var wheres []string
-		for _, where := range attr.Wheres {
-			wheres = append(wheres, where.Field)
+		// Call before update hook
+		if err = beforeUpdate(&attr.Row); err != nil {
+			return
+		}
+
+		// Set updated timestamps
+		if err = query.AutoTime(&attr.Row, false); err != nil {
+			return
+		}
+
+		// Prepare where clauses and arguments
+		clauses, whereArgs, err := whereClauses(attr.Wheres...)
+		if err != nil {
+			return err
 		}
 
 		// Create update statement
-		updateStmt, err := query.Update[T](wheres...)
+		updateStmt, err := query.UpdateClauses[T](table, clauses...)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 
 		// Create prepared update statement
 		stmt, err := tx.Prepare(updateStmt)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 		defer stmt.Close()
 
 		// Create struct attr.Row field values array
-		args, err := query.Args(attr.Row)
+		args, err := query.UpdateArgs(attr.Row)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 
 		// Add where conditions to args array
-		for _, where := range attr.Wheres {
-			args = append(args, where.Value)
-		}
+		args = append(args, whereArgs...)
 
 		// Execute update statement
 		_, err = stmt.Exec(args...)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
 
-	// Commit transaction and return
-	err = tx.Commit()
-
 	return
 }
 
-// Get returns a row from T database table.
+// UpdateByPK updates rows in T database table by their primary keys.
 //
-// The function takes a list of Where condition as input parameter.
-// The function executes SELECT statement with the given where conditions.
-// If the row is found, the function returns the row and nil as error.
-// If the row is not found, the function returns a default value for row and
-// an error with message "not found".
-// If multiple rows are found, the function returns a default value for row and
-// an error with message "multiple rows found".
-func Get[T any](db *sql.DB, wheres ...Where) (row T, err error) {
+// The primary key columns are the T struct fields tagged with db_key
+// containing "primary key". Each row is updated with the where condition
+// matching its primary key values. All rows are updated in one transaction.
+// The function returns an error if the T struct has no primary key.
+func UpdateByPK[T any](db *sql.DB, rows ...T) (err error) {
 
-	// Check if the where clause is required
-	if len(wheres) == 0 {
-		err = fmt.Errorf("the where clause is required")
+	// Get primary key columns
+	keys := query.PrimaryKeys[T]()
+	if len(keys) == 0 {
+		return fmt.Errorf("struct %s has no primary key", query.Name[T]())
+	}
+
+	// Make update attributes
+	attrs := make([]UpdateAttr[T], 0, len(rows))
+	for _, row := range rows {
+		attr := UpdateAttr[T]{Row: row}
+		for _, key := range keys {
+			value, err := query.ColumnValue(row, key)
+			if err != nil {
+				return err
+			}
+			attr.Wheres = append(attr.Wheres, Where{key + "=", value})
+		}
+		attrs = append(attrs, attr)
+	}
+
+	// Update rows
+	return Update(db, attrs...)
+}
+
+// UpdateFields updates only the cols columns of rows in T database table
+// matching the where conditions.
+//
+// The cols parameter is a list of database field names which values are taken
+// from the row, other columns are not changed. The function returns an error
+// if any of the cols is not a T struct database field.
+func UpdateFields[T any](db *sql.DB, row T, cols []string, wheres ...Where) (
+	err error) {
+
+	// Prepare where clauses and arguments
+	clauses, whereArgs, err := whereClauses(wheres...)
+	if err != nil {
 		return
 	}
 
-	// Get rows from database
-	rows, _, err := List[T](db, 0, "", wheres...)
+	// Create update statement
+	updateStmt, err := query.UpdateFieldsClauses[T](cols, clauses...)
 	if err != nil {
 		return
 	}
 
-	// Check if the row is found
-	switch len(rows) {
-	case 0:
-		err = fmt.Errorf("not found")
-	case 1:
-		row = rows[0]
-	default:
-		err = fmt.Errorf("multiple rows found")
+	// Create columns values array and add where conditions
+	args, err := query.ColumnsArgs(row, cols)
+	if err != nil {
+		return
 	}
+	args = append(args, whereArgs...)
 
+	// Execute update statement
+	_, err = db.Exec(updateStmt, args...)
 	return
 }
 
-// Delete deletes rows from the T database table.
+// Expression is the SQL expression with its placeholders arguments used to
+// set the column value in the UpdateExpr function. Create it with the Expr
+// function.
+type Expression struct {
+	Fragment string // SQL expression with "?" placeholders
+	Args     []any  // Placeholders arguments
+}
+
+// Expr returns the SQL expression with the placeholders arguments, f.e.
+// sqlh.Expr("count + ?", 1). The fragment is added to the statement as is and
+// should not contain user input.
+func Expr(fragment string, args ...any) Expression {
+	return Expression{fragment, args}
+}
+
+// UpdateExpr sets the columns of rows in T database table matching the where
+// conditions to the SQL expressions, f.e. to increment the counter atomically
+// without reading the row:
 //
-// The function takes a variadic list of Where conditions to specify which
-// rows to delete. It constructs a DELETE SQL statement with the given
-// conditions, starts a database transaction, prepares the DELETE statement,
-// and executes it. If any error occurs during the process, the transaction
-// is rolled back. Otherwise, the transaction is committed.
-func Delete[T any](db *sql.DB, wheres ...Where) (err error) {
+//	err := sqlh.UpdateExpr[Page](db,
+//		map[string]sqlh.Expression{"count": sqlh.Expr("count + ?", 1)},
+//		sqlh.Where{"id=", id},
+//	)
+//
+// produces "UPDATE page SET count = count + ? WHERE id = ?". The function
+// returns an error if any of the columns is not a T struct database field.
+func UpdateExpr[T any](db *sql.DB, sets map[string]Expression,
+	wheres ...Where) (err error) {
 
-	// Prepare where clauses and arguments
-	var whereArgs []any
-	var whereFields []string
-	for _, w := range wheres {
-		whereArgs = append(whereArgs, w.Value)
-		whereFields = append(whereFields, w.Field)
+	// Create set expressions
+	exprs := make(map[string]string, len(sets))
+	for col, expr := range sets {
+		exprs[col] = expr.Fragment
 	}
 
-	// Create delete statement
-	deleteStmt, err := query.Delete[T](whereFields...)
+	// Prepare where clauses and arguments
+	clauses, whereArgs, err := whereClauses(wheres...)
 	if err != nil {
 		return
 	}
 
-	// Start transaction
-	tx, err := db.Begin()
+	// Create update statement
+	updateStmt, err := query.UpdateExprClauses[T](exprs, clauses...)
 	if err != nil {
 		return
 	}
 
-	// Create prepared delete statement
-	stmt, err := db.Prepare(deleteStmt)
+	// Create expressions arguments in the statement columns order and add
+	// where conditions
+	var args []any
+	for _, col := range slices.Sorted(maps.Keys(sets)) {
+		args = append(args, sets[col].Args...)
+	}
+	args = append(args, whereArgs...)
+
+	// Execute update statement
+	_, err = db.Exec(updateStmt, args...)
+	return
+}
+
+// Set inserts or updates row in the T database table.
+//
+// The function selects rows with the given where conditions. If the row is
+// found it is updated with the same where conditions, otherwise the row is
+// inserted. If where conditions are not set the row is inserted. The function
+// executes all statements in one transaction.
+//
+// The attrs parameter is the list of Where conditions and the optional SetName
+// attribute which sets the database table name instead of the T struct name
+// based table name, f.e. to write to the partition table. Other attributes are
+// ignored.
+func Set[T any](db *sql.DB, row T, attrs ...ListAttr) (err error) {
+
+	// Start transaction
+	tx, err := db.Begin()
 	if err != nil {
-		tx.Rollback()
 		return
 	}
-	defer stmt.Close()
 
-	// Execute delete statement with where arguments
-	_, err = stmt.Exec(whereArgs...)
-	if err != nil {
+	// Insert or update row
+	if err = SetTx(tx, row, attrs...); err != nil {
 		tx.Rollback()
 		return
 	}
@@ -250,86 +782,1246 @@ func Delete[T any](db *sql.DB, wheres ...Where) (err error) {
 	return
 }
 
-// List returns rows from T database table.
+// SetTx inserts or updates row in the T database table within the given
+// transaction.
 //
-// The function takes a list of Where condition as input parameter.
-// The function executes SELECT statement with the given where conditions.
-// If the rows are found, the function returns the rows and nil as error.
-// If the rows are not found, the function returns a default value for rows and
-// an error with message "not found".
-func List[T any](db *sql.DB, previous int, orderBy string, wheres ...Where) (
-	rows []T, pagination int, err error) {
-
-	// Call ListRows function with numRows as number of rows
-	return ListRows[T](db, previous, orderBy, numRows, wheres...)
-}
-func ListRows[T any](db *sql.DB, previous int, orderBy string, numRows int, wheres ...Where) (
-	rows []T, pagination int, err error) {
-
-	var attr = &query.SelectAttr{}
-	var selectArgs []any
+// It works the same way as the Set function but does not begin and commit
+// transaction, so it may be combined with other operations in the caller's
+// transaction.
+func SetTx[T any](tx *sql.Tx, row T, attrs ...ListAttr) (err error) {
 
-	// Where clauses
-	for _, w := range wheres {
-		if w.Value == nil {
-			attr.Wheres = append(attr.Wheres, w.Field)
-			continue
+	// Get where conditions and table name
+	table := query.Name[T]()
+	var wheres []Where
+	for _, a := range attrs {
+		switch a := a.(type) {
+		case Where:
+			wheres = append(wheres, a)
+		case SetName:
+			table = string(a)
 		}
-		attr.Wheres = append(attr.Wheres, w.Field+"?")
-		selectArgs = append(selectArgs, w.Value)
 	}
 
-	// Order by
-	attr.OrderBy = orderBy
+	// Insert row if where conditions are not set
+	if len(wheres) == 0 {
+		return insertTx(tx, table, row)
+	}
 
-	// Limit and offset
-	attr.Paginator = &query.Paginator{
-		Offset: previous,
-		Limit:  numRows,
+	// Check if the row exists
+	rows, _, err := ListRowsAttrs[T](tx, 0, "", 1,
+		append(whereAttrs(wheres), SetName(table))...)
+	if err != nil {
+		return
+	}
+
+	// Insert or update row
+	if len(rows) == 0 {
+		return insertTx(tx, table, row)
+	}
+	return updateTx(tx, table, UpdateAttr[T]{Row: row, Wheres: wheres})
+}
+
+// Get returns a row from T database table.
+//
+// The function takes a list of Where condition as input parameter.
+// The function executes SELECT statement with the given where conditions.
+// If the row is found, the function returns the row and nil as error.
+// If the row is not found, the function returns a default value for row and
+// the *NotFoundError error which matches sql.ErrNoRows.
+// If multiple rows are found, the function returns a default value for row and
+// the ErrMultipleRowsFound error.
+func Get[T any](db querier, wheres ...Where) (row T, err error) {
+	return GetContext[T](context.Background(), db, wheres...)
+}
+
+// GetContext returns a row from T database table.
+//
+// It works the same way as the Get function but uses the given context to
+// execute the query.
+func GetContext[T any](ctx context.Context, db querier, wheres ...Where) (
+	row T, err error) {
+
+	// Check if the where clause is required
+	if len(wheres) == 0 {
+		err = ErrWhereClauseRequired
+		return
+	}
+
+	// Get rows from database, two rows are enough to find duplicates
+	rows, _, err := listRows[T](ctx, db, 0, "", 2, whereAttrs(wheres)...)
+	if err != nil {
+		return
+	}
+
+	// Check if the row is found
+	switch len(rows) {
+	case 0:
+		err = &NotFoundError{Table: query.Name[T]()}
+	case 1:
+		row = rows[0]
+	default:
+		err = ErrMultipleRowsFound
+	}
+
+	return
+}
+
+// GetInto gets a row from T database table into the dst struct.
+//
+// It works the same way as the Get function but scans the row into the given
+// struct instead of allocating a new one. Only the struct database fields are
+// set, so other fields keep their values. The dst struct is not changed if the
+// function returns an error.
+func GetInto[T any](db querier, dst *T, wheres ...Where) (err error) {
+
+	// Check if the where clause is required
+	if len(wheres) == 0 {
+		err = ErrWhereClauseRequired
+		return
+	}
+
+	// Create select statement, two rows are enough to find duplicates
+	selectStmt, selectArgs, err := listStatement[T](0, "", 2,
+		whereAttrs(wheres)...)
+	if err != nil {
+		return
+	}
+
+	sqlRows, err := db.QueryContext(context.Background(), selectStmt,
+		selectArgs...)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Check that the result set columns match the struct fields
+	columns, err := checkColumns[T](sqlRows, selectStmt)
+	if err != nil {
+		return
+	}
+
+	// Check if the row is found
+	if !sqlRows.Next() {
+		if err = sqlRows.Err(); err == nil {
+			err = &NotFoundError{Table: query.Name[T]()}
+		}
+		return
+	}
+
+	// Scan the row into a copy of dst to keep dst unchanged on error
+	row := *dst
+	if columns != nil {
+		err = scanNamed(sqlRows, columns, &row)
+	} else {
+		err = scanRow(sqlRows, &row)
+	}
+	if err != nil {
+		return
+	}
+
+	// Check if multiple rows are found
+	if sqlRows.Next() {
+		err = ErrMultipleRowsFound
+		return
+	}
+	if err = sqlRows.Err(); err != nil {
+		return
+	}
+	*dst = row
+
+	return
+}
+
+// GetByPK returns a row from T database table by the primary key value.
+//
+// The primary key column is taken from the T struct field with "primary key"
+// in the db_key tag, the struct should have exactly one such field. The row is
+// got with the GetInto function, so it returns the *NotFoundError error which
+// matches sql.ErrNoRows if the row is not found.
+func GetByPK[T any](db querier, id any) (row *T, err error) {
+
+	// Get primary key column
+	keys := query.PrimaryKeys[T]()
+	if len(keys) != 1 {
+		err = fmt.Errorf("struct %s should have one primary key field, got %d",
+			query.Name[T](), len(keys))
+		return
+	}
+
+	// Get the row
+	row = new(T)
+	if err = GetInto(db, row, Where{keys[0] + "=", id}); err != nil {
+		row = nil
+	}
+
+	return
+}
+
+// GetByIDs returns rows from T database table with the given ids in one query.
+//
+// The idCol parameter is the database column name of the id field. The
+// returned map is keyed by the id field values of the found rows. The numeric
+// and string ids are converted to the id field type, f.e. the int ids find the
+// rows of the int64 id field keyed by int64 values. Duplicate ids are selected
+// once, and ids without matching row are absent from the map. It returns an
+// error if the id or the id field type can't be the map key, f.e. []byte.
+func GetByIDs[T any](db *sql.DB, idCol string, ids []any) (
+	rowsMap map[any]T, err error) {
+
+	rowsMap = make(map[any]T)
+	if len(ids) == 0 {
+		return
+	}
+
+	// Get the id field type
+	zero, err := query.ColumnValue(new(T), idCol)
+	if err != nil {
+		return
+	}
+	idType := reflect.TypeOf(zero)
+	if !idType.Comparable() {
+		err = fmt.Errorf("id column %s of type %s can't be the map key",
+			idCol, idType)
+		return
+	}
+
+	// Normalize ids to the id field type and remove duplicate ids
+	var unique []any
+	seen := make(map[any]bool, len(ids))
+	for _, id := range ids {
+		if id, err = normalizeID(id, idType); err != nil {
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	// Get rows from database, the long ids list is split into chunks
+	rows, _, err := ListRows[T](db, 0, "", 0, Where{idCol + " IN ", unique})
+	if err != nil {
+		return
+	}
+
+	// Make rows map
+	for _, row := range rows {
+		id, err := query.ColumnValue(row, idCol)
+		if err != nil {
+			return nil, err
+		}
+		rowsMap[id] = row
+	}
+
+	return
+}
+
+// normalizeID returns the id converted to the idType if both are numeric or
+// both are strings, other ids are returned as is. It returns an error if the
+// id can't be the map key.
+func normalizeID(id any, idType reflect.Type) (any, error) {
+	v := reflect.ValueOf(id)
+	if !v.IsValid() {
+		return id, nil
+	}
+	if !v.Comparable() {
+		return nil, fmt.Errorf("id %v of type %T can't be the map key", id, id)
+	}
+	if v.Type() != idType && sameKindFamily(v.Kind(), idType.Kind()) {
+		return v.Convert(idType).Interface(), nil
+	}
+	return id, nil
+}
+
+// sameKindFamily returns true if both kinds are numeric or both are strings.
+func sameKindFamily(a, b reflect.Kind) bool {
+	numeric := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	return (numeric(a) && numeric(b)) ||
+		(a == reflect.String && b == reflect.String)
+}
+
+// Delete deletes rows from the T database table.
+//
+// The function takes a variadic list of Where conditions to specify which
+// rows to delete. It constructs a DELETE SQL statement with the given
+// conditions, starts a database transaction, prepares the DELETE statement,
+// and executes it. If any error occurs during the process, the transaction
+// is rolled back. Otherwise, the transaction is committed.
+//
+// The where conditions are required to prevent accidental deletion of all
+// rows, the function returns ErrWhereClauseRequired without them. Use the
+// DeleteAll function to delete all rows.
+func Delete[T any](db *sql.DB, wheres ...Where) (err error) {
+	return DeleteName[T](db, query.Name[T](), wheres...)
+}
+
+// DeleteAll deletes all rows from the T database table.
+func DeleteAll[T any](db *sql.DB) (err error) {
+	return deleteRows[T](db, query.Name[T]())
+}
+
+// DeleteName deletes rows from the database table with the given name instead
+// of the T struct name based table name. It works the same way as the Delete
+// function.
+//
+// The IN lists longer than query.MaxInParams are split into chunks deleted
+// with separate statements within the same transaction.
+func DeleteName[T any](db *sql.DB, table string, wheres ...Where) (err error) {
+
+	// Check if the where clause is required
+	if len(wheres) == 0 {
+		err = ErrWhereClauseRequired
+		return
+	}
+
+	return deleteRows[T](db, table, wheres...)
+}
+
+// deleteRows deletes rows matching the where conditions, or all rows without
+// them, from the database table with the given name.
+func deleteRows[T any](db *sql.DB, table string, wheres ...Where) (err error) {
+
+	// Split IN lists into chunks
+	sets, err := splitIn(wheres)
+	if err != nil {
+		return
+	}
+
+	// Start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	// Execute delete statement for each IN lists chunk
+	for _, set := range sets {
+
+		// Prepare where clauses and arguments
+		clauses, whereArgs, err := whereClauses(set...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Create delete statement
+		deleteStmt, err := query.DeleteClauses[T](table, clauses...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Execute delete statement with where arguments
+		if _, err = tx.Exec(deleteStmt, whereArgs...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction and return
+	err = tx.Commit()
+	return
+}
+
+// List returns rows from T database table.
+//
+// The function takes a list of Where conditions as input parameter.
+// The function executes SELECT statement with the given where conditions.
+// If the rows are found, the function returns the rows and nil as error.
+// If the rows are not found, the function returns a default value for rows and
+// an error with message "not found". Use the ListAttrs function to set other
+// attributes, f.e. Limit and Offset.
+func List[T any](db querier, previous int, orderBy string, wheres ...Where) (
+	rows []T, pagination int, err error) {
+
+	// Call ListRows function with numRows as number of rows
+	return ListRows[T](db, previous, orderBy, GetNumRows(), wheres...)
+}
+
+// ListAttrs returns rows from T database table.
+//
+// It works the same way as the List function but takes a list of attributes
+// as input parameter. The attributes may be Where conditions, Limit, Offset
+// and other ListAttr values. The Limit and Offset attributes override the
+// numRows and previous values.
+func ListAttrs[T any](db querier, previous int, orderBy string,
+	attrs ...ListAttr) (rows []T, pagination int, err error) {
+	return ListRowsAttrs[T](db, previous, orderBy, GetNumRows(), attrs...)
+}
+
+// ListContext returns rows from T database table.
+//
+// It works the same way as the List function but uses the given context to
+// execute the query.
+func ListContext[T any](ctx context.Context, db querier, previous int,
+	orderBy string, wheres ...Where) (rows []T, pagination int, err error) {
+	return ListContextAttrs[T](ctx, db, previous, orderBy,
+		whereAttrs(wheres)...)
+}
+
+// ListContextAttrs returns rows from T database table.
+//
+// It works the same way as the ListAttrs function but uses the given context
+// to execute the query.
+func ListContextAttrs[T any](ctx context.Context, db querier, previous int,
+	orderBy string, attrs ...ListAttr) (rows []T, pagination int, err error) {
+
+	// Call listRows function with numRows as number of rows
+	return listRows[T](ctx, db, previous, orderBy, GetNumRows(), attrs...)
+}
+
+// ListRows returns up to numRows rows from T database table starting from the
+// previous position.
+//
+// It works the same way as the List function but takes the number of rows to
+// get as parameter. If the T struct implements the AfterScanner interface its
+// AfterScan method is called for each row after it is scanned.
+//
+// The IN lists longer than query.MaxInParams are split into chunks selected
+// with separate statements. Such lists select all matching rows, so they
+// require zero previous and numRows and empty order, otherwise the
+// ErrLongInList error is returned.
+func ListRows[T any](db querier, previous int, orderBy string, numRows int, wheres ...Where) (
+	rows []T, pagination int, err error) {
+	return ListRowsAttrs[T](db, previous, orderBy, numRows,
+		whereAttrs(wheres)...)
+}
+
+// ListRowsAttrs returns up to numRows rows from T database table starting
+// from the previous position.
+//
+// It works the same way as the ListRows function but takes a list of
+// attributes as input parameter, see ListAttrs.
+func ListRowsAttrs[T any](db querier, previous int, orderBy string,
+	numRows int, attrs ...ListAttr) (rows []T, pagination int, err error) {
+	return listRows[T](context.Background(), db, previous, orderBy, numRows,
+		attrs...)
+}
+
+// listRows returns up to numRows rows from T database table starting from the
+// previous position using the given context to execute the query.
+func listRows[T any](ctx context.Context, db querier, previous int,
+	orderBy string, numRows int, attrs ...ListAttr) (rows []T, pagination int,
+	err error) {
+
+	// Get rows of each IN lists chunk
+	sets, err := splitInAttrs(attrs)
+	if err != nil {
+		return
+	}
+	if len(sets) > 1 {
+		return listChunks[T](ctx, db, previous, orderBy, numRows, sets)
+	}
+
+	// Get rows
+	for row, err := range listRange[T](ctx, db, previous, orderBy, numRows,
+		attrs...) {
+		if err != nil {
+			return nil, 0, err
+		}
+		rows = append(rows, row)
+	}
+	pagination = listOffset(previous, attrs...) + len(rows)
+
+	return
+}
+
+// listChunks returns the union of rows selected with each of the attributes
+// sets made by the splitInAttrs function.
+//
+// The sets are selected one after another, so the order, the grouping and the
+// rows range can't be applied to the union. It returns the ErrLongInList error
+// if the previous, numRows or orderBy parameters or such attributes are set.
+func listChunks[T any](ctx context.Context, db querier, previous int,
+	orderBy string, numRows int, sets [][]ListAttr) (rows []T, pagination int,
+	err error) {
+
+	// Check that all rows are selected, the Limit and Offset attributes
+	// override the numRows and previous values. The sets differ in Where
+	// attributes only, so the first set is checked
+	for _, a := range sets[0] {
+		switch a := a.(type) {
+		case Limit:
+			numRows = int(a)
+		case Offset:
+			previous = int(a)
+		case Orders, GroupColumns, DistinctColumns:
+			return nil, 0, ErrLongInList
+		}
+	}
+	if previous != 0 || numRows != 0 || orderBy != "" {
+		return nil, 0, ErrLongInList
+	}
+
+	// Get all rows of each set
+	for _, attrs := range sets {
+		for row, err := range listRange[T](ctx, db, 0, "", 0, attrs...) {
+			if err != nil {
+				return nil, 0, err
+			}
+			rows = append(rows, row)
+		}
+	}
+	pagination = len(rows)
+
+	return
+}
+
+// ListRange returns an iterator over rows from T database table.
+//
+// It works the same way as the ListAttrs function but does not collect the
+// rows into slice. The iterator yields each row with nil error. If an error
+// occurs, it yields the zero row and the error and stops.
+func ListRange[T any](db querier, previous int, orderBy string,
+	attrs ...ListAttr) iter.Seq2[T, error] {
+	return listRange[T](context.Background(), db, previous, orderBy,
+		GetNumRows(), attrs...)
+}
+
+// ListRangeContext returns an iterator over rows from T database table.
+//
+// It works the same way as the ListRange function but uses the given context
+// to execute the query. The context is checked before each row, so the
+// iteration stops with the context error soon after the context is cancelled.
+func ListRangeContext[T any](ctx context.Context, db querier, previous int,
+	orderBy string, attrs ...ListAttr) iter.Seq2[T, error] {
+	return listRange[T](ctx, db, previous, orderBy, GetNumRows(), attrs...)
+}
+
+// listRange returns an iterator over up to numRows rows from T database table
+// starting from the previous position using the given context to execute the
+// query. The context is checked before each row is scanned.
+func listRange[T any](ctx context.Context, db querier, previous int,
+	orderBy string, numRows int, attrs ...ListAttr) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		// Create select statement
+		selectStmt, selectArgs, err := listStatement[T](previous, orderBy,
+			numRows, attrs...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		sqlRows, err := db.QueryContext(ctx, selectStmt, selectArgs...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer sqlRows.Close()
+
+		// Get result set columns for the projection named scanning, or check
+		// that the result set columns match the struct fields
+		var columns []string
+		if isProjection(attrs...) {
+			columns, err = sqlRows.Columns()
+		} else {
+			columns, err = checkColumns[T](sqlRows, selectStmt)
+		}
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// Get rows
+		for sqlRows.Next() {
+
+			// Stop if the context is cancelled while rows are streaming
+			if err = ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var row T
+			if columns != nil {
+				err = scanNamed(sqlRows, columns, &row)
+			} else {
+				err = scanRow(sqlRows, &row)
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err = sqlRows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// scanRow scans current sql rows row into the row struct positionally and
+// calls the row AfterScan hook.
+func scanRow[T any](sqlRows *sql.Rows, row *T) (err error) {
+	args, _ := query.Args(*row)
+	if err = sqlRows.Scan(args...); err != nil {
+		return
+	}
+	if err = query.ArgsAppay(row, args); err != nil {
+		return
+	}
+	err = afterScan(row)
+	return
+}
+
+// isProjection returns true if the List functions attributes contain the
+// Projection attribute.
+func isProjection(attrs ...ListAttr) bool {
+	for _, a := range attrs {
+		if _, ok := a.(Projection); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrStop may be returned by the Each function callback to stop iteration
+// without error.
+var ErrStop = errors.New("stop iteration")
+
+// Each calls fn for each row from T database table.
+//
+// It works the same way as the ListRange function but calls the fn callback
+// for each row instead of returning an iterator. If fn returns an error the
+// iteration stops and the error is returned, except ErrStop which stops the
+// iteration without error.
+func Each[T any](db querier, fn func(T) error, previous int, orderBy string,
+	attrs ...ListAttr) (err error) {
+
+	for row, err := range ListRange[T](db, previous, orderBy, attrs...) {
+		if err != nil {
+			return err
+		}
+		if err = fn(row); err != nil {
+			if errors.Is(err, ErrStop) {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	return
+}
+
+// Collect returns the results of the mapFn function called for each row from
+// T database table.
+//
+// It works the same way as the ListRange function but transforms each row as
+// it is scanned, so the rows are not collected into slice, f.e. to get names
+// only:
+//
+//	names, err := sqlh.Collect(db, func(u User) string { return u.Name }, 0, "")
+//
+// If an error occurs, the function returns nil results and the error.
+func Collect[T, R any](db querier, mapFn func(T) R, previous int,
+	orderBy string, attrs ...ListAttr) (results []R, err error) {
+
+	for row, err := range ListRange[T](db, previous, orderBy, attrs...) {
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, mapFn(row))
+	}
+
+	return
+}
+
+// ListPage returns the page of rows from T database table and the total
+// number of rows matching the where conditions.
+//
+// The page parameter is the page number starting from 1, and the pageSize
+// parameter is the number of rows in page. The attrs parameter is the list of
+// List function attributes. The same where conditions are used to select rows
+// and to count total number of rows with the Count function. The total of the
+// rows selected with the GroupBy or DistinctOn attributes is the number of the
+// selected rows, f.e. the number of groups. The page can't be selected with the
+// IN list longer than query.MaxInParams, the ErrLongInList error is returned.
+func ListPage[T any](db querier, page, pageSize int, orderBy string,
+	attrs ...ListAttr) (rows []T, total int, err error) {
+
+	// Get rows of the page
+	if page < 1 {
+		page = 1
+	}
+	rows, _, err = ListRowsAttrs[T](db, (page-1)*pageSize, orderBy, pageSize,
+		attrs...)
+	if err != nil {
+		return
+	}
+
+	// Get total number of rows
+	total, err = countRows[T](context.Background(), db, attrs...)
+	return
+}
+
+// totalColumn is the ListPageWindow total rows column alias.
+const totalColumn = "__total"
+
+// ListPageWindow returns the page of rows from T database table and the total
+// number of rows matching the where conditions in one query.
+//
+// It works the same way as the ListPage function but selects the total number
+// of rows with the "count(*) OVER ()" window function column added to the page
+// rows, so the database is queried once. If current dialect does not support
+// window functions, or the page is empty and is not the first page, the total
+// number of rows is counted with the separate query. The empty first page
+// returns zero total. The window function is applied before DISTINCT ON, so
+// the rows selected with the DistinctOn attribute are counted with the separate
+// query too.
+func ListPageWindow[T any](db querier, page, pageSize int, orderBy string,
+	attrs ...ListAttr) (rows []T, total int, err error) {
+
+	// Use separate count query if window functions are not supported or the
+	// rows are distinct
+	if !query.GetDialect().WindowFunctions || hasDistinctOn(attrs) {
+		return ListPage[T](db, page, pageSize, orderBy, attrs...)
+	}
+
+	// Check IN lists, the long lists are not selected with one statement
+	sets, err := splitInAttrs(attrs)
+	if err != nil {
+		return
+	}
+	if len(sets) > 1 {
+		return nil, 0, ErrLongInList
 	}
 
-	// Create select statement
-	selectStmt, _ := query.Select[T](attr)
+	// Create select statement with total rows column
+	if page < 1 {
+		page = 1
+	}
+	previous := (page - 1) * pageSize
+	attr, selectArgs, err := listAttr[T](previous, orderBy, pageSize, attrs...)
+	if err != nil {
+		return
+	}
+	attr.TotalColumn = totalColumn
+	selectStmt, err := query.Select[T](attr)
+	if err != nil {
+		return
+	}
 
-	sqlRows, err := db.Query(selectStmt, selectArgs...)
+	sqlRows, err := db.QueryContext(context.Background(), selectStmt,
+		selectArgs...)
 	if err != nil {
 		return
 	}
 	defer sqlRows.Close()
 
-	// Get rows
+	// Get result set columns
+	columns, err := sqlRows.Columns()
+	if err != nil {
+		return
+	}
+
+	// Get rows and total number of rows
 	for sqlRows.Next() {
-		var row T
-		args, _ := query.Args(row)
+
+		// Make scan arguments for each column, the total column is scanned
+		// into the total
+		args := make([]any, len(columns))
+		for i, column := range columns {
+			if column == totalColumn {
+				args[i] = &total
+				continue
+			}
+			args[i] = new(any)
+		}
 		if err = sqlRows.Scan(args...); err != nil {
-			return
+			return nil, 0, err
+		}
+
+		// Set struct fields from the scanned arguments, the total column has
+		// no struct field and is skipped
+		var row T
+		if err = query.ArgsAppayNamed(&row, columns, args); err != nil {
+			return nil, 0, err
+		}
+		if err = afterScan(&row); err != nil {
+			return nil, 0, err
 		}
-		query.ArgsAppay(&row, args)
 		rows = append(rows, row)
 	}
 	if err = sqlRows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Count total number of rows if the page is out of rows
+	if len(rows) == 0 && previous > 0 {
+		total, err = countRows[T](context.Background(), db, attrs...)
+	}
+
+	return
+}
+
+// checkColumns checks that the sql rows result set columns match the T struct
+// database fields.
+//
+// The select statements get all columns with "SELECT *", so the result set
+// columns order is the table columns order which may differ from the struct
+// fields order, and the table or view may have extra columns. The columns are
+// matched by name when possible:
+//
+//   - if the columns are the struct database fields in the struct fields order,
+//     the row is scanned positionally and the function returns nil columns;
+//   - if every column matches a struct field by name (partial scan or other
+//     columns order), or every struct field has a column (extra columns), the
+//     function returns the result set columns to scan the row by name, so the
+//     fields without columns stay zero and the extra columns are skipped;
+//   - if the number of columns equals the number of struct database fields,
+//     the row is scanned positionally, f.e. for the expressions columns.
+//
+// Otherwise it returns a descriptive error with the struct type and the query.
+func checkColumns[T any](sqlRows *sql.Rows, stmt string) (columns []string,
+	err error) {
+
+	// Get result set columns
+	resultColumns, err := sqlRows.Columns()
+	if err != nil {
+		return
+	}
+
+	// Get struct database fields names, the table qualified fields match the
+	// columns by the name without table
+	var row T
+	structFields := query.Columns[T](true)
+	names := make([]string, len(structFields))
+	fields := make(map[string]bool)
+	for i, field := range structFields {
+		field = strings.ToLower(field)
+		if j := strings.LastIndex(field, "."); j >= 0 {
+			fields[field] = true
+			field = field[j+1:]
+		}
+		names[i] = field
+		fields[field] = true
+	}
+
+	// Check columns by name
+	inOrder := len(resultColumns) == len(names)
+	allKnown := true
+	present := make(map[string]bool, len(resultColumns))
+	for i, column := range resultColumns {
+		column = strings.ToLower(column)
+		inOrder = inOrder && names[i] == column
+		allKnown = allKnown && fields[column]
+		present[column] = true
+	}
+	allPresent := true
+	for _, name := range names {
+		allPresent = allPresent && present[name]
+	}
+
+	switch {
+	case inOrder:
+		return
+	case allKnown || allPresent:
+		columns = resultColumns
+		return
+	case len(resultColumns) == len(names):
+		return
+	}
+
+	err = fmt.Errorf("struct %T has %d database fields but query returns "+
+		"%d columns, query: %s", row, len(names), len(resultColumns), stmt)
+
+	return
+}
+
+// ListSQL returns the SELECT statement and its arguments generated by the
+// ListAttrs function for the same parameters without executing it.
+//
+// It may be used to inspect or log the List function queries.
+func ListSQL[T any](previous int, orderBy string, attrs ...ListAttr) (
+	stmt string, args []any, err error) {
+	return listStatement[T](previous, orderBy, GetNumRows(), attrs...)
+}
+
+// listStatement returns the SELECT statement and its arguments to get up to
+// numRows rows from T database table starting from the previous position.
+//
+// The attrs parameter is a list of List functions attributes: Where, Limit,
+// Offset, SetName, Alias, Lock, Orders, Projection, DistinctColumns and
+// GroupColumns. The Limit, Offset and Orders attributes override the numRows,
+// previous and orderBy parameters.
+func listStatement[T any](previous int, orderBy string, numRows int,
+	attrs ...ListAttr) (stmt string, args []any, err error) {
+
+	// Make select attributes
+	attr, args, err := listAttr[T](previous, orderBy, numRows, attrs...)
+	if err != nil {
 		return
 	}
-	pagination = previous + len(rows)
+
+	// Create select statement
+	stmt, err = query.Select[T](attr)
+	return
+}
+
+// listAttr returns the SELECT statement attributes and arguments made from the
+// List functions parameters and attributes, see listStatement.
+func listAttr[T any](previous int, orderBy string, numRows int,
+	attrs ...ListAttr) (attr *query.SelectAttr, args []any, err error) {
+
+	attr = &query.SelectAttr{}
+	var wheres []Where
+	var orders Orders
+
+	// Parse attributes
+	for _, a := range attrs {
+		switch a := a.(type) {
+
+		// Where conditions
+		case Where:
+			wheres = append(wheres, a)
+
+		// Table alias
+		case Alias:
+			if !aliasRe.MatchString(string(a)) {
+				return nil, nil, fmt.Errorf("invalid table alias: %q", a)
+			}
+			attr.Alias = string(a)
+
+		// Limit and offset
+		case Limit:
+			numRows = int(a)
+		case Offset:
+			previous = int(a)
+
+		// Table name
+		case SetName:
+			attr.Name = string(a)
+
+		// Row locking
+		case Lock:
+			attr.Lock = string(a)
+
+		// Selected columns
+		case Projection:
+			attr.Columns = a
+
+		// Distinct on columns
+		case DistinctColumns:
+			attr.DistinctOn = a
+
+		// Group by columns
+		case GroupColumns:
+			for _, column := range a {
+				if !columnRe.MatchString(column) {
+					return nil, nil, fmt.Errorf("invalid group by column: %q",
+						column)
+				}
+			}
+			attr.GroupBy = a
+
+		// Order by
+		case Orders:
+			orders = a
+
+		default:
+			return nil, nil, fmt.Errorf("unsupported list attribute type: %T",
+				a)
+		}
+	}
+
+	// Where clauses qualified with table alias
+	if len(attr.Alias) > 0 {
+		wheres = aliasWheres(attr.Alias, query.Columns[T](true), wheres)
+	}
+	if attr.Wheres, args, err = whereClauses(wheres...); err != nil {
+		return nil, nil, err
+	}
+
+	// Order by columns qualified with table alias
+	if orders != nil {
+		if orderBy, err = orderByClause[T](attr.Alias, orders); err != nil {
+			return nil, nil, err
+		}
+	}
+	attr.OrderBy = orderBy
+
+	// Limit and offset
+	attr.Paginator = &query.Paginator{
+		Offset: previous,
+		Limit:  numRows,
+	}
+
+	return
+}
+
+// UnionRange returns an iterator over the union of rows from T database table
+// selected with the a and b List functions attributes.
+//
+// The all parameter keeps duplicate rows (UNION ALL). The a attributes Orders,
+// Limit and Offset are applied to the whole union, the b attributes must not
+// have them, see query.Union. The rows are scanned by column names, so both
+// selects may use the Projection attribute with the same columns. The
+// iterator yields each row with nil error. If an error occurs, it yields the
+// zero row and the error and stops.
+func UnionRange[T any](db querier, all bool, a, b []ListAttr) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		// Make select attributes
+		attrA, argsA, err := listAttr[T](0, "", 0, a...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		attrB, argsB, err := listAttr[T](0, "", 0, b...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// Create union statement
+		unionStmt, err := query.Union[T](attrA, attrB, all)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		sqlRows, err := db.QueryContext(context.Background(), unionStmt,
+			append(argsA, argsB...)...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer sqlRows.Close()
+
+		// Get result set columns
+		columns, err := sqlRows.Columns()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// Get rows
+		for sqlRows.Next() {
+			var row T
+			if err = scanNamed(sqlRows, columns, &row); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err = sqlRows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// orderByClause returns the ORDER BY clause from the orders. It returns an
+// error if any of the not qualified orders columns is not a T struct database
+// field. The not qualified columns are qualified with the alias if it is set,
+// f.e. "a.name", the qualified columns, f.e. "b.amount", are validated as
+// column names only.
+func orderByClause[T any](alias string, orders Orders) (orderBy string,
+	err error) {
+
+	// Make columns map
+	columns := make(map[string]bool)
+	for _, column := range query.Columns[T](true) {
+		columns[strings.ToLower(column)] = true
+	}
+
+	// Make order by clause
+	var clauses []string
+	for _, order := range orders {
+		col := order.Col
+		switch {
+		case strings.Contains(col, "."):
+			if !columnRe.MatchString(col) {
+				err = fmt.Errorf("invalid order by column: %s", col)
+				return
+			}
+		case !columns[strings.ToLower(col)]:
+			err = fmt.Errorf("unknown order by column: %s", col)
+			return
+		case len(alias) > 0:
+			col = alias + "." + col
+		}
+		direction := "ASC"
+		if order.Desc {
+			direction = "DESC"
+		}
+		clauses = append(clauses, col+" "+direction)
+	}
+	orderBy = strings.Join(clauses, ", ")
 
 	return
 }
 
+// listOffset returns the list offset: the value of the last Offset attribute
+// or the previous parameter if there is no Offset attribute.
+func listOffset(previous int, attrs ...ListAttr) int {
+	for _, a := range attrs {
+		if o, ok := a.(Offset); ok {
+			previous = int(o)
+		}
+	}
+	return previous
+}
+
 // Count returns the number of rows from the selected T table in the database.
 //
 // The function accepts a variadic list of Where conditions to filter the rows.
 // It constructs a SQL COUNT statement and executes it using the provided
 // database connection. The count of rows is returned along with any error
 // encountered during the execution.
-func Count[T any](db *sql.DB, wheres ...Where) (count int, err error) {
+func Count[T any](db querier, wheres ...Where) (count int, err error) {
+	return CountContext[T](context.Background(), db, wheres...)
+}
 
-	var attr = &query.SelectAttr{}
-	var selectArgs []any
+// CountContext returns the number of rows from the selected T table in the
+// database. It works the same way as the Count function but uses the given
+// context to execute the query.
+func CountContext[T any](ctx context.Context, db querier, wheres ...Where) (
+	count int, err error) {
+	return countRows[T](ctx, db, whereAttrs(wheres)...)
+}
+
+// CountEstimate returns the approximate number of rows in T database table.
+//
+// The number is taken from the database statistics without scanning the
+// table, so it is fast on large tables but may differ from the exact number
+// of rows. The estimate statement depends on current dialect, see
+// query.CountEstimate. The exact number of rows is returned by the Count
+// function if current dialect does not support the estimate (SQLite) or the
+// statistics are not collected yet.
+func CountEstimate[T any](db querier) (count int64, err error) {
+
+	// Create estimate statement
+	estimateStmt, ok, err := query.CountEstimate[T]()
+	if err != nil {
+		return
+	}
+
+	// Get estimate from the database statistics
+	if ok {
+		estimate, err := countEstimate(db, estimateStmt)
+		if err != nil {
+			return 0, err
+		}
+		if estimate.Valid && estimate.Int64 >= 0 {
+			return estimate.Int64, nil
+		}
+	}
+
+	// Get exact count
+	n, err := Count[T](db)
+	count = int64(n)
+
+	return
+}
+
+// countEstimate executes the estimate statement and returns its first column
+// value. The rows are closed before return, so the connection is released
+// before the exact count fallback.
+func countEstimate(db querier, estimateStmt string) (estimate sql.NullInt64,
+	err error) {
+
+	sqlRows, err := db.QueryContext(context.Background(), estimateStmt)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+	if sqlRows.Next() {
+		if err = sqlRows.Scan(&estimate); err != nil {
+			return
+		}
+	}
+	err = sqlRows.Err()
+
+	return
+}
+
+// countRows returns the number of rows from the selected T table in the database.
+// The attrs parameter is the list of List functions attributes, the Limit and
+// Offset attributes are ignored. The IN lists longer than query.MaxInParams
+// are split into chunks counted with separate statements, and the counts are
+// summed. The rows selected with the GroupBy or DistinctOn attributes are
+// counted with the subquery, see countSelect.
+func countRows[T any](ctx context.Context, db querier, attrs ...ListAttr) (
+	count int, err error) {
+
+	// Count the grouped or distinct rows with the subquery
+	for _, a := range attrs {
+		switch a.(type) {
+		case GroupColumns, DistinctColumns:
+			return countSelect[T](ctx, db, attrs...)
+		}
+	}
+
+	// Get table name, alias and where conditions sets
+	attr, sets, err := countAttrs[T](attrs)
+	if err != nil {
+		return
+	}
+
+	// Count rows of each IN lists chunk, the chunks select disjoint rows
+	for _, set := range sets {
+		var n int
+		if n, err = countWheres[T](ctx, db, attr, set); err != nil {
+			return 0, err
+		}
+		count += n
+	}
+
+	return
+}
+
+// countAttrs returns the count select attributes with the SetName and Alias
+// attributes, and the Where attributes qualified with the alias and split into
+// the IN lists chunks sets by the splitIn function. Other attributes are
+// ignored.
+func countAttrs[T any](attrs []ListAttr) (attr *query.SelectAttr,
+	sets [][]Where, err error) {
+
+	attr = &query.SelectAttr{}
+	var wheres []Where
+
+	// Get where conditions, table name and alias
+	for _, a := range attrs {
+		switch a := a.(type) {
+		case Where:
+			wheres = append(wheres, a)
+		case SetName:
+			attr.Name = string(a)
+		case Alias:
+			if !aliasRe.MatchString(string(a)) {
+				err = fmt.Errorf("invalid table alias: %q", a)
+				return
+			}
+			attr.Alias = string(a)
+		}
+	}
+
+	// Qualify where conditions with table alias
+	if len(attr.Alias) > 0 {
+		wheres = aliasWheres(attr.Alias, query.Columns[T](true), wheres)
+	}
+
+	sets, err = splitIn(wheres)
+	return
+}
+
+// countWheres returns the number of rows from the T table selected by the attr
+// table name and alias and the given where conditions.
+func countWheres[T any](ctx context.Context, db querier,
+	attr *query.SelectAttr, wheres []Where) (count int, err error) {
 
 	// Construct where clauses and corresponding arguments
-	for _, w := range wheres {
-		attr.Wheres = append(attr.Wheres, w.Field+"?")
-		selectArgs = append(selectArgs, w.Value)
+	attr = attr.Clone()
+	var selectArgs []any
+	if attr.Wheres, selectArgs, err = whereClauses(wheres...); err != nil {
+		return
 	}
 
 	// Create SQL COUNT statement
@@ -338,20 +2030,161 @@ func Count[T any](db *sql.DB, wheres ...Where) (count int, err error) {
 		return
 	}
 
+	return countQuery(ctx, db, selectStmt, selectArgs)
+}
+
+// hasDistinctOn returns true if the List functions attributes have the
+// DistinctOn attribute.
+func hasDistinctOn(attrs []ListAttr) bool {
+	for _, a := range attrs {
+		if _, ok := a.(DistinctColumns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// countSelect returns the number of rows selected by the List functions
+// attributes counted with the "SELECT count(*) FROM (select)" subquery, f.e.
+// the number of groups selected with the GroupBy attribute. The Limit, Offset,
+// Orders and Lock attributes are ignored. The groups of the IN lists chunks
+// may intersect, so it returns ErrLongInList if the IN list is longer than
+// query.MaxInParams.
+func countSelect[T any](ctx context.Context, db querier, attrs ...ListAttr) (
+	count int, err error) {
+
+	// Remove the page and locking attributes
+	var selectAttrs []ListAttr
+	for _, a := range attrs {
+		switch a.(type) {
+		case Limit, Offset, Orders, Lock:
+			continue
+		}
+		selectAttrs = append(selectAttrs, a)
+	}
+
+	// Check IN lists
+	sets, err := splitInAttrs(selectAttrs)
+	if err != nil {
+		return
+	}
+	if len(sets) > 1 {
+		return 0, ErrLongInList
+	}
+
+	// Create SQL COUNT statement over the select statement
+	attr, selectArgs, err := listAttr[T](0, "", 0, selectAttrs...)
+	if err != nil {
+		return
+	}
+	selectStmt, err := query.Select[T](attr)
+	if err != nil {
+		return
+	}
+
+	return countQuery(ctx, db, query.CountSelect(selectStmt), selectArgs)
+}
+
+// countQuery executes the count statement and returns the count.
+func countQuery(ctx context.Context, db querier, countStmt string,
+	args []any) (count int, err error) {
+
 	// Execute the query
-	sqlRows, err := db.Query(selectStmt, selectArgs...)
+	sqlRows, err := db.QueryContext(ctx, countStmt, args...)
 	if err != nil {
 		return
 	}
 	defer sqlRows.Close()
 
-	// Retrieve the row count
-	if sqlRows.Next() {
-		err = sqlRows.Scan(&count)
-		if err != nil {
+	// Retrieve the row count, the query may fail while the rows are read,
+	// f.e. when the context is done
+	if !sqlRows.Next() {
+		err = sqlRows.Err()
+		return
+	}
+	err = sqlRows.Scan(&count)
+
+	return
+}
+
+// GroupCount returns the number of rows from the T database table grouped by
+// the groupCol column values.
+//
+// The returned map is keyed by the group column values as returned by the
+// database driver, the text values are returned as strings. The rows with NULL
+// group column value are counted under the nil key. The attrs parameter is an
+// optional list of Where, SetName and Alias attributes used the same way as in
+// the Count functions, other attributes are ignored.
+func GroupCount[T any](db querier, groupCol string, attrs ...ListAttr) (
+	counts map[any]int, err error) {
+	return GroupCountContext[T](context.Background(), db, groupCol, attrs...)
+}
+
+// GroupCountContext returns the number of rows from the T database table
+// grouped by the groupCol column values. It works the same way as the
+// GroupCount function but uses the given context to execute the query.
+func GroupCountContext[T any](ctx context.Context, db querier, groupCol string,
+	attrs ...ListAttr) (counts map[any]int, err error) {
+
+	// Get table name, alias and where conditions sets
+	attr, sets, err := countAttrs[T](attrs)
+	if err != nil {
+		return
+	}
+
+	// Count groups of each IN lists chunk, the chunks select disjoint rows
+	counts = make(map[any]int)
+	for _, set := range sets {
+		if err = groupCountWheres[T](ctx, db, groupCol, attr, set,
+			counts); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// groupCountWheres adds the number of rows from the T table selected by the
+// attr table name and alias and the given where conditions grouped by the
+// groupCol column values to the counts map.
+func groupCountWheres[T any](ctx context.Context, db querier, groupCol string,
+	attr *query.SelectAttr, wheres []Where, counts map[any]int) (err error) {
+
+	// Construct where clauses and corresponding arguments
+	attr = attr.Clone()
+	var selectArgs []any
+	if attr.Wheres, selectArgs, err = whereClauses(wheres...); err != nil {
+		return
+	}
+
+	// Create SQL SELECT statement
+	selectStmt, err := query.GroupCount[T](groupCol, attr)
+	if err != nil {
+		return
+	}
+
+	// Execute the query
+	sqlRows, err := db.QueryContext(ctx, selectStmt, selectArgs...)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Retrieve the grouped counts
+	for sqlRows.Next() {
+		var group any
+		var count int
+		if err = sqlRows.Scan(&group, &count); err != nil {
 			return
 		}
+
+		// Byte slices are not comparable, so they can't be map keys
+		if b, ok := group.([]byte); ok {
+			group = string(b)
+		}
+		counts[group] += count
 	}
+	err = sqlRows.Err()
 
 	return
 }
@@ -0,0 +1,2503 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kirill-scherba/sqlh/query"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testUser is the sqlh package tests struct.
+type testUser struct {
+	ID    int64  `db:"id" db_key:"primary key"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	Age   int    `db:"age"`
+}
+
+// testUsers are the rows inserted by the openTestDB function.
+var testUsers = []testUser{
+	{1, "alice", "alice@example.com", 30},
+	{2, "bob", "bob@example.com", 25},
+	{3, "carol", "carol@example.com", 35},
+	{4, "dave", "dave@example.com", 30},
+	{5, "alice", "alice2@example.com", 40},
+}
+
+// openTestDB opens the in-memory SQLite database with the testuser table
+// filled with testUsers rows. The database and package defaults are restored
+// when the test ends.
+func openTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to ":memory:" opens a new database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+		ResetDefaults()
+	})
+
+	if err = CreateTable[testUser](db); err != nil {
+		t.Fatal(err)
+	}
+	if err = Insert(db, testUsers...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// userIDs returns the ids of the users.
+func userIDs(users []testUser) (ids []int64) {
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return
+}
+
+// allUserIDs returns the sorted ids of all testuser table rows.
+func allUserIDs(t testing.TB, db *sql.DB) []int64 {
+	t.Helper()
+	rows, _, err := ListRows[testUser](db, 0, "id", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userIDs(rows)
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		wheres []Where
+		want   []int64
+	}{
+		{"one condition", []Where{{"id=", 1}}, []int64{2, 3, 4, 5}},
+		{"two conditions", []Where{{"name=", "alice"}, {"age=", 40}},
+			[]int64{1, 2, 3, 4}},
+		{"two conditions without match", []Where{{"name=", "alice"},
+			{"age=", 25}}, []int64{1, 2, 3, 4, 5}},
+		{"three conditions", []Where{{"name=", "alice"}, {"age>", 20},
+			{"email LIKE", "alice@%"}}, []int64{2, 3, 4, 5}},
+		{"three conditions with spaces", []Where{{"age >=", 30},
+			{"age <", 40}, {"name <>", "dave"}}, []int64{2, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := Delete[testUser](db, tt.wheres...); err != nil {
+				t.Fatal(err)
+			}
+			if got := allUserIDs(t, db); !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testItem is the tests struct with autoincrement primary key.
+type testItem struct {
+	ID   int64  `db:"id" db_key:"primary key autoincrement"`
+	Name string `db:"name"`
+}
+
+// openItemsDB opens the test database with the empty testitem table.
+func openItemsDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if err := CreateTable[testItem](db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestInsertAutoIncrement(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []testItem
+		names map[int64]string
+	}{
+		{"zero id is generated", []testItem{{0, "auto"}},
+			map[int64]string{1: "auto"}},
+		{"explicit id is kept", []testItem{{42, "explicit"}},
+			map[int64]string{42: "explicit"}},
+		{"zero and explicit ids in one batch",
+			[]testItem{{0, "auto"}, {42, "explicit"}, {0, "next"}},
+			map[int64]string{1: "auto", 42: "explicit", 43: "next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openItemsDB(t)
+			if err := Insert(db, tt.rows...); err != nil {
+				t.Fatal(err)
+			}
+			rows, _, err := ListRows[testItem](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[int64]string)
+			for _, row := range rows {
+				got[row.ID] = row.Name
+			}
+			if !maps.Equal(got, tt.names) {
+				t.Errorf("got %v, want %v", got, tt.names)
+			}
+		})
+	}
+}
+
+// testPost is the tests struct with automatic timestamps.
+type testPost struct {
+	ID      int64     `db:"id" db_key:"primary key"`
+	Title   string    `db:"title"`
+	Created time.Time `db:"created_at" db_auto:"created"`
+	Updated time.Time `db:"updated_at" db_auto:"updated"`
+}
+
+func TestAutoTime(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		row     testPost
+		created time.Time
+	}{
+		{"zero created set on insert", testPost{ID: 1, Title: "a"},
+			time.Time{}},
+		{"explicit created kept", testPost{ID: 1, Title: "a",
+			Created: created}, created},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testPost](db); err != nil {
+				t.Fatal(err)
+			}
+
+			// Insert sets created_at only
+			start := time.Now().Add(-time.Second)
+			if err := Insert(db, tt.row); err != nil {
+				t.Fatal(err)
+			}
+			inserted, err := Get[testPost](db, Where{"id=", 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case !tt.created.IsZero() && !inserted.Created.Equal(tt.created):
+				t.Errorf("got created_at %v, want %v", inserted.Created,
+					tt.created)
+			case tt.created.IsZero() && inserted.Created.Before(start):
+				t.Errorf("created_at %v is not set", inserted.Created)
+			case !inserted.Updated.IsZero():
+				t.Errorf("updated_at %v is set on insert", inserted.Updated)
+			}
+
+			// Update sets updated_at and keeps created_at
+			row := inserted
+			row.Title = "b"
+			row.Created = time.Time{}
+			err = Update(db, UpdateAttr[testPost]{row, []Where{{"id=", 1}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated, err := Get[testPost](db, Where{"id=", 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !updated.Created.Equal(inserted.Created) {
+				t.Errorf("got created_at %v after update, want %v",
+					updated.Created, inserted.Created)
+			}
+			if updated.Updated.Before(start) {
+				t.Errorf("updated_at %v is not set on update", updated.Updated)
+			}
+		})
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name      string
+		wheres    []Where
+		wantTable string
+	}{
+		{"not found", []Where{{"id=", 100}}, "testuser"},
+		{"found", []Where{{"id=", 1}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Get[testUser](db, tt.wheres...)
+			if tt.wantTable == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("got error %v, want sql.ErrNoRows", err)
+			}
+			var nf *NotFoundError
+			if !errors.As(err, &nf) {
+				t.Fatalf("got error %T, want *NotFoundError", err)
+			}
+			if nf.Table != tt.wantTable {
+				t.Errorf("got table %q, want %q", nf.Table, tt.wantTable)
+			}
+		})
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	db := openTestDB(t)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(),
+		time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{"active context", context.Background(), nil},
+		{"cancelled context", cancelled, context.Canceled},
+		{"expired deadline", expired, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := GetContext[testUser](tt.ctx, db, Where{"id=", 2})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && row != testUsers[1] {
+				t.Errorf("got %+v, want %+v", row, testUsers[1])
+			}
+
+			_, _, err = ListContext[testUser](tt.ctx, db, 0, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got list error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous int
+		orderBy  string
+		attrs    []ListAttr
+		wantStmt string
+		wantArgs []any
+	}{
+		{"where clause", 0, "", []ListAttr{Where{"name=", "alice"}},
+			"SELECT * from testuser where name = ? LIMIT 10;",
+			[]any{"alice"}},
+		{"order and offset", 20, "id", []ListAttr{Where{"age>", 30},
+			Limit(5)},
+			"SELECT * from testuser where age > ? ORDER BY id LIMIT 5 OFFSET 20;",
+			[]any{30}},
+		{"no attributes", 0, "", nil, "SELECT * from testuser LIMIT 10;",
+			nil},
+		{"lock omitted on sqlite", 0, "", []ListAttr{Eq("id", 1), ForUpdate()},
+			"SELECT * from testuser where id = ? LIMIT 10;", []any{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, args, err := ListSQL[testUser](tt.previous, tt.orderBy,
+				tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRawMessageRoundTrip(t *testing.T) {
+	type document struct {
+		ID  int64           `db:"id" db_key:"primary key"`
+		Raw json.RawMessage `db:"raw"`
+	}
+
+	tests := []struct {
+		name string
+		raw  json.RawMessage
+	}{
+		{"object", json.RawMessage(`{"a": [1, 2], "b": "x"}`)},
+		{"not utf-8 bytes", json.RawMessage("\xff\x00\xfe")},
+		{"empty", json.RawMessage{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[document](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, document{int64(i), tt.raw}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Get[document](db, Where{"id=", i})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Raw, tt.raw) {
+				t.Errorf("got %q, want %q", got.Raw, tt.raw)
+			}
+		})
+	}
+}
+
+func TestListLimitOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous int
+		numRows  int
+		attrs    []ListAttr
+		want     []int64
+	}{
+		{"positional", 1, 2, nil, []int64{2, 3}},
+		{"limit only", 0, 10, []ListAttr{Limit(2)}, []int64{1, 2}},
+		{"offset only", 0, 10, []ListAttr{Offset(3)}, []int64{4, 5}},
+		{"limit and offset", 0, 10, []ListAttr{Limit(2), Offset(1)},
+			[]int64{2, 3}},
+		{"options override positional", 4, 1, []ListAttr{Offset(1),
+			Limit(3)}, []int64{2, 3, 4}},
+		{"limit zero gets all rows", 0, 1, []ListAttr{Limit(0)},
+			[]int64{1, 2, 3, 4, 5}},
+		{"offset with limit zero", 0, 1, []ListAttr{Limit(0), Offset(2)},
+			[]int64{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			rows, _, err := ListRowsAttrs[testUser](db, tt.previous, "id",
+				tt.numRows, tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userIDs(rows); !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListWhereSignature(t *testing.T) {
+	db := openTestDB(t)
+
+	// The List functions take the Where slice
+	wheres := []Where{{"name=", "alice"}}
+	tests := []struct {
+		name string
+		list func() ([]testUser, int, error)
+	}{
+		{"List", func() ([]testUser, int, error) {
+			return List[testUser](db, 0, "id", wheres...)
+		}},
+		{"ListRows", func() ([]testUser, int, error) {
+			return ListRows[testUser](db, 0, "id", 10, wheres...)
+		}},
+		{"ListContext", func() ([]testUser, int, error) {
+			return ListContext[testUser](context.Background(), db, 0, "id",
+				wheres...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, pagination, err := tt.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userIDs(rows); !slices.Equal(got, []int64{1, 5}) {
+				t.Errorf("got ids %v, want [1 5]", got)
+			}
+			if pagination != 2 {
+				t.Errorf("got pagination %d, want 2", pagination)
+			}
+		})
+	}
+}
+
+func TestListPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      int
+		pageSize  int
+		attrs     []ListAttr
+		want      []int64
+		wantTotal int
+	}{
+		{"first page", 1, 2, nil, []int64{1, 2}, 5},
+		{"last page", 3, 2, nil, []int64{5}, 5},
+		{"page after last", 4, 2, nil, nil, 5},
+		{"zero page is first", 0, 2, nil, []int64{1, 2}, 5},
+		{"filtered", 1, 1, []ListAttr{Where{"age>=", 30}}, []int64{1}, 4},
+		{"filtered second page", 2, 2, []ListAttr{Where{"age>=", 30}},
+			[]int64{4, 5}, 4},
+		{"alias", 1, 1, []ListAttr{Alias("t"), Where{"t.age>=", 30},
+			Where{"name=", "alice"}}, []int64{1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			rows, total, err := ListPage[testUser](db, tt.page, tt.pageSize,
+				"id", tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userIDs(rows); !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("got total %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestGetByIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		ids    []any
+		maxIn  int
+		wantID []int64
+	}{
+		{"one id missing", []any{int64(1), int64(3), int64(99)}, 0,
+			[]int64{1, 3}},
+		{"duplicate ids", []any{int64(2), int64(2), int64(4)}, 0,
+			[]int64{2, 4}},
+		{"no ids", nil, 0, nil},
+		{"ids split into chunks", []any{int64(1), int64(2), int64(3),
+			int64(4), int64(5)}, 2, []int64{1, 2, 3, 4, 5}},
+		{"int ids converted", []any{1, int32(2), uint(2)}, 0,
+			[]int64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if tt.maxIn > 0 {
+				query.SetMaxInParams(tt.maxIn)
+			}
+			got, err := GetByIDs[testUser](db, "id", tt.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.wantID) {
+				t.Fatalf("got %d rows, want %d", len(got), len(tt.wantID))
+			}
+			for _, id := range tt.wantID {
+				if row, ok := got[id]; !ok || row != testUsers[id-1] {
+					t.Errorf("got row %+v for id %d, want %+v", row, id,
+						testUsers[id-1])
+				}
+			}
+		})
+	}
+
+	// Not hashable id
+	db := openTestDB(t)
+	if _, err := GetByIDs[testUser](db, "id", []any{[]byte("1")}); err == nil {
+		t.Error("got nil error for not hashable id")
+	}
+}
+
+func TestSetTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+		want     []testUser
+	}{
+		{"committed", false, append(slices.Clone(testUsers[:4]),
+			testUser{5, "eve", "eve@example.com", 41},
+			testUser{6, "frank", "frank@example.com", 20})},
+		{"rolled back together", true, testUsers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Update existing row and insert new row
+			err = SetTx(tx, testUser{5, "eve", "eve@example.com", 41},
+				Where{"id=", 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = SetTx(tx, testUser{6, "frank", "frank@example.com", 20},
+				Where{"id=", 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Roll back both, f.e. on the later error
+			if tt.rollback {
+				err = tx.Rollback()
+			} else {
+				err = tx.Commit()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, _, err := ListRowsAttrs[testUser](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got rows %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testBalance is the tests struct with the *big.Int field.
+type testBalance struct {
+	ID     int64    `db:"id"`
+	Amount *big.Int `db:"amount"`
+}
+
+func TestBigIntRoundTrip(t *testing.T) {
+	big40, _ := new(big.Int).SetString(
+		"1234567890123456789012345678901234567890", 10)
+
+	tests := []struct {
+		name    string
+		insert  func(db *sql.DB) error
+		want    *big.Int
+		wantErr bool
+	}{
+		{"40 digits", func(db *sql.DB) error {
+			return Insert(db, testBalance{1, big40})
+		}, big40, false},
+		{"negative 40 digits", func(db *sql.DB) error {
+			return Insert(db, testBalance{1, new(big.Int).Neg(big40)})
+		}, new(big.Int).Neg(big40), false},
+		{"nil is NULL", func(db *sql.DB) error {
+			return Insert(db, testBalance{1, nil})
+		}, nil, false},
+		{"integer column value", func(db *sql.DB) error {
+			_, err := Exec(db, "INSERT INTO testbalance VALUES (1, 42)")
+			return err
+		}, big.NewInt(42), false},
+		{"invalid integer", func(db *sql.DB) error {
+			_, err := Exec(db, "INSERT INTO testbalance VALUES (1, 'abc')")
+			return err
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testBalance](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.insert(db); err != nil {
+				t.Fatal(err)
+			}
+
+			row, err := Get[testBalance](db, Eq("id", 1))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (row.Amount == nil) != (tt.want == nil) ||
+				row.Amount != nil && row.Amount.Cmp(tt.want) != 0 {
+				t.Errorf("got amount %v, want %v", row.Amount, tt.want)
+			}
+		})
+	}
+}
+
+// testGenerated is the tests struct with the generated read only column.
+type testGenerated struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Upper string `db:"upper" db_type:"text generated always as (upper(name))" db_ro:"true"`
+}
+
+func TestReadonlyColumn(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(db *sql.DB) error
+		want  testGenerated
+	}{
+		{"insert", func(db *sql.DB) error {
+			return Insert(db, testGenerated{ID: 1, Name: "alice",
+				Upper: "ignored"})
+		}, testGenerated{1, "alice", "ALICE"}},
+		{"update", func(db *sql.DB) error {
+			if err := Insert(db, testGenerated{ID: 1, Name: "alice"}); err != nil {
+				return err
+			}
+			return Update(db, UpdateAttr[testGenerated]{
+				Row:    testGenerated{ID: 1, Name: "bob", Upper: "ignored"},
+				Wheres: []Where{Eq("id", 1)},
+			})
+		}, testGenerated{1, "bob", "BOB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testGenerated](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(db); err != nil {
+				t.Fatal(err)
+			}
+			row, err := Get[testGenerated](db, Eq("id", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row != tt.want {
+				t.Errorf("got %+v, want %+v", row, tt.want)
+			}
+		})
+	}
+}
+
+func TestListColumnsMismatch(t *testing.T) {
+	db := openTestDB(t)
+
+	// The structs read from the testuser table
+	type reordered struct {
+		Age  int    `db:"age"`
+		Name string `db:"name"`
+		ID   int64  `db:"id"`
+	}
+	type extra struct {
+		ID    int64  `db:"id"`
+		Name  string `db:"name"`
+		Email string `db:"email"`
+		Age   int    `db:"age"`
+		Extra string `db:"extra"`
+	}
+	type mismatched struct {
+		ID   int64  `db:"id"`
+		Nick string `db:"nick"`
+	}
+
+	tests := []struct {
+		name    string
+		list    func() (any, error)
+		want    any
+		wantErr string // Error message part, empty if no error
+	}{
+		{"reordered fields", func() (any, error) {
+			rows, _, err := ListAttrs[reordered](db, 0, "id",
+				SetName("testuser"), Eq("id", 1))
+			return rows, err
+		}, []reordered{{30, "alice", 1}}, ""},
+		{"extra struct field stays zero", func() (any, error) {
+			rows, _, err := ListAttrs[extra](db, 0, "id",
+				SetName("testuser"), Eq("id", 2))
+			return rows, err
+		}, []extra{{2, "bob", testUsers[1].Email, 25, ""}}, ""},
+		{"mismatched struct", func() (any, error) {
+			rows, _, err := ListAttrs[mismatched](db, 0, "id",
+				SetName("testuser"))
+			return rows, err
+		}, nil, "struct sqlh.mismatched has 2 database fields but query " +
+			"returns 4 columns, query: SELECT * from testuser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTableName(t *testing.T) {
+	const table = "testuser_2024_06"
+
+	tests := []struct {
+		name  string
+		write func(db *sql.DB) error
+		want  []testUser
+	}{
+		{"insert", func(db *sql.DB) error {
+			return InsertName(db, table, testUsers[:2]...)
+		}, testUsers[:2]},
+		{"update", func(db *sql.DB) error {
+			if err := InsertName(db, table, testUsers[:2]...); err != nil {
+				return err
+			}
+			row := testUsers[1]
+			row.Age = 99
+			return UpdateName(db, table, UpdateAttr[testUser]{
+				Row: row, Wheres: []Where{Eq("id", row.ID)},
+			})
+		}, []testUser{testUsers[0], {2, "bob", testUsers[1].Email, 99}}},
+		{"set", func(db *sql.DB) error {
+			if err := InsertName(db, table, testUsers[0]); err != nil {
+				return err
+			}
+			row := testUsers[0]
+			row.Age = 99
+			if err := Set(db, row, Eq("id", row.ID),
+				SetName(table)); err != nil {
+				return err
+			}
+			return Set(db, testUsers[1], Eq("id", testUsers[1].ID),
+				SetName(table))
+		}, []testUser{{1, "alice", testUsers[0].Email, 99}, testUsers[1]}},
+		{"delete", func(db *sql.DB) error {
+			if err := InsertName(db, table, testUsers[:2]...); err != nil {
+				return err
+			}
+			return DeleteName[testUser](db, table, Eq("id", 1))
+		}, testUsers[1:2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if _, err := db.Exec("CREATE TABLE " + table +
+				" AS SELECT * FROM testuser WHERE 0"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(db); err != nil {
+				t.Fatal(err)
+			}
+
+			// Read the named table rows
+			got, _, err := ListAttrs[testUser](db, 0, "id", SetName(table))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			// The struct based table is not changed
+			if ids := allUserIDs(t, db); !slices.Equal(ids,
+				userIDs(testUsers)) {
+				t.Errorf("got testuser ids %v, want %v", ids,
+					userIDs(testUsers))
+			}
+		})
+	}
+}
+
+func TestUpdateFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     testUser
+		cols    []string
+		wheres  []Where
+		want    []testUser
+		wantErr bool
+	}{
+		{"only name updated", testUser{Name: "bobby", Email: "x", Age: 99},
+			[]string{"name"}, []Where{Eq("id", 2)},
+			[]testUser{{2, "bobby", testUsers[1].Email, 25}}, false},
+		{"two columns of many rows", testUser{Email: "same@", Age: 1},
+			[]string{"age", "email"}, []Where{Eq("name", "alice")},
+			[]testUser{{1, "alice", "same@", 1}, {5, "alice", "same@", 1}},
+			false},
+		{"unknown column", testUser{}, []string{"data"},
+			[]Where{Eq("id", 2)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			err := UpdateFields(db, tt.row, tt.cols, tt.wheres...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// Check updated and not changed rows
+			want := slices.Clone(testUsers)
+			for _, row := range tt.want {
+				want[row.ID-1] = row
+			}
+			got, _, err := ListAttrs[testUser](db, 0, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEach(t *testing.T) {
+	errSecond := errors.New("second row")
+
+	tests := []struct {
+		name    string
+		stopAt  int64 // Row id returning the stop error
+		stopErr error
+		attrs   []ListAttr
+		wantIDs []int64
+		wantErr error
+	}{
+		{"all rows", 0, nil, nil, []int64{1, 2, 3, 4, 5}, nil},
+		{"error on second row", 2, errSecond, nil, []int64{1, 2}, errSecond},
+		{"stop without error", 3, ErrStop, nil, []int64{1, 2, 3}, nil},
+		{"wrapped stop", 1, fmt.Errorf("done: %w", ErrStop), nil,
+			[]int64{1}, nil},
+		{"where and limit", 0, nil, []ListAttr{Eq("age", 30), Limit(1)},
+			[]int64{1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			var ids []int64
+			err := Each(db, func(u testUser) error {
+				ids = append(ids, u.ID)
+				if u.ID == tt.stopAt {
+					return tt.stopErr
+				}
+				return nil
+			}, 0, "id", tt.attrs...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestUpdateByPK(t *testing.T) {
+	type noKey struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		update  func(db *sql.DB) error
+		want    []testUser // Updated rows
+		wantErr bool
+	}{
+		{"two rows", func(db *sql.DB) error {
+			return UpdateByPK(db, testUser{2, "bobby", "b@", 26},
+				testUser{4, "david", "d@", 31})
+		}, []testUser{{2, "bobby", "b@", 26}, {4, "david", "d@", 31}},
+			false},
+		{"missing row is not an error", func(db *sql.DB) error {
+			return UpdateByPK(db, testUser{9, "nobody", "n@", 1})
+		}, nil, false},
+		{"failed row rolls back all rows", func(db *sql.DB) error {
+			return UpdateByPK(db, testUser{2, "bobby", "b@", 26},
+				testUser{4, "david", testUsers[0].Email, 31})
+		}, nil, true},
+		{"no primary key", func(db *sql.DB) error {
+			return UpdateByPK(db, noKey{1, "x"})
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if _, err := db.Exec("CREATE UNIQUE INDEX testuser_email " +
+				"ON testuser (email)"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := tt.update(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// Check updated and not changed rows
+			want := slices.Clone(testUsers)
+			for _, row := range tt.want {
+				want[row.ID-1] = row
+			}
+			got, _, err := ListAttrs[testUser](db, 0, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCountContext(t *testing.T) {
+	db := openTestDB(t)
+
+	// The endless view rows are counted until the context is done
+	type testEndless struct {
+		ID int64 `db:"id"`
+	}
+	if _, err := db.Exec("CREATE VIEW testendless AS " +
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) " +
+		"SELECT x AS id FROM c"); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		count   func(ctx context.Context) (int, error)
+		want    int
+		wantErr error
+	}{
+		{"active context", func() (context.Context, context.CancelFunc) {
+			return context.Background(), func() {}
+		}, func(ctx context.Context) (int, error) {
+			return CountContext[testUser](ctx, db, Eq("age", 30))
+		}, 2, nil},
+		{"cancelled context", func() (context.Context, context.CancelFunc) {
+			return cancelled, func() {}
+		}, func(ctx context.Context) (int, error) {
+			return CountContext[testUser](ctx, db)
+		}, 0, context.Canceled},
+		{"deadline during count", func() (context.Context,
+			context.CancelFunc) {
+			return context.WithTimeout(context.Background(),
+				50*time.Millisecond)
+		}, func(ctx context.Context) (int, error) {
+			return CountContext[testEndless](ctx, db)
+		}, 0, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			got, err := tt.count(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got count %d, want %d", got, tt.want)
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("count returned after %v", d)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name     string
+		orderBy  string
+		attrs    []ListAttr
+		wantStmt string
+		wantIDs  []int64
+		wantErr  bool
+	}{
+		{"mixed directions", "", []ListAttr{OrderBy(Order{"age", true},
+			Order{"name", false})},
+			"SELECT * from testuser ORDER BY age DESC, name ASC LIMIT 10;",
+			[]int64{5, 3, 1, 4, 2}, false},
+		{"orders replace order by parameter", "id", []ListAttr{
+			OrderBy(Order{"name", true}, Order{"id", true})},
+			"SELECT * from testuser ORDER BY name DESC, id DESC LIMIT 10;",
+			[]int64{4, 3, 2, 5, 1}, false},
+		{"raw order by string", "age desc, id", nil,
+			"SELECT * from testuser ORDER BY age desc, id LIMIT 10;",
+			[]int64{5, 3, 1, 4, 2}, false},
+		{"alias qualified", "", []ListAttr{Alias("u"),
+			OrderBy(Order{"id", true})},
+			"SELECT u.* from testuser u ORDER BY u.id DESC LIMIT 10;",
+			[]int64{5, 4, 3, 2, 1}, false},
+		{"unknown column", "", []ListAttr{OrderBy(Order{"created", false})},
+			"", nil, true},
+		{"injection", "", []ListAttr{OrderBy(Order{"id; DROP TABLE x",
+			false})}, "", nil, true},
+		{"invalid qualified column", "", []ListAttr{OrderBy(
+			Order{"u.id desc", false})}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := ListSQL[testUser](0, tt.orderBy, tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+
+			rows, _, err := ListAttrs[testUser](db, 0, tt.orderBy,
+				tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got list error %v, want error %v", err, tt.wantErr)
+			}
+			if ids := userIDs(rows); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name     string
+		attrs    []ListAttr
+		wantStmt string
+		want     []testUser
+		wantErr  bool
+	}{
+		{"two columns", []ListAttr{Project("id", "name"), Eq("id", 2)},
+			"SELECT id, name from testuser where id = ? ORDER BY id LIMIT 10;",
+			[]testUser{{ID: 2, Name: "bob"}}, false},
+		{"columns in other order", []ListAttr{Project("age", "id"),
+			Eq("age", 30)},
+			"SELECT age, id from testuser where age = ? ORDER BY id LIMIT 10;",
+			[]testUser{{ID: 1, Age: 30}, {ID: 4, Age: 30}}, false},
+		{"with alias", []ListAttr{Alias("u"), Project("id", "email"),
+			Eq("id", 3)},
+			"SELECT u.id, u.email from testuser u where u.id = ? " +
+				"ORDER BY id LIMIT 10;",
+			[]testUser{{ID: 3, Email: "carol@example.com"}}, false},
+		{"expression with field alias", []ListAttr{
+			Project("id", "upper(name) AS name"), Eq("id", 1)},
+			"SELECT id, upper(name) AS name from testuser where id = ? " +
+				"ORDER BY id LIMIT 10;",
+			[]testUser{{ID: 1, Name: "ALICE"}}, false},
+		{"unknown column", []ListAttr{Project("id", "password")}, "", nil,
+			true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := ListSQL[testUser](0, "id", tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+
+			// Not selected fields are zero
+			got, _, err := ListAttrs[testUser](db, 0, "id", tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got list error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	type testCached struct {
+		ID    int64  `db:"id"`
+		Name  string `db:"name"`
+		Cache string `db:"-"`
+	}
+	db := openTestDB(t)
+	if err := CreateTable[testCached](db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Insert(db, testCached{ID: 1, Name: "alice"},
+		testCached{ID: 2, Name: "bob"}, testCached{ID: 3, Name: "bob"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := testCached{ID: 9, Name: "old", Cache: "cached"}
+	tests := []struct {
+		name    string
+		wheres  []Where
+		want    testCached
+		wantErr error
+	}{
+		{"only database fields changed", []Where{Eq("id", 1)},
+			testCached{1, "alice", "cached"}, nil},
+		{"not found keeps dst", []Where{Eq("id", 100)}, dst, sql.ErrNoRows},
+		{"multiple rows keeps dst", []Where{Eq("name", "bob")}, dst,
+			ErrMultipleRowsFound},
+		{"where required", nil, dst, ErrWhereClauseRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dst
+			err := GetInto(db, &got, tt.wheres...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupCount(t *testing.T) {
+	type testTask struct {
+		ID     int64   `db:"id"`
+		Status *string `db:"status"`
+		Size   int     `db:"size"`
+	}
+	status := func(s string) *string { return &s }
+
+	db := openTestDB(t)
+	if err := CreateTable[testTask](db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Insert(db,
+		testTask{1, status("new"), 1}, testTask{2, status("done"), 2},
+		testTask{3, status("new"), 3}, testTask{4, status("failed"), 1},
+		testTask{5, status("new"), 2}, testTask{6, nil, 3},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		groupCol string
+		attrs    []ListAttr
+		maxIn    int
+		want     map[any]int
+		wantErr  bool
+	}{
+		{"three statuses and NULL", "status", nil, 0,
+			map[any]int{"new": 3, "done": 1, "failed": 1, nil: 1}, false},
+		{"with where", "status", []ListAttr{Gt("size", 1)}, 0,
+			map[any]int{"new": 2, "done": 1, nil: 1}, false},
+		{"integer groups", "size", nil, 0,
+			map[any]int{int64(1): 2, int64(2): 2, int64(3): 2}, false},
+		{"no rows", "status", []ListAttr{Gt("size", 10)}, 0, map[any]int{},
+			false},
+		{"set name and alias", "status", []ListAttr{SetName("testtask"),
+			Alias("t"), Gt("size", 1)}, 0,
+			map[any]int{"new": 2, "done": 1, nil: 1}, false},
+		{"IN list split into chunks", "status", []ListAttr{In("id",
+			[]int{1, 2, 3, 4, 5})}, 2,
+			map[any]int{"new": 3, "done": 1, "failed": 1}, false},
+		{"unknown column", "owner", nil, 0, nil, true},
+		{"invalid where", "status", []ListAttr{Gt("size", nil)}, 0, nil,
+			true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.maxIn > 0 {
+				query.SetMaxInParams(tt.maxIn)
+				t.Cleanup(ResetDefaults)
+			}
+			got, err := GroupCount[testTask](db, tt.groupCol, tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSkippedFieldScan is the regression test for the skipped field shifting
+// the next fields values on read.
+func TestSkippedFieldScan(t *testing.T) {
+	type testIgnored struct {
+		A       string
+		Ignored string `db:"-"`
+		B       string
+		_       int
+		C       int
+	}
+
+	tests := []struct {
+		name string
+		row  testIgnored
+		want testIgnored
+	}{
+		{"skipped field kept", testIgnored{A: "a", Ignored: "x", B: "b",
+			C: 3}, testIgnored{A: "a", Ignored: "kept", B: "b", C: 3}},
+		{"zero values", testIgnored{}, testIgnored{Ignored: "kept"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testIgnored](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, tt.row); err != nil {
+				t.Fatal(err)
+			}
+
+			// Read with List and GetInto
+			rows, _, err := ListAttrs[testIgnored](db, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.Ignored = ""
+			if len(rows) != 1 || rows[0] != want {
+				t.Errorf("got %+v, want %+v", rows, want)
+			}
+			got := testIgnored{Ignored: "kept"}
+			if err = GetInto(db, &got, Eq("a", tt.row.A)); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	type testEvent struct {
+		ID int64      `db:"id"`
+		At time.Time  `db:"at"`
+		To *time.Time `db:"to_time"`
+	}
+	moscow := time.FixedZone("MSK", 3*60*60)
+	at := time.Date(2024, 6, 1, 12, 30, 15, 123456789, moscow)
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+		to   *time.Time
+	}{
+		{"default UTC", nil, &at},
+		{"configured location", moscow, &at},
+		{"NULL pointer", moscow, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			query.SetTimeLocation(tt.loc)
+			if err := CreateTable[testEvent](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, testEvent{1, at, tt.to}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The read times are equal and in the configured location
+			row, err := Get[testEvent](db, Eq("id", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			if !row.At.Equal(at) || row.At.Location() != loc {
+				t.Errorf("got %v, want %v", row.At, at.In(loc))
+			}
+			switch {
+			case tt.to == nil && row.To != nil:
+				t.Errorf("got %v, want nil", row.To)
+			case tt.to != nil && (row.To == nil || !row.To.Equal(*tt.to)):
+				t.Errorf("got %v, want %v", row.To, tt.to)
+			}
+		})
+	}
+}
+
+func TestInsertOrIgnore(t *testing.T) {
+	tests := []struct {
+		name         string
+		rows         []testUser
+		wantInserted int64
+		wantIDs      []int64
+	}{
+		{"new rows", []testUser{{6, "eve", "e@", 20}, {7, "fred", "f@", 21}},
+			2, []int64{1, 2, 3, 4, 5, 6, 7}},
+		{"duplicate key ignored", []testUser{{6, "eve", "e@", 20},
+			{1, "alice", "a@", 1}}, 1, []int64{1, 2, 3, 4, 5, 6}},
+		{"duplicate in batch", []testUser{{6, "eve", "e@", 20},
+			{6, "eve", "e@", 20}}, 1, []int64{1, 2, 3, 4, 5, 6}},
+		{"all duplicates", testUsers[:2], 0, []int64{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			inserted, err := InsertOrIgnore(db, tt.rows...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inserted != tt.wantInserted {
+				t.Errorf("got inserted %d, want %d", inserted, tt.wantInserted)
+			}
+			if ids := allUserIDs(t, db); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+
+			// Ignored rows don't change existing rows
+			row, err := Get[testUser](db, Eq("id", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row != testUsers[0] {
+				t.Errorf("got %+v, want %+v", row, testUsers[0])
+			}
+		})
+	}
+}
+
+func TestUnionRange(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name    string
+		all     bool
+		a, b    []ListAttr
+		want    []int64
+		wantErr bool
+	}{
+		{"union all keeps duplicates", true, []ListAttr{Gte("age", 30),
+			OrderBy(Order{"id", false})}, []ListAttr{Eq("name", "alice")},
+			[]int64{1, 1, 3, 4, 5, 5}, false},
+		{"union removes duplicates", false, []ListAttr{Gte("age", 30),
+			OrderBy(Order{"id", false})}, []ListAttr{Eq("name", "alice")},
+			[]int64{1, 3, 4, 5}, false},
+		{"limit applies to whole union", true, []ListAttr{Eq("id", 5),
+			OrderBy(Order{"id", false}), Limit(2)},
+			[]ListAttr{Lte("id", 2)}, []int64{1, 2}, false},
+		{"projection", true, []ListAttr{Project("id"), Eq("id", 1)},
+			[]ListAttr{Project("id"), Eq("id", 2)}, []int64{1, 2}, false},
+		{"second order error", true, nil, []ListAttr{
+			OrderBy(Order{"id", false})}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int64
+			var err error
+			for row, e := range UnionRange[testUser](db, tt.all, tt.a, tt.b) {
+				if err = e; err != nil {
+					break
+				}
+				ids = append(ids, row.ID)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.all {
+				slices.Sort(ids)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("got ids %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	// The scan error is yielded with the zero row
+	_, err := db.Exec("UPDATE testuser SET age = 'old' WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for row, err := range UnionRange[testUser](db, true,
+		[]ListAttr{Eq("id", 1)}, []ListAttr{Eq("id", 2)}) {
+		if err == nil {
+			continue
+		}
+		if row != (testUser{}) {
+			t.Errorf("got row %+v with error, want zero row", row)
+		}
+		return
+	}
+	t.Error("got no scan error")
+}
+
+func TestDeleteAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		delete  func(db *sql.DB) error
+		want    []int64
+		wantErr error
+	}{
+		{"delete without where", func(db *sql.DB) error {
+			return Delete[testUser](db)
+		}, userIDs(testUsers), ErrWhereClauseRequired},
+		{"delete name without where", func(db *sql.DB) error {
+			return DeleteName[testUser](db, "testuser")
+		}, userIDs(testUsers), ErrWhereClauseRequired},
+		{"delete all", DeleteAll[testUser], nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := tt.delete(db); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := allUserIDs(t, db); !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialScan(t *testing.T) {
+	db := openTestDB(t)
+
+	// The struct has more fields than the selected columns
+	type dto struct {
+		ID       int64  `db:"id"`
+		Name     string `db:"name"`
+		Computed string `db:"computed"`
+	}
+
+	tests := []struct {
+		name string
+		list func() ([]dto, error)
+		want []dto
+	}{
+		{"projection", func() ([]dto, error) {
+			rows, _, err := ListAttrs[dto](db, 0, "id", SetName("testuser"),
+				Project("id", "name"), Lte("id", 2))
+			return rows, err
+		}, []dto{{1, "alice", ""}, {2, "bob", ""}}},
+		{"projection in other order", func() ([]dto, error) {
+			rows, _, err := ListAttrs[dto](db, 0, "id", SetName("testuser"),
+				Project("name", "id"), Eq("id", 3))
+			return rows, err
+		}, []dto{{3, "carol", ""}}},
+		{"raw query", func() ([]dto, error) {
+			return QueryRows[dto](db, "SELECT name, id FROM testuser "+
+				"WHERE id = ?", 4)
+		}, []dto{{4, "dave", ""}}},
+		{"iterator", func() (rows []dto, err error) {
+			for row, err := range ListRange[dto](db, 0, "id",
+				SetName("testuser"), Project("id", "name"), Eq("id", 5)) {
+				if err != nil {
+					return nil, err
+				}
+				rows = append(rows, row)
+			}
+			return
+		}, []dto{{5, "alice", ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNullZero(t *testing.T) {
+	type testContact struct {
+		ID    int64  `db:"id"`
+		Phone string `db:"phone" db_null:"zero" db_key:"unique"`
+		Score int    `db:"score" db_null:"zero"`
+		Count int    `db:"count"`
+	}
+
+	tests := []struct {
+		name      string
+		rows      []testContact
+		wantNulls int // Rows with NULL phone
+		wantErr   bool
+	}{
+		{"zero values written as NULL", []testContact{{1, "", 0, 0}}, 1,
+			false},
+		{"values written", []testContact{{1, "555", 7, 3}}, 0, false},
+		{"empty strings don't violate unique", []testContact{{1, "", 0, 0},
+			{2, "", 0, 0}, {3, "555", 1, 0}}, 2, false},
+		{"duplicate values violate unique", []testContact{{1, "555", 0, 0},
+			{2, "555", 0, 0}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testContact](db); err != nil {
+				t.Fatal(err)
+			}
+			err := Insert(db, tt.rows...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Check NULL values, the count field zero is stored as 0
+			nulls, err := QueryScalar[int](db, "SELECT count(*) FROM "+
+				"testcontact WHERE phone IS NULL AND score IS NULL AND "+
+				"count IS NOT NULL")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nulls != tt.wantNulls {
+				t.Errorf("got %d NULL rows, want %d", nulls, tt.wantNulls)
+			}
+
+			// NULL values are read as zero values
+			got, _, err := ListAttrs[testContact](db, 0, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.rows) {
+				t.Errorf("got %+v, want %+v", got, tt.rows)
+			}
+		})
+	}
+}
+
+func TestDistinctOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  query.Dialect
+		orderBy  string
+		attrs    []ListAttr
+		wantStmt string
+		wantErr  bool
+	}{
+		{"postgres", query.Postgres, "", []ListAttr{DistinctOn("name"),
+			OrderBy(Order{"name", false}, Order{"age", true})},
+			"SELECT DISTINCT ON (name) * from testuser ORDER BY name ASC, " +
+				"age DESC LIMIT 10;", false},
+		{"postgres with where", query.Postgres, "", []ListAttr{
+			DistinctOn("name"), Gt("age", 20), OrderBy(Order{"name", false})},
+			"SELECT DISTINCT ON (name) * from testuser where age > $1 " +
+				"ORDER BY name ASC LIMIT 10;", false},
+		{"postgres order by other column", query.Postgres, "age",
+			[]ListAttr{DistinctOn("name")}, "", true},
+		{"sqlite", query.SQLite, "", []ListAttr{DistinctOn("name"),
+			OrderBy(Order{"name", false})}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query.SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			stmt, _, err := ListSQL[testUser](0, tt.orderBy, tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+		})
+	}
+
+	// The List functions return the dialect error
+	db := openTestDB(t)
+	_, _, err := ListAttrs[testUser](db, 0, "", DistinctOn("name"),
+		OrderBy(Order{"name", false}))
+	if err == nil {
+		t.Error("got no error on sqlite, want distinct on error")
+	}
+}
+
+func TestNumRows(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name string
+		n    int
+		want int
+	}{
+		{"default", 0, 10},
+		{"set", 3, 3},
+		{"zero ignored", 0, 3},
+		{"negative ignored", -1, 3},
+		{"set again", 25, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetNumRows(tt.n)
+			if got := GetNumRows(); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumRowsConcurrent(t *testing.T) {
+	db := openTestDB(t)
+
+	// Change the default while other goroutines list rows with their own
+	// number of rows, run it with the -race flag
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetNumRows(i%5 + 1)
+			if n := GetNumRows(); n < 1 || n > 5 {
+				errs <- fmt.Errorf("got default number of rows %d", n)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			numRows := i%len(testUsers) + 1
+			rows, _, err := ListRows[testUser](db, 0, "id", numRows)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(rows) != numRows {
+				errs <- fmt.Errorf("got %d rows, want %d", len(rows), numRows)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestInsertOne(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []testItem
+		row      testItem
+		wantID   int64
+		wantErr  bool
+	}{
+		{"empty table", nil, testItem{Name: "first"}, 1, false},
+		{"after existing rows", []testItem{{Name: "a"}, {ID: 7, Name: "b"}},
+			testItem{Name: "next"}, 8, false},
+		{"id already set", []testItem{{Name: "a"}}, testItem{ID: 5,
+			Name: "set"}, 5, false},
+		{"duplicate id", []testItem{{Name: "a"}}, testItem{ID: 1,
+			Name: "dup"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openItemsDB(t)
+			if err := Insert(db, tt.existing...); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := InsertOne(db, tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.ID != tt.wantID || got.Name != tt.row.Name {
+				t.Errorf("got %+v, want id %d name %q", got, tt.wantID,
+					tt.row.Name)
+			}
+
+			// The returned id is the database row id
+			row, err := Get[testItem](db, Where{"name=", tt.row.Name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row != got {
+				t.Errorf("got database row %+v, want %+v", row, got)
+			}
+		})
+	}
+
+	// The row without autoincrement field is returned unchanged
+	db := openTestDB(t)
+	row := testUser{ID: 10, Name: "erin", Email: "erin@example.com", Age: 20}
+	got, err := InsertOne(db, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != row {
+		t.Errorf("got %+v, want %+v", got, row)
+	}
+
+	// The pointer row is copied, the caller's struct is not changed
+	db = openItemsDB(t)
+	item := &testItem{Name: "pointer"}
+	gotItem, err := InsertOne(db, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotItem == item || gotItem.ID != 1 || gotItem.Name != "pointer" {
+		t.Errorf("got %p %+v, want new pointer with id 1", gotItem, *gotItem)
+	}
+	if *item != (testItem{Name: "pointer"}) {
+		t.Errorf("got caller's row %+v, want unchanged", *item)
+	}
+}
+
+func TestListRangeContext(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name     string
+		cancelAt int // Cancel the context after this row number, 0 if never
+		want     []int64
+		wantErr  error
+	}{
+		{"not cancelled", 0, []int64{1, 2, 3, 4, 5}, nil},
+		{"cancelled after first row", 1, []int64{1}, context.Canceled},
+		{"cancelled after third row", 3, []int64{1, 2, 3}, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var ids []int64
+			var gotErr error
+			for row, err := range ListRangeContext[testUser](ctx, db, 0, "id",
+				Limit(0)) {
+				if err != nil {
+					gotErr = err
+					break
+				}
+				ids = append(ids, row.ID)
+				if len(ids) == tt.cancelAt {
+					cancel()
+				}
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("got ids %v, want %v", ids, tt.want)
+			}
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("got error %v, want %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestListRangeScanError checks that the row scan error is yielded with the
+// zero row, not the partly scanned one.
+func TestListRangeScanError(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec("UPDATE testuser SET age = 'old' WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for row, err := range ListRange[testUser](db, 0, "id", Limit(0)) {
+		if err == nil {
+			t.Fatalf("got row %+v without error, want scan error", row)
+		}
+		if row != (testUser{}) {
+			t.Errorf("got row %+v with error, want zero row", row)
+		}
+		break
+	}
+}
+
+func TestCollect(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name     string
+		previous int
+		orderBy  string
+		attrs    []ListAttr
+		want     []string
+		wantErr  bool
+	}{
+		{"all names", 0, "id", []ListAttr{Limit(0)},
+			[]string{"alice", "bob", "carol", "dave", "alice"}, false},
+		{"where and order", 0, "name", []ListAttr{Eq("age", 30)},
+			[]string{"alice", "dave"}, false},
+		{"previous and limit", 1, "id", []ListAttr{Limit(2)},
+			[]string{"bob", "carol"}, false},
+		{"no rows", 0, "id", []ListAttr{Eq("name", "nobody")}, nil, false},
+		{"query error", 0, "missing", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collect(db, func(u testUser) string { return u.Name },
+				tt.previous, tt.orderBy, tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The results are the same as the mapped ListRows rows
+	rows, _, err := ListRows[testUser](db, 0, "id", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Collect(db, func(u testUser) int { return u.Age * 2 }, 0,
+		"id", Limit(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		if got[i] != row.Age*2 {
+			t.Errorf("row %d: got %d, want %d", i, got[i], row.Age*2)
+		}
+	}
+}
+
+func TestSetNumRowsOne(t *testing.T) {
+	db := openTestDB(t)
+	SetNumRows(1)
+
+	tests := []struct {
+		name     string
+		previous int
+		attrs    []ListAttr
+		wantStmt string
+		want     []int64
+	}{
+		{"first page", 0, nil,
+			"SELECT * from testuser ORDER BY id LIMIT 1;", []int64{1}},
+		{"next page", 1, nil,
+			"SELECT * from testuser ORDER BY id LIMIT 1 OFFSET 1;",
+			[]int64{2}},
+		{"with where", 0, []ListAttr{Eq("age", 30)},
+			"SELECT * from testuser where age = ? ORDER BY id LIMIT 1;",
+			[]int64{1}},
+		{"limit attribute overrides", 0, []ListAttr{Limit(2)},
+			"SELECT * from testuser ORDER BY id LIMIT 2;", []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := ListSQL[testUser](tt.previous, "id", tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			rows, _, err := ListAttrs[testUser](db, tt.previous, "id",
+				tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := userIDs(rows); !slices.Equal(ids, tt.want) {
+				t.Errorf("got ids %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	// The Get functions still find duplicates with the one row default
+	getTests := []struct {
+		name    string
+		get     func() error
+		wantErr error
+	}{
+		{"get", func() error {
+			_, err := Get[testUser](db, Eq("name", "alice"))
+			return err
+		}, ErrMultipleRowsFound},
+		{"get into", func() error {
+			var row testUser
+			return GetInto(db, &row, Eq("age", 30))
+		}, ErrMultipleRowsFound},
+		{"get single row", func() error {
+			_, err := Get[testUser](db, Eq("name", "bob"))
+			return err
+		}, nil},
+	}
+	for _, tt := range getTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.get(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetByPK(t *testing.T) {
+	db := openOrdersDB(t)
+
+	tests := []struct {
+		name    string
+		get     func() (any, error)
+		want    any
+		wantErr bool
+		wantIs  error // Expected wrapped error, nil if any
+	}{
+		{"found", func() (any, error) { return GetByPK[testUser](db, 3) },
+			&testUsers[2], false, nil},
+		{"string id", func() (any, error) {
+			return GetByPK[testUser](db, "2")
+		}, &testUsers[1], false, nil},
+		{"not found", func() (any, error) {
+			return GetByPK[testUser](db, 100)
+		}, (*testUser)(nil), true, sql.ErrNoRows},
+		{"no primary key", func() (any, error) {
+			return GetByPK[testOrder](db, 10)
+		}, (*testOrder)(nil), true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Fatalf("got error %v, want %v", err, tt.wantIs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertPointerRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []testItem
+		names map[int64]string
+	}{
+		{"autoincrement", []testItem{{Name: "a"}, {Name: "b"}},
+			map[int64]string{1: "a", 2: "b"}},
+		{"set and generated ids", []testItem{{ID: 5, Name: "a"},
+			{Name: "b"}}, map[int64]string{5: "a", 6: "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The T and *T rows statements and arguments are the same
+			for _, row := range tt.rows {
+				stmt, err := query.Insert(row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ptrStmt, err := query.Insert(&row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ptrStmt != stmt {
+					t.Errorf("got pointer statement %q, want %q", ptrStmt,
+						stmt)
+				}
+				args, err := query.InsertArgs(row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ptrArgs, err := query.InsertArgs(&row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(ptrArgs, args) {
+					t.Errorf("got pointer args %v, want %v", ptrArgs, args)
+				}
+			}
+
+			// The T and *T rows inserted into two databases give the same rows
+			db, ptrDB := openItemsDB(t), openItemsDB(t)
+			if err := Insert(db, tt.rows...); err != nil {
+				t.Fatal(err)
+			}
+			var ptrRows []*testItem
+			for _, row := range tt.rows {
+				ptrRows = append(ptrRows, &row)
+			}
+			if err := Insert(ptrDB, ptrRows...); err != nil {
+				t.Fatal(err)
+			}
+			for _, db := range []*sql.DB{db, ptrDB} {
+				rows, _, err := ListRowsAttrs[testItem](db, 0, "id", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make(map[int64]string)
+				for _, row := range rows {
+					got[row.ID] = row.Name
+				}
+				if !maps.Equal(got, tt.names) {
+					t.Errorf("got %v, want %v", got, tt.names)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertConcurrent(t *testing.T) {
+
+	// makeItems returns n items with ids starting from 1
+	makeItems := func(n int) (items []testItem) {
+		for i := range n {
+			items = append(items, testItem{int64(i + 1), fmt.Sprint("item", i)})
+		}
+		return
+	}
+	duplicate := append(makeItems(100), testItem{1, "duplicate"})
+
+	tests := []struct {
+		name     string
+		rows     []testItem
+		workers  int
+		maxOpen  int
+		wantRows int // Number of inserted rows, -1 if it depends on order
+		wantErr  bool
+	}{
+		{"1000 rows 4 workers", makeItems(1000), 4, 4, 1000, false},
+		{"workers limited by pool", makeItems(1000), 8, 2, 1000, false},
+		{"more workers than rows", makeItems(3), 4, 4, 3, false},
+		{"zero workers", makeItems(10), 0, 4, 10, false},
+		{"no rows", nil, 4, 4, 0, false},
+		{"duplicate id", duplicate, 4, 4, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Several connections to the same database file, the write
+			// transactions wait for each other
+			path := filepath.Join(t.TempDir(), "test.db")
+			db, err := sql.Open("sqlite3", "file:"+path+
+				"?_busy_timeout=10000&_txlock=immediate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.SetMaxOpenConns(tt.maxOpen)
+			t.Cleanup(func() { db.Close() })
+			if err = CreateTable[testItem](db); err != nil {
+				t.Fatal(err)
+			}
+
+			err = InsertConcurrent(db, tt.rows, tt.workers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// All rows are inserted, or the failed worker part is rolled back
+			count, err := Count[testItem](db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantRows >= 0 && count != tt.wantRows {
+				t.Errorf("got %d rows, want %d", count, tt.wantRows)
+			}
+			if tt.wantRows < 0 && count >= len(tt.rows)-1 {
+				t.Errorf("got %d rows, want failed part rolled back", count)
+			}
+			if open := db.Stats().OpenConnections; open > tt.maxOpen {
+				t.Errorf("got %d open connections, want at most %d", open,
+					tt.maxOpen)
+			}
+		})
+	}
+}
+
+func TestInsertOmitEmpty(t *testing.T) {
+	type testGuest struct {
+		ID   int64  `db:"id" db_key:"primary key"`
+		Nick string `db:"nick,omitempty" db_key:"default 'guest'"`
+		Age  int    `db:"age,omitempty" db_key:"default 18"`
+	}
+
+	tests := []struct {
+		name string
+		row  testGuest
+		want testGuest
+	}{
+		{"zero values use defaults", testGuest{ID: 1},
+			testGuest{1, "guest", 18}},
+		{"set values", testGuest{2, "bob", 30}, testGuest{2, "bob", 30}},
+		{"one value set", testGuest{ID: 3, Age: 40},
+			testGuest{3, "guest", 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testGuest](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, tt.row); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Get[testGuest](db, Eq("id", tt.row.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertSlice(t *testing.T) {
+
+	// makeItems returns n items with ids starting from 1
+	makeItems := func(n int) (items []testItem) {
+		for i := range n {
+			items = append(items, testItem{int64(i + 1), fmt.Sprint("item", i)})
+		}
+		return
+	}
+
+	tests := []struct {
+		name      string
+		rows      []testItem
+		noTable   bool
+		wantCount int
+		wantErr   bool
+	}{
+		{"500 rows", makeItems(500), false, 500, false},
+		{"autoincrement rows", []testItem{{Name: "a"}, {Name: "b"}}, false, 2,
+			false},
+		{"empty slice", []testItem{}, false, 0, false},
+		{"nil slice", nil, false, 0, false},
+		{"empty slice without table", []testItem{}, true, 0, false},
+		{"duplicate rolls back", append(makeItems(10), testItem{1, "dup"}),
+			false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if !tt.noTable {
+				if err := CreateTable[testItem](db); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := InsertSlice(db, tt.rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.noTable {
+				return
+			}
+			count, err := Count[testItem](db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("got %d rows, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	type testSettings struct {
+		ID     int64          `db:"id" db_key:"primary key"`
+		Counts map[string]int `db:"counts"`
+		Tags   []string       `db:"tags"`
+	}
+
+	nested := testSettings{1, map[string]int{"a": 1, "b": 2}, []string{"x"}}
+	tests := []struct {
+		name string
+		row  testSettings
+		want testSettings
+	}{
+		{"nested map", nested, nested},
+		{"empty slice read as nil", testSettings{ID: 2,
+			Counts: map[string]int{}, Tags: []string{}},
+			testSettings{ID: 2, Counts: map[string]int{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[testSettings](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, tt.row); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Get[testSettings](db, Eq("id", tt.row.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetDefaults(t *testing.T) {
+	t.Cleanup(ResetDefaults)
+
+	tests := []struct {
+		name   string
+		mutate func()
+		check  func() bool // Returns true if the setting is the default
+	}{
+		{"number of rows", func() { SetNumRows(3) },
+			func() bool { return GetNumRows() == 10 }},
+		{"retry", func() { SetRetry(1, time.Second, time.Minute) },
+			func() bool {
+				return retryAttempts == 5 &&
+					retryBackoff == 10*time.Millisecond &&
+					retryMaxBackoff == time.Second
+			}},
+		{"query hook", func() {
+			SetQueryHook(func(string, []any, time.Duration, error) {})
+		}, func() bool { return queryHook.Load() == nil }},
+		{"query dialect", func() { query.SetDialect(query.Postgres) },
+			func() bool { return query.GetDialect().Name == "sqlite" }},
+		{"query max in params", func() { query.SetMaxInParams(10) },
+			func() bool { return query.MaxInParams() == 999 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mutate()
+			if tt.check() {
+				t.Fatal("setting is not changed")
+			}
+			ResetDefaults()
+			if !tt.check() {
+				t.Error("setting is not restored")
+			}
+		})
+	}
+}
+
+func TestSelectStarColumnOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		create []string
+		table  string // Table to insert the rows into
+	}{
+		{"reversed table columns", []string{"CREATE TABLE testuser " +
+			"(age integer, email text, name text, id integer primary key)"},
+			"testuser"},
+		{"extra table columns", []string{"CREATE TABLE testuser " +
+			"(created text, email text, id integer primary key, notes text, " +
+			"age integer, name text)"}, "testuser"},
+		{"view with other order", []string{"CREATE TABLE users " +
+			"(id integer primary key, name text, email text, age integer)",
+			"CREATE VIEW testuser AS SELECT name, id, age, email FROM users"},
+			"users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.SetMaxOpenConns(1)
+			t.Cleanup(func() { db.Close() })
+			for _, stmt := range tt.create {
+				if _, err = db.Exec(stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, u := range testUsers {
+				if _, err = db.Exec("INSERT INTO "+tt.table+" (id, name, "+
+					"email, age) VALUES (?, ?, ?, ?)", u.ID, u.Name, u.Email,
+					u.Age); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The SELECT * rows are scanned by the column names
+			rows, _, err := ListRows[testUser](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(rows, testUsers) {
+				t.Errorf("got %+v, want %+v", rows, testUsers)
+			}
+			row, err := Get[testUser](db, Eq("id", 3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row != testUsers[2] {
+				t.Errorf("got %+v, want %+v", row, testUsers[2])
+			}
+		})
+	}
+}
+
+func TestUpdateExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		sets    map[string]Expression
+		wheres  []Where
+		times   int
+		want    map[int64]testUser // Changed rows
+		wantErr bool
+	}{
+		{"increment once", map[string]Expression{"age": Expr("age + ?", 1)},
+			[]Where{Eq("id", 2)}, 1, map[int64]testUser{
+				2: {2, "bob", "bob@example.com", 26}}, false},
+		{"increment three times", map[string]Expression{
+			"age": Expr("age + 1")}, []Where{Eq("id", 2)}, 3,
+			map[int64]testUser{2: {2, "bob", "bob@example.com", 28}}, false},
+		{"two columns and ordered args", map[string]Expression{
+			"name": Expr("name || ?", "!"), "age": Expr("age * ?", 2)},
+			[]Where{Eq("age", 30), Lt("id", 4)}, 1, map[int64]testUser{
+				1: {1, "alice!", "alice@example.com", 60}}, false},
+		{"unknown column", map[string]Expression{"count": Expr("count + 1")},
+			[]Where{Eq("id", 1)}, 1, nil, true},
+		{"where required", map[string]Expression{"age": Expr("age + 1")},
+			nil, 1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			for range tt.times {
+				err := UpdateExpr[testUser](db, tt.sets, tt.wheres...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+				}
+			}
+
+			// Only the matched rows are changed
+			rows, _, err := ListRows[testUser](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, row := range rows {
+				want, ok := tt.want[row.ID]
+				if !ok {
+					want = testUsers[i]
+				}
+				if row != want {
+					t.Errorf("got %+v, want %+v", row, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountEstimate(t *testing.T) {
+	db := openTestDB(t)
+
+	// estimate returns the SQLite dialect with the estimate statement
+	estimate := func(stmt string) query.Dialect {
+		d := query.SQLite
+		d.CountEstimate = func(string) string { return stmt }
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		dialect query.Dialect
+		want    int64
+		wantErr bool
+	}{
+		{"sqlite exact count fallback", query.SQLite, 5, false},
+		{"estimate", estimate("SELECT 42"), 42, false},
+		{"null estimate falls back", estimate("SELECT NULL"), 5, false},
+		{"negative estimate falls back", estimate("SELECT -1"), 5, false},
+		{"no estimate rows falls back", estimate("SELECT 1 WHERE 0"), 5,
+			false},
+		{"invalid estimate", estimate("SELECT FROM"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query.SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			got, err := CountEstimate[testUser](db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Missing table
+	type missing struct {
+		ID int64 `db:"id"`
+	}
+	if _, err := CountEstimate[missing](db); err == nil {
+		t.Error("got nil error for missing table")
+	}
+}
+
+func TestListPageWindow(t *testing.T) {
+
+	// noWindow is the dialect without window functions
+	noWindow := query.SQLite
+	noWindow.WindowFunctions = false
+
+	tests := []struct {
+		name        string
+		dialect     query.Dialect
+		page        int
+		pageSize    int
+		attrs       []ListAttr
+		want        []int64
+		wantTotal   int
+		wantQueries int
+	}{
+		{"first page", query.SQLite, 1, 2, nil, []int64{1, 2}, 5, 1},
+		{"last page", query.SQLite, 3, 2, nil, []int64{5}, 5, 1},
+		{"zero page is first", query.SQLite, 0, 2, nil, []int64{1, 2}, 5, 1},
+		{"filtered", query.SQLite, 2, 2, []ListAttr{Gte("age", 30)},
+			[]int64{4, 5}, 4, 1},
+		{"alias", query.SQLite, 1, 1, []ListAttr{Alias("t"),
+			Where{"t.age>=", 30}, Where{"name=", "alice"}}, []int64{1}, 2, 1},
+		{"empty result", query.SQLite, 1, 2, []ListAttr{Eq("name", "eve")},
+			nil, 0, 1},
+		{"page after last", query.SQLite, 4, 2, nil, nil, 5, 2},
+		{"no window functions", noWindow, 2, 2, nil, []int64{3, 4}, 5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query.SetDialect(tt.dialect)
+			t.Cleanup(ResetDefaults)
+
+			db := &recordQuerier{DB: openTestDB(t)}
+			rows, total, err := ListPageWindow[testUser](db, tt.page,
+				tt.pageSize, "id", tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := userIDs(rows); !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("got total %d, want %d", total, tt.wantTotal)
+			}
+			if len(db.queries) != tt.wantQueries {
+				t.Errorf("got queries %q, want %d queries", db.queries,
+					tt.wantQueries)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Struct hooks called by the write and read functions.
+
+package sqlh
+
+// BeforeInserter is implemented by structs which should be validated or
+// normalized before they are inserted into the database table. If the
+// BeforeInsert method returns an error the Insert function rolls back the
+// whole transaction and returns this error.
+//
+// Implement this method with pointer receiver to change the row fields.
+type BeforeInserter interface {
+	BeforeInsert() error
+}
+
+// BeforeUpdater is implemented by structs which should be validated or
+// normalized before they are updated in the database table. If the
+// BeforeUpdate method returns an error the Update function rolls back the
+// whole transaction and returns this error.
+//
+// Implement this method with pointer receiver to change the row fields.
+type BeforeUpdater interface {
+	BeforeUpdate() error
+}
+
+// beforeInsert calls BeforeInsert method of the row if it implements the
+// BeforeInserter interface.
+func beforeInsert[T any](row *T) error {
+	if h, ok := any(row).(BeforeInserter); ok {
+		return h.BeforeInsert()
+	}
+	if h, ok := any(*row).(BeforeInserter); ok {
+		return h.BeforeInsert()
+	}
+	return nil
+}
+
+// beforeUpdate calls BeforeUpdate method of the row if it implements the
+// BeforeUpdater interface.
+func beforeUpdate[T any](row *T) error {
+	if h, ok := any(row).(BeforeUpdater); ok {
+		return h.BeforeUpdate()
+	}
+	if h, ok := any(*row).(BeforeUpdater); ok {
+		return h.BeforeUpdate()
+	}
+	return nil
+}
+
+// AfterScanner is implemented by structs which should be post-processed after
+// they are read from the database table, f.e. to decode an encrypted field. If
+// the AfterScan method returns an error the reading function stops and returns
+// this error.
+//
+// Implement this method with pointer receiver to change the row fields.
+type AfterScanner interface {
+	AfterScan() error
+}
+
+// afterScan calls AfterScan method of the row if it implements the
+// AfterScanner interface.
+func afterScan[T any](row *T) error {
+	if h, ok := any(row).(AfterScanner); ok {
+		return h.AfterScan()
+	}
+	if h, ok := any(*row).(AfterScanner); ok {
+		return h.AfterScan()
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// errEmptyName is the hookedUser validation error.
+var errEmptyName = errors.New("empty name")
+
+// hookedUser is the tests struct with write hooks which trim the name and
+// reject the empty one.
+type hookedUser struct {
+	ID   int64  `db:"id" db_key:"primary key"`
+	Name string `db:"name"`
+}
+
+func (u *hookedUser) BeforeInsert() error { return u.validate() }
+func (u *hookedUser) BeforeUpdate() error { return u.validate() }
+
+func (u *hookedUser) validate() error {
+	u.Name = strings.TrimSpace(u.Name)
+	if u.Name == "" {
+		return errEmptyName
+	}
+	return nil
+}
+
+func TestBeforeInsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    []hookedUser
+		want    []hookedUser
+		wantErr error
+	}{
+		{"names trimmed", []hookedUser{{1, " alice "}, {2, "bob"}},
+			[]hookedUser{{1, "alice"}, {2, "bob"}}, nil},
+		{"empty name rejected", []hookedUser{{1, " "}}, nil, errEmptyName},
+		{"batch rolled back", []hookedUser{{1, "alice"}, {2, ""}}, nil,
+			errEmptyName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[hookedUser](db); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Insert(db, tt.rows...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			got, _, err := ListRows[hookedUser](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got rows %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBeforeUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     hookedUser
+		want    string
+		wantErr error
+	}{
+		{"name trimmed", hookedUser{1, " alicia "}, "alicia", nil},
+		{"empty name rejected", hookedUser{1, ""}, "alice", errEmptyName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[hookedUser](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, hookedUser{1, "alice"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Update(db, UpdateAttr[hookedUser]{tt.row,
+				[]Where{{"id=", tt.row.ID}}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			got, err := Get[hookedUser](db, Where{"id=", 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("got name %q, want %q", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+// errBadRow is the scannedUser AfterScan error.
+var errBadRow = errors.New("bad row")
+
+// scanCalls is the number of scannedUser AfterScan calls.
+var scanCalls int
+
+// scannedUser is the testUser struct with the AfterScan hook which upper
+// cases the name and fails on the "dave" row.
+type scannedUser testUser
+
+func (u *scannedUser) AfterScan() error {
+	scanCalls++
+	if u.Name == "dave" {
+		return errBadRow
+	}
+	u.Name = strings.ToUpper(u.Name)
+	return nil
+}
+
+func TestAfterScan(t *testing.T) {
+	tests := []struct {
+		name      string
+		wheres    []ListAttr
+		wantNames []string
+		wantCalls int
+		wantErr   error
+	}{
+		{"called once per row", []ListAttr{Where{"id<", 4}},
+			[]string{"ALICE", "BOB", "CAROL"}, 3, nil},
+		{"error stops iteration", nil, []string{"ALICE", "BOB", "CAROL"}, 4,
+			errBadRow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			scanCalls = 0
+
+			var names []string
+			var err error
+			attrs := append([]ListAttr{SetName("testuser")}, tt.wheres...)
+			for row, e := range ListRange[scannedUser](db, 0, "id", attrs...) {
+				if err = e; err != nil {
+					break
+				}
+				names = append(names, row.Name)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("got names %v, want %v", names, tt.wantNames)
+			}
+			if scanCalls != tt.wantCalls {
+				t.Errorf("got %d AfterScan calls, want %d", scanCalls,
+					tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestInsertNilRow(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []*hookedUser
+	}{
+		{"nil row", []*hookedUser{nil}},
+		{"nil row after valid row", []*hookedUser{{1, "alice"}, nil}},
+		{"nil row before valid row", []*hookedUser{nil, {1, "alice"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[hookedUser](db); err != nil {
+				t.Fatal(err)
+			}
+
+			// The nil row is rejected before its hook is called, so there is
+			// no nil pointer dereference, and the batch is rolled back
+			err := Insert(db, tt.rows...)
+			if err == nil || !strings.Contains(err.Error(), "nil row") {
+				t.Fatalf("got error %v, want nil row error", err)
+			}
+			got, _, err := ListRowsAttrs[hookedUser](db, 0, "id", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 0 {
+				t.Errorf("got rows %+v, want none", got)
+			}
+		})
+	}
+
+	// The nil row of InsertOne is rejected too
+	db := openTestDB(t)
+	_, err := InsertOne[*hookedUser](db, nil)
+	if err == nil || !strings.Contains(err.Error(), "nil row") {
+		t.Fatalf("got error %v, want nil row error", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Joined tables queries.
+
+package sqlh
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// Pair is the row of two joined tables returned by the Join2 function. The B
+// is nil if the left join found no matching B table row.
+type Pair[A, B any] struct {
+	A *A
+	B *B
+}
+
+// Join2 returns an iterator over the rows of A database table joined with B
+// database table, so the two tables join does not require the result struct.
+//
+// The A table is selected with the "a" alias and the B table is joined with
+// the "b" alias using the given join type, f.e. "LEFT JOIN", and the on
+// condition, f.e. "a.id = b.a_id". The attrs parameter is a list of List
+// functions attributes: Where, Limit, Offset and Orders. The not qualified
+// where fields of A table columns are qualified with the "a" alias, use
+// qualified fields for B table columns, f.e. Where{"b.value>", 10}.
+//
+// The iterator yields each pair with nil error. If an error occurs, it yields
+// the zero pair and the error and stops.
+//
+// Example:
+//
+//	for p, err := range sqlh.Join2[User, Order](db, "LEFT JOIN",
+//		"a.id = b.user_id") {
+//		if err != nil {
+//			return err
+//		}
+//		// Use p.A and p.B, the p.B is nil for users without orders
+//	}
+func Join2[A, B any](db querier, joinType, on string,
+	attrs ...ListAttr) iter.Seq2[Pair[A, B], error] {
+	return func(yield func(Pair[A, B], error) bool) {
+		var pair Pair[A, B]
+
+		// Create select statement
+		attr, selectArgs, err := listAttr[A](0, "", 0,
+			append([]ListAttr{Alias("a")}, attrs...)...)
+		if err != nil {
+			yield(pair, err)
+			return
+		}
+		attr.Joins = []query.Join{query.MakeJoin[B](joinType, "b", on)}
+		selectStmt, err := query.Select[A](attr)
+		if err != nil {
+			yield(pair, err)
+			return
+		}
+
+		sqlRows, err := db.QueryContext(context.Background(), selectStmt,
+			selectArgs...)
+		if err != nil {
+			yield(pair, err)
+			return
+		}
+		defer sqlRows.Close()
+
+		// Get rows
+		numA := len(query.Columns[A](true))
+		numB := len(query.Columns[B](true))
+		for sqlRows.Next() {
+			p, err := scanPair[A, B](sqlRows, numA, numB)
+			if err != nil {
+				yield(pair, err)
+				return
+			}
+			if !yield(p, nil) {
+				return
+			}
+		}
+		if err = sqlRows.Err(); err != nil {
+			yield(pair, err)
+		}
+	}
+}
+
+// scanPair scans current sql rows row with numA A table columns followed by
+// numB B table columns into the pair. The pair B is nil if all B table columns
+// are NULL.
+func scanPair[A, B any](sqlRows *sql.Rows, numA, numB int) (pair Pair[A, B],
+	err error) {
+
+	// Make scan arguments for each column
+	args := make([]any, numA+numB)
+	for i := range args {
+		args[i] = new(any)
+	}
+	if err = sqlRows.Scan(args...); err != nil {
+		return
+	}
+
+	// Set A struct fields
+	a := new(A)
+	if err = query.ArgsAppay(a, args[:numA]); err != nil {
+		return
+	}
+	if err = afterScan(a); err != nil {
+		return
+	}
+	pair.A = a
+
+	// Skip B struct if the left join found no matching row
+	found := false
+	for _, arg := range args[numA:] {
+		if *arg.(*any) != nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	// Set B struct fields
+	b := new(B)
+	if err = query.ArgsAppay(b, args[numA:]); err != nil {
+		return
+	}
+	if err = afterScan(b); err != nil {
+		return
+	}
+	pair.B = b
+
+	return
+}
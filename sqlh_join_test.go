@@ -0,0 +1,376 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testOrder is the tests struct joined with testUser, both have the id and
+// name columns.
+type testOrder struct {
+	ID     int64  `db:"id"`
+	UserID int64  `db:"user_id"`
+	Name   string `db:"name"`
+	Amount int    `db:"amount"`
+}
+
+// testOrders are the rows inserted by the openOrdersDB function.
+var testOrders = []testOrder{
+	{10, 1, "book", 15},
+	{11, 1, "pen", 5},
+	{12, 2, "alice", 7},
+	{13, 3, "lamp", 30},
+}
+
+// openOrdersDB opens the test database with the testorder table filled with
+// testOrders rows.
+func openOrdersDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if err := CreateTable[testOrder](db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Insert(db, testOrders...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// joinIDs returns the users and orders ids of the pairs, zero order id for
+// the pair without order.
+func joinIDs(t testing.TB, db *sql.DB, joinType string,
+	attrs ...ListAttr) (ids [][2]int64) {
+	t.Helper()
+	for p, err := range Join2[testUser, testOrder](db, joinType,
+		"a.id = b.user_id", attrs...) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := [2]int64{p.A.ID}
+		if p.B != nil {
+			id[1] = p.B.ID
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+func TestJoinWhereAlias(t *testing.T) {
+	db := openOrdersDB(t)
+
+	tests := []struct {
+		name  string
+		attrs []ListAttr
+		want  [][2]int64
+	}{
+		{"not qualified column of A table", []ListAttr{
+			Where{"name=", "alice"}, OrderBy(Order{"b.id", false})},
+			[][2]int64{{1, 10}, {1, 11}}},
+		{"qualified column of B table", []ListAttr{Where{"b.name=", "alice"}},
+			[][2]int64{{2, 12}}},
+		{"both tables", []ListAttr{Eq("name", "bob"), Gt("b.amount", 5)},
+			[][2]int64{{2, 12}}},
+		{"or group", []ListAttr{Or(Eq("id", 3), Eq("b.id", 11)),
+			OrderBy(Order{"id", false})}, [][2]int64{{1, 11}, {3, 13}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := joinIDs(t, db, "JOIN", tt.attrs...)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeftJoinNull(t *testing.T) {
+	db := openOrdersDB(t)
+
+	// userOrder is the flat LEFT JOIN row with not pointer order fields
+	type userOrder struct {
+		UserID  int64   `db:"user_id"`
+		OrderID int64   `db:"order_id"`
+		Item    string  `db:"item"`
+		Amount  int     `db:"amount"`
+		Share   float64 `db:"share"`
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   []userOrder
+	}{
+		{"user with orders", 1, []userOrder{{1, 10, "book", 15, 1.5},
+			{1, 11, "pen", 5, 0.5}}},
+		{"user without orders", 4, []userOrder{{UserID: 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := QueryRows[userOrder](db, "SELECT a.id AS user_id, "+
+				"b.id AS order_id, b.name AS item, b.amount, "+
+				"b.amount / 10.0 AS share FROM testuser a "+
+				"LEFT JOIN testorder b ON a.id = b.user_id WHERE a.id = ? "+
+				"ORDER BY b.id", tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(rows, tt.want) {
+				t.Errorf("got %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryRowsEmbedded(t *testing.T) {
+	db := openOrdersDB(t)
+
+	// userOrder embeds both tables structs, the order is nil if the LEFT JOIN
+	// found no match
+	type User = testUser
+	type Order = testOrder
+	type userOrder struct {
+		User
+		*Order
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   []userOrder
+	}{
+		{"match", 2, []userOrder{{testUsers[1], &testOrders[2]}}},
+		{"two matches", 1, []userOrder{{testUsers[0], &testOrders[0]},
+			{testUsers[0], &testOrders[1]}}},
+		{"no match", 4, []userOrder{{testUsers[3], nil}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := QueryRows[userOrder](db, "SELECT a.*, b.* "+
+				"FROM testuser a LEFT JOIN testorder b ON a.id = b.user_id "+
+				"WHERE a.id = ? ORDER BY b.id", tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, row := range rows {
+				want := tt.want[i]
+				if row.User != want.User {
+					t.Errorf("row %d: got user %+v, want %+v", i, row.User,
+						want.User)
+				}
+				switch {
+				case want.Order == nil && row.Order != nil:
+					t.Errorf("row %d: got order %+v, want nil", i, *row.Order)
+				case want.Order != nil && (row.Order == nil ||
+					*row.Order != *want.Order):
+					t.Errorf("row %d: got order %v, want %+v", i, row.Order,
+						*want.Order)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupByAggregate(t *testing.T) {
+	db := openOrdersDB(t)
+
+	// userTotal is the grouped orders result struct
+	type userTotal struct {
+		UserID int64   `db:"user_id"`
+		Cnt    int     `db:"cnt"`
+		Total  float64 `db:"total"`
+	}
+
+	aggregate := []ListAttr{SetName("testorder"),
+		Project("user_id", "count(*) AS cnt", "sum(amount) AS total"),
+		GroupBy("user_id")}
+	tests := []struct {
+		name     string
+		attrs    []ListAttr
+		wantStmt string
+		want     []userTotal
+		wantErr  bool
+	}{
+		{"totals per user", aggregate,
+			"SELECT user_id, count(*) AS cnt, sum(amount) AS total " +
+				"from testorder GROUP BY user_id ORDER BY user_id LIMIT 10;",
+			[]userTotal{{1, 2, 20}, {2, 1, 7}, {3, 1, 30}}, false},
+		{"with where", append(slices.Clone(aggregate), Gt("amount", 6)),
+			"SELECT user_id, count(*) AS cnt, sum(amount) AS total " +
+				"from testorder where amount > ? GROUP BY user_id " +
+				"ORDER BY user_id LIMIT 10;",
+			[]userTotal{{1, 1, 15}, {2, 1, 7}, {3, 1, 30}}, false},
+		{"alias is not struct field", []ListAttr{SetName("testorder"),
+			Project("user_id", "count(*) AS orders"), GroupBy("user_id")},
+			"", nil, true},
+		{"invalid group by column", []ListAttr{SetName("testorder"),
+			Project("user_id", "count(*) AS cnt"),
+			GroupBy("user_id; DROP TABLE testorder")}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := ListSQL[userTotal](0, "user_id", tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+
+			rows, _, err := ListAttrs[userTotal](db, 0, "user_id",
+				tt.attrs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got list error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(rows, tt.want) {
+				t.Errorf("got %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+
+	// The page total is the number of groups
+	pages := []struct {
+		name      string
+		list      func() ([]userTotal, int, error)
+		wantRows  int
+		wantTotal int
+	}{
+		{"page", func() ([]userTotal, int, error) {
+			return ListPage[userTotal](db, 1, 2, "user_id", aggregate...)
+		}, 2, 3},
+		{"page with where", func() ([]userTotal, int, error) {
+			return ListPage[userTotal](db, 1, 1, "user_id",
+				append(slices.Clone(aggregate), Gt("amount", 6))...)
+		}, 1, 3},
+		{"window page out of rows", func() ([]userTotal, int, error) {
+			return ListPageWindow[userTotal](db, 3, 2, "user_id",
+				aggregate...)
+		}, 0, 3},
+	}
+	for _, tt := range pages {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, total, err := tt.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows || total != tt.wantTotal {
+				t.Errorf("got %d rows of %d, want %d rows of %d", len(rows),
+					total, tt.wantRows, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestJoin2(t *testing.T) {
+	db := openOrdersDB(t)
+
+	tests := []struct {
+		name     string
+		joinType string
+		attrs    []ListAttr
+		want     [][2]int64
+		wantErr  bool
+	}{
+		{"left join", "LEFT JOIN", []ListAttr{OrderBy(Order{"id", false},
+			Order{"b.id", false})},
+			[][2]int64{{1, 10}, {1, 11}, {2, 12}, {3, 13}, {4, 0}, {5, 0}},
+			false},
+		{"inner join", "JOIN", []ListAttr{OrderBy(Order{"b.id", true})},
+			[][2]int64{{3, 13}, {2, 12}, {1, 11}, {1, 10}}, false},
+		{"order by column of both tables", "JOIN", []ListAttr{
+			OrderBy(Order{"name", true}, Order{"b.name", false})},
+			[][2]int64{{3, 13}, {2, 12}, {1, 10}, {1, 11}}, false},
+		{"order by id of both tables", "LEFT JOIN", []ListAttr{
+			OrderBy(Order{"id", true}), Limit(3)},
+			[][2]int64{{5, 0}, {4, 0}, {3, 13}}, false},
+		{"where and limit", "LEFT JOIN", []ListAttr{Gt("age", 28),
+			OrderBy(Order{"id", false}, Order{"b.amount", true}), Limit(3)},
+			[][2]int64{{1, 10}, {1, 11}, {3, 13}}, false},
+		{"unknown order column", "JOIN", []ListAttr{
+			OrderBy(Order{"amount", false})}, nil, true},
+		{"invalid join type", "CROSS JOIN", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]int64
+			var err error
+			for p, e := range Join2[testUser, testOrder](db, tt.joinType,
+				"a.id = b.user_id", tt.attrs...) {
+				if err = e; err != nil {
+					break
+				}
+
+				// The pair tables rows are typed
+				id := [2]int64{p.A.ID}
+				if p.B != nil {
+					if p.B.UserID != p.A.ID {
+						t.Errorf("got order %+v of user %+v", *p.B, *p.A)
+					}
+					id[1] = p.B.ID
+				}
+				got = append(got, id)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinWhereSpacing(t *testing.T) {
+	db := openOrdersDB(t)
+
+	tests := []struct {
+		name      string
+		where     Where
+		wantWhere string
+		want      [][2]int64
+	}{
+		{"spaced operator", Where{"b.amount >", 10}, "b.amount > ?",
+			[][2]int64{{1, 10}, {3, 13}}},
+		{"glued operator", Where{"b.amount>", 10}, "b.amount > ?",
+			[][2]int64{{1, 10}, {3, 13}}},
+		{"two chars operator", Where{"b.amount>=", 15}, "b.amount >= ?",
+			[][2]int64{{1, 10}, {3, 13}}},
+		{"trailing spaces", Where{"b.amount <=   ", 5}, "b.amount <= ?",
+			[][2]int64{{1, 11}}},
+		{"main table column qualified", Where{"name<>", "alice"},
+			"a.name <> ?", [][2]int64{{2, 12}, {3, 13}}},
+		{"word operator", Where{"b.name LIKE", "l%"}, "b.name LIKE ?",
+			[][2]int64{{3, 13}}},
+		{"in list", Where{"b.id in", []int{11, 12}}, "b.id in (?,?)",
+			[][2]int64{{1, 11}, {2, 12}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The Join2 where clauses are the List where clauses with the
+			// "a" alias
+			stmt, _, err := ListSQL[testUser](0, "", Alias("a"), tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stmt, " where "+tt.wantWhere+" ") {
+				t.Errorf("got statement %q, want where %q", stmt,
+					tt.wantWhere)
+			}
+
+			got := joinIDs(t, db, "JOIN", tt.where, OrderBy(Order{"b.id",
+				false}))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
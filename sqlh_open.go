@@ -0,0 +1,71 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Database open helper functions.
+
+package sqlh
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// OpenDialect opens the database with the given driver name and data source
+// name and sets current SQL dialect by the driver name, see
+// query.DriverDialect. It returns an error if the driver name is unknown, so
+// the statements are never generated with the wrong dialect placeholders.
+func OpenDialect(driverName, dsn string) (db *sql.DB, d query.Dialect,
+	err error) {
+
+	// Get dialect by driver name
+	d, ok := query.DriverDialect(driverName)
+	if !ok {
+		err = fmt.Errorf("unknown dialect of database driver %s", driverName)
+		return
+	}
+
+	// Open database and set dialect
+	if db, err = sql.Open(driverName, dsn); err != nil {
+		return
+	}
+	query.SetDialect(d)
+
+	return
+}
+
+// DetectDialect sets current SQL dialect by the db driver package, f.e.
+// "github.com/lib/pq" and "github.com/jackc/pgx/v5/stdlib" for Postgres,
+// "github.com/go-sql-driver/mysql" for MySQL, "github.com/mattn/go-sqlite3"
+// and "modernc.org/sqlite" for SQLite. It returns the detected dialect, or
+// current dialect and false if the driver is unknown.
+func DetectDialect(db *sql.DB) (d query.Dialect, ok bool) {
+
+	// Get driver package path
+	t := reflect.TypeOf(db.Driver())
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pkg := strings.ToLower(t.PkgPath())
+
+	// Get dialect by driver package
+	switch {
+	case strings.Contains(pkg, "sqlite"):
+		d, ok = query.DriverDialect("sqlite")
+	case strings.Contains(pkg, "mysql"):
+		d, ok = query.DriverDialect("mysql")
+	case strings.HasSuffix(pkg, "/pq") || strings.Contains(pkg, "pgx") ||
+		strings.Contains(pkg, "postgres"):
+		d, ok = query.DriverDialect("postgres")
+	}
+	if !ok {
+		return query.GetDialect(), false
+	}
+	query.SetDialect(d)
+
+	return
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// unknownDriver is the tests database driver of unknown database.
+type unknownDriver struct{}
+
+func (unknownDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func init() {
+	sql.Register("sqlh_unknown", unknownDriver{})
+}
+
+func TestOpenDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		want    string
+		wantErr bool
+	}{
+		{"sqlite3", "sqlite3", "sqlite", false},
+		{"unknown dialect", "sqlh_unknown", "postgres", true},
+		{"not registered driver", "mysql", "mysql", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(ResetDefaults)
+			query.SetDialect(query.Postgres)
+
+			db, d, err := OpenDialect(tt.driver, ":memory:")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer db.Close()
+			if d.Name != tt.want || query.GetDialect().Name != tt.want {
+				t.Errorf("got dialect %s current %s, want %s", d,
+					query.GetDialect(), tt.want)
+			}
+
+			// The opened database works with current dialect statements
+			if err = CreateTable[testUser](db); err != nil {
+				t.Fatal(err)
+			}
+			if err = Insert(db, testUsers...); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = Get[testUser](db, Eq("id", 1)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		want   string
+		wantOk bool
+	}{
+		{"sqlite3", "sqlite3", "sqlite", true},
+		{"unknown driver keeps current", "sqlh_unknown", "postgres", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(ResetDefaults)
+			query.SetDialect(query.Postgres)
+
+			db, err := sql.Open(tt.driver, ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			d, ok := DetectDialect(db)
+			if ok != tt.wantOk || d.Name != tt.want {
+				t.Errorf("got %s %v, want %s %v", d, ok, tt.want, tt.wantOk)
+			}
+			if got := query.GetDialect().Name; got != tt.want {
+				t.Errorf("got current dialect %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
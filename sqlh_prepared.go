@@ -0,0 +1,108 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Prepared statements.
+
+package sqlh
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// PreparedList is the prepared List function statement which is executed
+// repeatedly with different where conditions values. Create it with the
+// PrepareList function and close it with the Close method when it is not
+// needed anymore.
+type PreparedList[T any] struct {
+	stmt    *sql.Stmt // Prepared statement
+	query   string    // Statement text used in the error messages
+	numArgs int       // Number of statement arguments
+}
+
+// PrepareList creates the SELECT statement of the List function for the given
+// orderBy and attrs parameters once and prepares it on the db, so it may be
+// executed many times with the PreparedList Run method without building the
+// statement again.
+//
+// The Where attributes values are used to create the statement only, the Run
+// method arguments replace them. The IN lists are expanded to the placeholders
+// when the statement is prepared, so the Run IN list arguments should have the
+// same number of values. The IN lists are not split into chunks, see
+// query.SetMaxInParams.
+//
+// Example:
+//
+//	list, err := sqlh.PrepareList[User](db, "name", sqlh.Where{"role=", ""})
+//	if err != nil {
+//		return err
+//	}
+//	defer list.Close()
+//	admins, err := list.Run("admin")
+func PrepareList[T any](db *sql.DB, orderBy string, attrs ...ListAttr) (
+	list *PreparedList[T], err error) {
+
+	// Create select statement
+	selectStmt, selectArgs, err := listStatement[T](0, orderBy, GetNumRows(),
+		attrs...)
+	if err != nil {
+		return
+	}
+
+	// Prepare statement
+	stmt, err := db.Prepare(selectStmt)
+	if err != nil {
+		return
+	}
+
+	list = &PreparedList[T]{stmt, selectStmt, len(selectArgs)}
+	return
+}
+
+// Run executes the prepared statement with the given where conditions values
+// in the where conditions order and returns the selected rows. The rows are
+// scanned the same way as in the List function.
+func (l *PreparedList[T]) Run(args ...any) (rows []T, err error) {
+
+	// Check arguments
+	if len(args) != l.numArgs {
+		err = fmt.Errorf("prepared list expects %d arguments, got %d, "+
+			"query: %s", l.numArgs, len(args), l.query)
+		return
+	}
+
+	sqlRows, err := l.stmt.Query(args...)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Check that the result set columns match the struct fields
+	columns, err := checkColumns[T](sqlRows, l.query)
+	if err != nil {
+		return
+	}
+
+	// Get rows
+	for sqlRows.Next() {
+		var row T
+		if columns != nil {
+			err = scanNamed(sqlRows, columns, &row)
+		} else {
+			err = scanRow(sqlRows, &row)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	err = sqlRows.Err()
+
+	return
+}
+
+// Close closes the prepared statement.
+func (l *PreparedList[T]) Close() error {
+	return l.stmt.Close()
+}
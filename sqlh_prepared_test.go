@@ -0,0 +1,96 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPrepareList(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name    string
+		orderBy string
+		attrs   []ListAttr
+		runs    [][]any   // Run arguments
+		want    [][]int64 // Run results ids
+		wantErr bool
+	}{
+		{"two arg sets", "id", []ListAttr{Where{"name=", ""}},
+			[][]any{{"alice"}, {"bob"}}, [][]int64{{1, 5}, {2}}, false},
+		{"two conditions", "id", []ListAttr{Gt("age", 0), Lt("id", 0)},
+			[][]any{{25, 5}, {29, 3}, {100, 10}},
+			[][]int64{{1, 3, 4}, {1}, nil}, false},
+		{"in list", "id", []ListAttr{In("id", []int{0, 0})},
+			[][]any{{1, 3}, {4, 5}}, [][]int64{{1, 3}, {4, 5}}, false},
+		{"limit", "id", []ListAttr{Gte("age", 0), Limit(2)},
+			[][]any{{30}, {0}}, [][]int64{{1, 3}, {1, 2}}, false},
+		{"wrong number of args", "id", []ListAttr{Where{"name=", ""}},
+			[][]any{{"alice", "bob"}}, [][]int64{nil}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := PrepareList[testUser](db, tt.orderBy, tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer list.Close()
+
+			// Each run returns the same rows as the List function with the
+			// same arguments
+			for i, args := range tt.runs {
+				rows, err := list.Run(args...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("run %d: got error %v, want error %v", i+1, err,
+						tt.wantErr)
+				}
+				if ids := userIDs(rows); !slices.Equal(ids, tt.want[i]) {
+					t.Errorf("run %d: got ids %v, want %v", i+1, ids,
+						tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Unknown order column is returned by PrepareList
+	if _, err := PrepareList[testUser](db, "missing"); err == nil {
+		t.Error("got no error, want unknown column error")
+	}
+}
+
+// BenchmarkPrepareList compares the prepared list run with the List function
+// which builds and prepares the statement on each call.
+func BenchmarkPrepareList(b *testing.B) {
+	db := openTestDB(b)
+
+	b.Run("List", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_, _, err := List[testUser](db, 0, "id", Where{"age>", i % 40},
+				Where{"name<>", "bob"})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("PreparedList", func(b *testing.B) {
+		list, err := PrepareList[testUser](db, "id", Where{"age>", 0},
+			Where{"name<>", ""})
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer list.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := range b.N {
+			if _, err = list.Run(i%40, "bob"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,402 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Raw queries helper functions.
+
+package sqlh
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"iter"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// QueryRangeNamed executes the given raw SQL query and returns an iterator
+// over the result rows scanned into T struct.
+//
+// The result set columns are matched to the struct fields by database field
+// name (the db tag or lower case field name), so the query columns may be in
+// any order and may include aliases, f.e. "SELECT name, count(*) AS cnt ...".
+// Columns without matching struct field are skipped, and struct fields without
+// matching column are left zero. Use table qualified db tags, f.e. db:"t.id"
+// and db:"o.id", to scan join results with the same column names, see
+// query.ArgsAppayNamed.
+//
+// If the struct fields are tagged with db_index, the fields are bound to the
+// result set columns by position instead of name, f.e. to scan the stored
+// procedures results, and the columns without db_index fields are skipped,
+// see query.IndexColumns.
+//
+// If the T struct implements the AfterScanner interface its AfterScan method is
+// called for each row after it is scanned.
+//
+// The iterator yields each row with nil error. If an error occurs, it yields
+// the zero row and the error and stops.
+//
+// Example:
+//
+//	for row, err := range sqlh.QueryRangeNamed[Report](db, query, args...) {
+//		if err != nil {
+//			return err
+//		}
+//		// Use row
+//	}
+func QueryRangeNamed[T any](db *sql.DB, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		// Execute the query
+		sqlRows, err := db.Query(query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer sqlRows.Close()
+
+		// Get result set columns
+		columns, err := scanColumns[T](sqlRows)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// Get rows
+		for sqlRows.Next() {
+			var row T
+			if err = scanNamed(sqlRows, columns, &row); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err = sqlRows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// QueryRows executes the given raw SQL query and returns the result rows
+// scanned into T structs slice.
+//
+// It works the same way as the QueryRangeNamed function but collects the rows
+// into slice, so it may be used for one-shot queries with a locally declared
+// T struct type, f.e.:
+//
+//	type row struct {
+//		Name  string `db:"name"`
+//		Total int    `db:"total"`
+//	}
+//	rows, err := sqlh.QueryRows[row](db, "SELECT u.name, sum(o.sum) AS total "+
+//		"FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.name")
+func QueryRows[T any](db *sql.DB, query string, args ...any) (rows []T,
+	err error) {
+
+	for row, err := range QueryRangeNamed[T](db, query, args...) {
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return
+}
+
+// scanColumns returns the columns names used to scan the sql rows into T
+// struct by name: the result set columns, or the columns made from the T
+// struct db_index tags if the struct has them, see query.IndexColumns.
+func scanColumns[T any](sqlRows *sql.Rows) (columns []string, err error) {
+	if columns, err = sqlRows.Columns(); err != nil {
+		return
+	}
+	indexColumns, err := query.IndexColumns[T](len(columns))
+	if err != nil || indexColumns == nil {
+		return
+	}
+	columns = indexColumns
+	return
+}
+
+// scanNamed scans current sql rows row into the row struct matching the
+// result set columns to the struct fields by name. The struct fields without
+// matching columns are not changed.
+func scanNamed[T any](sqlRows *sql.Rows, columns []string, row *T) (err error) {
+
+	// Make scan arguments for each column
+	args := make([]any, len(columns))
+	for i := range args {
+		args[i] = new(any)
+	}
+	if err = sqlRows.Scan(args...); err != nil {
+		return
+	}
+
+	// Set struct fields from the scanned arguments
+	if err = query.ArgsAppayNamed(row, columns, args); err != nil {
+		return
+	}
+
+	// Call after scan hook
+	err = afterScan(row)
+	return
+}
+
+// ScanStruct scans the current row of the given sql rows into T struct. Call
+// it after the sql.Rows.Next method returns true.
+//
+// The result set columns are matched to the struct fields by name the same way
+// as in the QueryRangeNamed function, so it may be used with the hand-written
+// queries executed with database/sql directly.
+func ScanStruct[T any](rows *sql.Rows) (row T, err error) {
+
+	// Get result set columns
+	columns, err := scanColumns[T](rows)
+	if err != nil {
+		return
+	}
+
+	err = scanNamed(rows, columns, &row)
+	return
+}
+
+// ScanAll scans all remaining rows of the given sql rows into T structs slice
+// and closes the rows. The rows are scanned the same way as in the ScanStruct
+// function.
+func ScanAll[T any](rows *sql.Rows) (all []T, err error) {
+	defer rows.Close()
+
+	// Get result set columns
+	columns, err := scanColumns[T](rows)
+	if err != nil {
+		return
+	}
+
+	// Get rows
+	for rows.Next() {
+		var row T
+		if err = scanNamed(rows, columns, &row); err != nil {
+			return nil, err
+		}
+		all = append(all, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// QueryScalar executes the given raw SQL query and returns the first column of
+// the first result row scanned into V value.
+//
+// It may be used to get aggregate values without defining a struct, f.e.
+// "SELECT max(price) FROM products". The V type may be any type supported by
+// the sql.Rows.Scan method: int, float64, string, time.Time and others. If the
+// query returns no rows the function returns sql.ErrNoRows.
+//
+// The NULL value, f.e. "max" of the empty table, is returned as the zero V
+// value without error. Use the pointer V type, f.e. *int, to tell NULL from
+// the zero value, the NULL is returned as nil.
+func QueryScalar[V any](db *sql.DB, query string, args ...any) (v V,
+	err error) {
+
+	// Execute the query
+	sqlRows, err := db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Check if the row is found
+	if !sqlRows.Next() {
+		if err = sqlRows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+
+	// Get result set columns
+	columns, err := sqlRows.Columns()
+	if err != nil {
+		return
+	}
+
+	// Scan first column into nullable value and skip others
+	var null sql.Null[V]
+	kind := reflect.TypeFor[V]().Kind()
+	nullable := kind == reflect.Ptr || kind == reflect.Interface
+	scanArgs := make([]any, len(columns))
+	scanArgs[0] = &null
+	if nullable {
+		scanArgs[0] = &v
+	}
+	for i := 1; i < len(scanArgs); i++ {
+		scanArgs[i] = new(any)
+	}
+	if err = sqlRows.Scan(scanArgs...); err != nil {
+		return
+	}
+
+	// Set not nullable value, NULL is the zero value
+	if !nullable {
+		v = null.V
+	}
+
+	return
+}
+
+// QueryMaps executes the given raw SQL query and returns result rows as maps
+// keyed by column name.
+//
+// The map values Go types are chosen from the column types reported by the
+// driver: integer columns become int64, floating point columns float64, bool
+// columns bool, time columns time.Time and text columns string. Other columns
+// get the value returned by the driver as is. NULL values become nil entries.
+func QueryMaps(db *sql.DB, query string, args ...any) (rows []map[string]any,
+	err error) {
+
+	// Execute the query
+	sqlRows, err := db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Get result set columns and its types
+	columns, err := sqlRows.Columns()
+	if err != nil {
+		return
+	}
+	columnTypes, err := sqlRows.ColumnTypes()
+	if err != nil {
+		return
+	}
+
+	// Get rows
+	for sqlRows.Next() {
+
+		// Make scan arguments by column types
+		scanArgs := make([]any, len(columnTypes))
+		for i, ct := range columnTypes {
+			scanArgs[i] = scanValue(ct)
+		}
+		if err = sqlRows.Scan(scanArgs...); err != nil {
+			return
+		}
+
+		// Make row map from the scanned arguments
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if row[column], err = mapValue(scanArgs[i]); err != nil {
+				return
+			}
+		}
+		rows = append(rows, row)
+	}
+	err = sqlRows.Err()
+
+	return
+}
+
+// scanValue returns a nullable scan destination for the given column type.
+func scanValue(ct *sql.ColumnType) any {
+
+	// Column type is not reported by the driver
+	scanType := ct.ScanType()
+	if scanType == nil {
+		return new(any)
+	}
+
+	// Driver already reports nullable type
+	if reflect.PointerTo(scanType).Implements(reflect.TypeFor[sql.Scanner]()) {
+		return reflect.New(scanType).Interface()
+	}
+
+	switch scanType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(sql.NullInt64)
+	case reflect.Float32, reflect.Float64:
+		return new(sql.NullFloat64)
+	case reflect.Bool:
+		return new(sql.NullBool)
+	case reflect.String:
+		return new(sql.NullString)
+	}
+	if scanType == reflect.TypeFor[time.Time]() {
+		return new(sql.NullTime)
+	}
+
+	return new(any)
+}
+
+// mapValue returns value of the scan destination created by scanValue.
+// NULL values are returned as nil.
+func mapValue(v any) (any, error) {
+	switch v := v.(type) {
+	case *any:
+		return *v, nil
+	case driver.Valuer:
+		return v.Value()
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// QueryHook is the function called after the raw statement is executed with
+// the statement, its arguments, execution duration and error, f.e. to log the
+// statements.
+type QueryHook func(query string, args []any, d time.Duration, err error)
+
+// queryHook is current QueryHook, nil if it is not set.
+var queryHook atomic.Pointer[QueryHook]
+
+// SetQueryHook sets the hook called after each statement executed with the
+// Exec and ExecTx functions, f.e.:
+//
+//	sqlh.SetQueryHook(func(q string, args []any, d time.Duration, err error) {
+//		log.Printf("sqlh: %s %v %s %v", q, args, d, err)
+//	})
+//
+// The nil hook removes current hook. It is safe for concurrent use.
+func SetQueryHook(hook QueryHook) {
+	if hook == nil {
+		queryHook.Store(nil)
+		return
+	}
+	queryHook.Store(&hook)
+}
+
+// callQueryHook calls current query hook if it is set.
+func callQueryHook(query string, args []any, start time.Time, err error) {
+	if hook := queryHook.Load(); hook != nil {
+		(*hook)(query, args, time.Since(start), err)
+	}
+}
+
+// Exec executes the given raw SQL statement which is not covered by the
+// statement builders, f.e. "VACUUM" or "CREATE TRIGGER ...". The query hook
+// is called after the statement is executed, see SetQueryHook.
+func Exec(db *sql.DB, query string, args ...any) (res sql.Result, err error) {
+	start := time.Now()
+	res, err = db.Exec(query, args...)
+	callQueryHook(query, args, start, err)
+	return
+}
+
+// ExecTx executes the given raw SQL statement within the given transaction.
+// The query hook is called the same way as in the Exec function.
+func ExecTx(tx *sql.Tx, query string, args ...any) (res sql.Result,
+	err error) {
+
+	start := time.Now()
+	res, err = tx.Exec(query, args...)
+	callQueryHook(query, args, start, err)
+	return
+}
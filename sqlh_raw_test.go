@@ -0,0 +1,482 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryRangeNamed(t *testing.T) {
+	db := openTestDB(t)
+
+	type report struct {
+		Name  string `db:"name"`
+		Total int    `db:"total"`
+		Skip  string `db:"skip"`
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		arg   string
+		want  []report
+	}{
+		{"reordered columns",
+			"SELECT sum(age) AS total, name FROM testuser WHERE name = ? " +
+				"GROUP BY name", "alice",
+			[]report{{Name: "alice", Total: 70}}},
+		{"unmatched column skipped",
+			"SELECT id, name, age AS total FROM testuser WHERE name = ? " +
+				"ORDER BY id", "alice",
+			[]report{{Name: "alice", Total: 30}, {Name: "alice", Total: 40}}},
+		{"no rows", "SELECT name, age AS total FROM testuser WHERE name = ?",
+			"nobody", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []report
+			for row, err := range QueryRangeNamed[report](db, tt.query,
+				tt.arg) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, row)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(got), len(tt.want))
+			}
+			for j := range got {
+				if got[j] != tt.want[j] {
+					t.Errorf("row %d: got %+v, want %+v", j, got[j], tt.want[j])
+				}
+			}
+		})
+	}
+}
+
+// TestQueryRangeNamedScanError checks that the row scan error is yielded with
+// the zero row, and QueryRows returns no rows.
+func TestQueryRangeNamedScanError(t *testing.T) {
+	db := openTestDB(t)
+	const query = "SELECT id, name, 'old' AS age FROM testuser ORDER BY id"
+
+	for row, err := range QueryRangeNamed[testUser](db, query) {
+		if err == nil {
+			t.Fatalf("got row %+v without error, want scan error", row)
+		}
+		if row != (testUser{}) {
+			t.Errorf("got row %+v with error, want zero row", row)
+		}
+		break
+	}
+
+	rows, err := QueryRows[testUser](db, query)
+	if err == nil || rows != nil {
+		t.Errorf("got rows %+v and error %v, want scan error", rows, err)
+	}
+}
+
+func TestQueryMaps(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []map[string]any
+	}{
+		{"text and integer",
+			"SELECT name, age FROM testuser WHERE id IN (1, 2) ORDER BY id",
+			[]map[string]any{
+				{"name": "alice", "age": int64(30)},
+				{"name": "bob", "age": int64(25)},
+			}},
+		{"NULL value",
+			"SELECT name, NULL AS note FROM testuser WHERE id = 3",
+			[]map[string]any{{"name": "carol", "note": nil}}},
+		{"no rows", "SELECT name, age FROM testuser WHERE id = 0", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QueryMaps(db, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryScalar(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("CREATE TABLE product (price double)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO product VALUES (1.5), (9.25)"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("float64 max", func(t *testing.T) {
+		got, err := QueryScalar[float64](db, "SELECT max(price) FROM product")
+		if err != nil || got != 9.25 {
+			t.Errorf("got %v, %v, want 9.25", got, err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr error
+	}{
+		{"int count", "SELECT count(*) FROM testuser", 5, nil},
+		{"int with more columns", "SELECT age, name FROM testuser " +
+			"WHERE id = 3", 35, nil},
+		{"no rows", "SELECT age FROM testuser WHERE id = 0", 0,
+			sql.ErrNoRows},
+		{"NULL aggregate", "SELECT max(age) FROM testuser WHERE id = 0", 0,
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QueryScalar[int](db, tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("NULL into pointer", func(t *testing.T) {
+		got, err := QueryScalar[*int](db,
+			"SELECT max(age) FROM testuser WHERE id = 0")
+		if err != nil || got != nil {
+			t.Errorf("got %v, %v, want nil without error", got, err)
+		}
+	})
+}
+
+func TestExec(t *testing.T) {
+	db := openTestDB(t)
+
+	// Record the query hook calls
+	var queries []string
+	var hookErr error
+	SetQueryHook(func(query string, args []any, d time.Duration, err error) {
+		queries = append(queries, query)
+		hookErr = err
+	})
+	t.Cleanup(func() { SetQueryHook(nil) })
+
+	tests := []struct {
+		name    string
+		tx      bool
+		query   string
+		args    []any
+		wantErr bool
+	}{
+		{"create trigger", false, "CREATE TRIGGER testuser_age " +
+			"BEFORE INSERT ON testuser WHEN NEW.age < 0 " +
+			"BEGIN SELECT RAISE(ABORT, 'negative age'); END", nil, false},
+		{"pragma", false, "PRAGMA foreign_keys = ON", nil, false},
+		{"statement with args in transaction", true,
+			"UPDATE testuser SET age = age + ? WHERE id = ?",
+			[]any{1, 1}, false},
+		{"trigger aborts insert", true, "INSERT INTO testuser " +
+			"(id, name, email, age) VALUES (?, ?, ?, ?)",
+			[]any{10, "x", "x@example.com", -1}, true},
+		{"invalid statement", false, "VACUUM testuser", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries, hookErr = nil, nil
+
+			var err error
+			if tt.tx {
+				var tx *sql.Tx
+				if tx, err = db.Begin(); err != nil {
+					t.Fatal(err)
+				}
+				if _, err = ExecTx(tx, tt.query, tt.args...); err != nil {
+					tx.Rollback()
+				} else if err = tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				_, err = Exec(db, tt.query, tt.args...)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// The hook gets the statement and its error
+			if !slices.Equal(queries, []string{tt.query}) {
+				t.Errorf("got hook queries %q, want %q", queries, tt.query)
+			}
+			if (hookErr != nil) != tt.wantErr {
+				t.Errorf("got hook error %v, want error %v", hookErr,
+					tt.wantErr)
+			}
+		})
+	}
+
+	// The age is updated by the statement in transaction
+	age, err := QueryScalar[int](db, "SELECT age FROM testuser WHERE id = 1")
+	if err != nil || age != 31 {
+		t.Errorf("got age %d, %v, want 31", age, err)
+	}
+}
+
+func TestQueryRangeNamedJoin(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("CREATE TABLE testorder (id integer, " +
+		"user_id integer, name text)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO testorder VALUES (10, 1, 'book'), " +
+		"(11, 2, 'pen')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both tables have id and name columns
+	type userOrder struct {
+		UserID    int64  `db:"t.id"`
+		UserName  string `db:"t.name"`
+		OrderID   int64  `db:"o.id"`
+		OrderName string `db:"o.name"`
+	}
+	want := []userOrder{{1, "alice", 10, "book"}, {2, "bob", 11, "pen"}}
+
+	tests := []struct {
+		name    string
+		columns string
+	}{
+		{"qualified aliases", `t.id AS "t.id", t.name AS "t.name", ` +
+			`o.id AS "o.id", o.name AS "o.name"`},
+		{"qualified aliases in other order", `o.name AS "o.name", ` +
+			`t.name AS "t.name", o.id AS "o.id", t.id AS "t.id"`},
+		{"not qualified columns in fields order", "t.id, t.name, o.id, " +
+			"o.name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []userOrder
+			for row, err := range QueryRangeNamed[userOrder](db, "SELECT "+
+				tt.columns+" FROM testuser t JOIN testorder o "+
+				"ON o.user_id = t.id ORDER BY t.id") {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, row)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryRows(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("CREATE TABLE testorder (id integer, " +
+		"user_id integer, sum integer)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO testorder VALUES (1, 1, 10), " +
+		"(2, 1, 20), (3, 3, 5)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The anonymous struct type is declared inline
+	type total = struct {
+		Name  string `db:"name"`
+		Total int    `db:"total"`
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		args    []any
+		want    []total
+		wantErr bool
+	}{
+		{"two columns join", "SELECT u.name, sum(o.sum) AS total " +
+			"FROM testuser u JOIN testorder o ON o.user_id = u.id " +
+			"GROUP BY u.name ORDER BY u.name", nil,
+			[]total{{"alice", 30}, {"carol", 5}}, false},
+		{"with args", "SELECT u.name, o.sum AS total FROM testuser u " +
+			"JOIN testorder o ON o.user_id = u.id WHERE o.sum > ?",
+			[]any{15}, []total{{"alice", 20}}, false},
+		{"no rows", "SELECT name FROM testuser WHERE id = ?", []any{100},
+			nil, false},
+		{"invalid query", "SELECT name FROM missing", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QueryRows[total](db, tt.query, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanStruct(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+		want  []testUser
+	}{
+		{"all columns", "SELECT * FROM testuser WHERE id < ? ORDER BY id",
+			[]any{3}, testUsers[:2]},
+		{"reordered columns", "SELECT age, name, id, email FROM testuser " +
+			"WHERE id = ?", []any{3}, testUsers[2:3]},
+		{"some columns", "SELECT id, name FROM testuser WHERE age = ? " +
+			"ORDER BY id", []any{30}, []testUser{{ID: 1, Name: "alice"},
+			{ID: 4, Name: "dave"}}},
+		{"no rows", "SELECT * FROM testuser WHERE id = ?", []any{0}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Scan rows one by one
+			sqlRows, err := db.Query(tt.query, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []testUser
+			for sqlRows.Next() {
+				row, err := ScanStruct[testUser](sqlRows)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, row)
+			}
+			if err = sqlRows.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			// Scan all rows
+			if sqlRows, err = db.Query(tt.query, tt.args...); err != nil {
+				t.Fatal(err)
+			}
+			if got, err = ScanAll[testUser](sqlRows); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got all %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextIntoBytes(t *testing.T) {
+	db := openTestDB(t)
+
+	// userBytes reads the text columns into the bytes fields
+	type userBytes struct {
+		ID    int64  `db:"id"`
+		Name  []byte `db:"name"`
+		Email []byte `db:"email"`
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  userBytes
+	}{
+		{"text columns", "SELECT id, name, email FROM testuser WHERE id = 2",
+			userBytes{2, []byte("bob"), []byte("bob@example.com")}},
+		{"text expression", "SELECT id, upper(name) AS name, '' AS email " +
+			"FROM testuser WHERE id = 3", userBytes{3, []byte("CAROL"),
+			[]byte{}}},
+		{"NULL", "SELECT id, NULL AS name, NULL AS email FROM testuser " +
+			"WHERE id = 1", userBytes{ID: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := QueryRows[userBytes](db, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || !reflect.DeepEqual(rows[0], tt.want) {
+				t.Errorf("got %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryRowsIndex(t *testing.T) {
+	db := openTestDB(t)
+
+	// The fields are declared out of the result set order and bound by
+	// position, the column names don't match the db tags
+	type indexed = struct {
+		Age  int    `db:"age" db_index:"0"`
+		ID   int64  `db:"id" db_index:"2"`
+		Name string `db:"name" db_index:"1"`
+	}
+	type duplicate = struct {
+		Age  int    `db:"age" db_index:"0"`
+		Name string `db:"name" db_index:"0"`
+	}
+	type outOfRange = struct {
+		Age int `db:"age" db_index:"5"`
+	}
+
+	tests := []struct {
+		name    string
+		query   func(query string, args ...any) ([]indexed, error)
+		sql     string
+		want    []indexed
+		wantErr bool
+	}{
+		{"renamed columns", func(q string, a ...any) ([]indexed, error) {
+			return QueryRows[indexed](db, q, a...)
+		}, "SELECT age AS a, name AS b, id AS c FROM testuser " +
+			"WHERE id <= 2 ORDER BY id",
+			[]indexed{{30, 1, "alice"}, {25, 2, "bob"}}, false},
+		{"extra column skipped", func(q string, a ...any) ([]indexed, error) {
+			return QueryRows[indexed](db, q, a...)
+		}, "SELECT age, name, id, 'x' FROM testuser WHERE id = 3",
+			[]indexed{{35, 3, "carol"}}, false},
+		{"duplicate index", func(q string, a ...any) ([]indexed, error) {
+			_, err := QueryRows[duplicate](db, q, a...)
+			return nil, err
+		}, "SELECT age, name FROM testuser", nil, true},
+		{"index out of result set", func(q string, a ...any) ([]indexed, error) {
+			_, err := QueryRows[outOfRange](db, q, a...)
+			return nil, err
+		}, "SELECT age, name FROM testuser", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query(tt.sql)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Database tables schema helper functions.
+
+package sqlh
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// CreateTable creates the T database table if it does not exist.
+//
+// The table columns are taken from the T struct fields the same way as in the
+// query.Table function.
+func CreateTable[T any](db *sql.DB) (err error) {
+
+	// Create table statement
+	createStmt, err := query.Table[T]()
+	if err != nil {
+		return
+	}
+
+	// Execute create table statement
+	_, err = db.Exec(createStmt)
+	return
+}
+
+// CreateTableStrict creates the T database table. It works the same way as
+// the CreateTable function but returns the database error if the table already
+// exists.
+func CreateTableStrict[T any](db *sql.DB) (err error) {
+
+	// Create table statement
+	createStmt, err := query.CreateTableStrict[T]()
+	if err != nil {
+		return
+	}
+
+	// Execute create table statement
+	_, err = db.Exec(createStmt)
+	return
+}
+
+// AddColumn adds column for the T struct field with fieldName to the T
+// database table.
+//
+// The column name and type are taken from the struct field tags. The function
+// returns an error if the field does not exist or is not mapped to a database
+// field.
+func AddColumn[T any](db *sql.DB, fieldName string) (err error) {
+
+	// Create alter table statement
+	alterStmt, err := query.AddColumn[T](fieldName)
+	if err != nil {
+		return
+	}
+
+	// Execute alter table statement
+	_, err = db.Exec(alterStmt)
+	return
+}
+
+// MigrateTable adds missing columns to the T database table.
+//
+// It selects the existing T database table columns using current dialect
+// specific statement, compares them with the T struct fields and adds columns
+// for the fields which are missing in the table. Existing columns are never
+// dropped. The function executes all statements in one transaction.
+func MigrateTable[T any](db *sql.DB) (err error) {
+
+	// Get existing columns
+	columns, _, err := tableColumns[T](db)
+	if err != nil {
+		return
+	}
+
+	// Create alter table statements for missing columns
+	alterStmts, err := query.Migrate[T](columns)
+	if err != nil || len(alterStmts) == 0 {
+		return
+	}
+
+	// Start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	// Execute alter table statements
+	for _, alterStmt := range alterStmts {
+		if _, err = tx.Exec(alterStmt); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	// Commit transaction and return
+	err = tx.Commit()
+	return
+}
+
+// VerifySchema verifies that the T database table schema matches the T struct.
+//
+// It selects the existing T database table columns using current dialect
+// specific statement and checks that every struct field column exists and has
+// compatible type. The function returns an error describing all missing
+// columns and incompatible types. The table columns which are not mapped to
+// the struct fields are not an error, they are returned in the unmapped list
+// in the table columns order, so the caller may warn about them.
+func VerifySchema[T any](db *sql.DB) (unmapped []string, err error) {
+
+	// Get existing columns
+	columns, columnTypes, err := tableColumns[T](db)
+	if err != nil {
+		return
+	}
+	if len(columns) == 0 {
+		err = fmt.Errorf("table %s does not exist", query.Name[T]())
+		return
+	}
+	existing := make(map[string]string, len(columns))
+	for i, column := range columns {
+		existing[strings.ToLower(column)] = columnTypes[i]
+	}
+
+	// Get struct columns
+	fields, fieldTypes, err := query.FieldTypes[T]()
+	if err != nil {
+		return
+	}
+
+	// Check struct columns
+	var diffs []string
+	for i, field := range fields {
+		columnType, ok := existing[field]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("missing column %s", field))
+		case !compatibleTypes(fieldTypes[i], columnType):
+			diffs = append(diffs, fmt.Sprintf(
+				"column %s type %s is not compatible with %s",
+				field, columnType, fieldTypes[i],
+			))
+		}
+		delete(existing, field)
+	}
+
+	// Get columns which are not in the struct
+	for _, column := range columns {
+		if _, ok := existing[strings.ToLower(column)]; ok {
+			unmapped = append(unmapped, column)
+		}
+	}
+
+	if len(diffs) > 0 {
+		err = fmt.Errorf("table %s schema does not match struct: %s",
+			query.Name[T](), strings.Join(diffs, "; "))
+	}
+
+	return
+}
+
+// compatibleTypes returns true if the a and b database field types belong to
+// the same types family. Unknown types are compatible with any type.
+func compatibleTypes(a, b string) bool {
+	fa, fb := typeFamily(a), typeFamily(b)
+	return fa == "" || fb == "" || fa == fb
+}
+
+// typeFamily returns database field type family: integer, real, text, blob,
+// bool or time. It returns empty string for unknown type.
+func typeFamily(t string) string {
+	if query.IsTextType(t) {
+		return "text"
+	}
+	t = strings.ToLower(t)
+	if i := strings.IndexAny(t, "( "); i > 0 {
+		t = t[:i]
+	}
+	switch t {
+	case "integer", "int", "tinyint", "smallint", "mediumint", "bigint",
+		"int2", "int4", "int8", "serial", "bigserial":
+		return "integer"
+	case "double", "float", "real", "numeric", "decimal", "float4", "float8":
+		return "real"
+	case "blob", "bytea", "binary", "varbinary", "longblob":
+		return "blob"
+	case "bit", "bool", "boolean":
+		return "bool"
+	case "timestamp", "datetime", "date", "time", "timestamptz":
+		return "time"
+	}
+	return ""
+}
+
+// tableColumns returns names and types of the existing T database table
+// columns.
+func tableColumns[T any](db *sql.DB) (columns, columnTypes []string,
+	err error) {
+
+	// Create table columns statement
+	columnsStmt, err := query.TableColumns[T]()
+	if err != nil {
+		return
+	}
+
+	// Execute the query
+	sqlRows, err := db.Query(columnsStmt)
+	if err != nil {
+		return
+	}
+	defer sqlRows.Close()
+
+	// Get columns names
+	for sqlRows.Next() {
+		var column, columnType string
+		if err = sqlRows.Scan(&column, &columnType); err != nil {
+			return
+		}
+		columns = append(columns, column)
+		columnTypes = append(columnTypes, columnType)
+	}
+	err = sqlRows.Err()
+
+	return
+}
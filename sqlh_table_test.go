@@ -0,0 +1,392 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// account is the evolved table struct, the tests create the account table
+// without some of its columns.
+type account struct {
+	ID    int64  `db:"id" db_key:"primary key"`
+	Name  string `db:"name"`
+	Phone string `db:"phone"`
+	Code  string `db:"code" db_key:"not null unique"`
+	Skip  string `db:"-"`
+}
+
+func TestAddColumn(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		column  string
+		wantErr bool
+	}{
+		{"string column", "Phone", "phone", false},
+		{"not null unique keys removed", "Code", "code", false},
+		{"unknown field", "Missing", "", true},
+		{"not database field", "Skip", "", true},
+		{"existing column", "Name", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if _, err := db.Exec("CREATE TABLE account " +
+				"(id integer primary key, name text)"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := AddColumn[account](db, tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Insert and read the row using the new column
+			_, err = db.Exec("INSERT INTO account (id, name, "+tt.column+
+				") VALUES (?, ?, ?)", 1, "alice", "value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			err = db.QueryRow("SELECT " + tt.column +
+				" FROM account WHERE id = 1").Scan(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "value" {
+				t.Errorf("got %s value %q, want %q", tt.column, got, "value")
+			}
+		})
+	}
+}
+
+func TestMigrateTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		create string
+	}{
+		{"missing columns", "CREATE TABLE account (id integer primary key, " +
+			"name text)"},
+		{"extra column kept", "CREATE TABLE account (id integer primary key, " +
+			"name text, phone text, legacy text)"},
+		{"no table columns missing", "CREATE TABLE account (id integer " +
+			"primary key, name text, phone text, code text)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if _, err := db.Exec(tt.create); err != nil {
+				t.Fatal(err)
+			}
+
+			// Migrate twice, the second call has nothing to add
+			for range 2 {
+				if err := MigrateTable[account](db); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Insert using the new columns
+			want := account{ID: 1, Name: "alice", Phone: "555-0100", Code: "A1"}
+			if err := Insert(db, want); err != nil {
+				t.Fatal(err)
+			}
+			var got account
+			err := db.QueryRow("SELECT id, name, phone, code FROM account "+
+				"WHERE id = 1").Scan(&got.ID, &got.Name, &got.Phone, &got.Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+
+			// Existing columns are never dropped
+			columns, _, err := tableColumns[account](db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(tt.create, "legacy") &&
+				!slices.Contains(columns, "legacy") {
+				t.Errorf("legacy column is dropped: %v", columns)
+			}
+		})
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	tests := []struct {
+		name         string
+		create       string
+		wantUnmapped []string
+		wantErr      string // Error message part, empty if no error
+	}{
+		{"matching table", "CREATE TABLE account (id integer primary key, " +
+			"name text, phone text, code text not null unique)", nil, ""},
+		{"extra columns are unmapped", "CREATE TABLE account (id integer, " +
+			"legacy text, name text, phone text, code text, notes text)",
+			[]string{"legacy", "notes"}, ""},
+		{"renamed column", "CREATE TABLE account (id integer, name text, " +
+			"phone_number text, code text)", []string{"phone_number"},
+			"missing column phone"},
+		{"incompatible type", "CREATE TABLE account (id integer, name text, " +
+			"phone text, code blob)", nil, "column code type"},
+		{"no table", "", nil, "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if tt.create != "" {
+				if _, err := db.Exec(tt.create); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			unmapped, err := VerifySchema[account](db)
+			if tt.wantErr == "" && err != nil ||
+				tt.wantErr != "" && (err == nil ||
+					!strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want error %q", err, tt.wantErr)
+			}
+			if !slices.Equal(unmapped, tt.wantUnmapped) {
+				t.Errorf("got unmapped %q, want %q", unmapped, tt.wantUnmapped)
+			}
+		})
+	}
+}
+
+func TestCreateTableStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  func(db *sql.DB) error
+		wantErr bool
+	}{
+		{"create existing table", CreateTable[testUser], false},
+		{"strict create existing table", CreateTableStrict[testUser], true},
+		{"strict create new table", CreateTableStrict[account], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			err := tt.create(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// The existing table rows are kept
+			if ids := allUserIDs(t, db); !slices.Equal(ids,
+				userIDs(testUsers)) {
+				t.Errorf("got ids %v, want %v", ids, userIDs(testUsers))
+			}
+		})
+	}
+}
+
+// member is the table struct with the composite unique constraint.
+type member struct {
+	ID       int64    `db:"id" db_key:"primary key"`
+	Email    string   `db:"email"`
+	TenantID int64    `db:"tenant_id"`
+	_        struct{} `db_key:"unique (email, tenant_id)"`
+}
+
+func TestCompositeUnique(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     member
+		wantErr bool
+	}{
+		{"same email other tenant", member{ID: 2, Email: "a@example.com",
+			TenantID: 2}, false},
+		{"other email same tenant", member{ID: 2, Email: "b@example.com",
+			TenantID: 1}, false},
+		{"duplicate pair", member{ID: 2, Email: "a@example.com",
+			TenantID: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[member](db); err != nil {
+				t.Fatal(err)
+			}
+			first := member{ID: 1, Email: "a@example.com", TenantID: 1}
+			if err := Insert(db, first); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Insert(db, tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !IsDuplicateKey(err) {
+				t.Errorf("got error %v, want duplicate key", err)
+			}
+		})
+	}
+}
+
+// person is the table struct with the column and table check constraints.
+type person struct {
+	ID      int64    `db:"id" db_key:"primary key"`
+	Age     int      `db:"age" db_check:"age >= 0"`
+	StartAt int64    `db:"start_at"`
+	EndAt   int64    `db:"end_at"`
+	_       struct{} `db_check:"start_at < end_at"`
+}
+
+func TestCheckConstraint(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     person
+		wantErr bool
+	}{
+		{"valid row", person{ID: 1, Age: 30, StartAt: 1, EndAt: 2}, false},
+		{"zero age", person{ID: 1, StartAt: 1, EndAt: 2}, false},
+		{"negative age", person{ID: 1, Age: -1, StartAt: 1, EndAt: 2}, true},
+		{"table check", person{ID: 1, Age: 30, StartAt: 2, EndAt: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[person](db); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Insert(db, tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "CHECK") {
+				t.Errorf("got error %v, want check constraint error", err)
+			}
+		})
+	}
+}
+
+// ordered is the table struct with the Go fields declared out of the db_order
+// columns order.
+type ordered struct {
+	Note string `db:"note"`
+	Age  int    `db:"age" db_order:"3"`
+	Name string `db:"name" db_order:"2"`
+	ID   int64  `db:"id" db_key:"primary key" db_order:"1"`
+}
+
+func TestColumnOrder(t *testing.T) {
+	db := openTestDB(t)
+	if err := CreateTable[ordered](db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Created table columns follow the db_order tags
+	type column struct {
+		Name string `db:"name"`
+	}
+	columns, err := QueryRows[column](db,
+		"SELECT name FROM pragma_table_info('ordered') ORDER BY cid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []column{{"id"}, {"name"}, {"age"}, {"note"}}
+	if !slices.Equal(columns, want) {
+		t.Fatalf("got columns %v, want %v", columns, want)
+	}
+
+	tests := []struct {
+		name string
+		row  ordered
+	}{
+		{"all fields", ordered{Note: "n", Age: 30, Name: "alice", ID: 1}},
+		{"unordered field empty", ordered{Age: 25, Name: "bob", ID: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Insert(db, tt.row); err != nil {
+				t.Fatal(err)
+			}
+
+			// The inserted values are in the created columns positions
+			var row ordered
+			if err := db.QueryRow("SELECT * FROM ordered WHERE id = ?",
+				tt.row.ID).Scan(&row.ID, &row.Name, &row.Age,
+				&row.Note); err != nil {
+				t.Fatal(err)
+			}
+			if row != tt.row {
+				t.Errorf("got scanned %+v, want %+v", row, tt.row)
+			}
+
+			// And are read back into the fields
+			got, err := Get[ordered](db, Eq("id", tt.row.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.row {
+				t.Errorf("got %+v, want %+v", got, tt.row)
+			}
+		})
+	}
+}
+
+// login is the table struct with the case insensitive unique name.
+type login struct {
+	ID   int64  `db:"id" db_key:"primary key"`
+	Name string `db:"name" db_key:"unique" db_collate:"nocase"`
+}
+
+func TestCollate(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     login
+		wantErr bool
+	}{
+		{"other name", login{2, "bob"}, false},
+		{"same name other case", login{2, "ALICE"}, true},
+		{"same name", login{2, "alice"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := CreateTable[login](db); err != nil {
+				t.Fatal(err)
+			}
+			if err := Insert(db, login{1, "Alice"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Insert(db, tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !IsDuplicateKey(err) {
+				t.Errorf("got error %v, want duplicate key", err)
+			}
+
+			// The collated column is compared case insensitively
+			row, err := Get[login](db, Eq("name", "aLiCe"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.ID != 1 {
+				t.Errorf("got %+v, want id 1", row)
+			}
+		})
+	}
+
+	// Collation of not text column
+	type badLogin struct {
+		ID int64 `db:"id" db_collate:"nocase"`
+	}
+	if err := CreateTable[badLogin](openTestDB(t)); err == nil {
+		t.Error("got nil error for collated integer column")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Transactions helper functions.
+
+package sqlh
+
+import (
+	"database/sql"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// WithTx runs fn within a new transaction.
+//
+// It begins a transaction, calls fn and commits the transaction if fn returns
+// nil, or rolls it back if fn returns an error. If fn panics the transaction
+// is rolled back and the panic is re-raised. Use it with the *Tx functions to
+// combine several operations into one unit of work:
+//
+//	err := sqlh.WithTx(db, func(tx *sql.Tx) error {
+//		if err := sqlh.InsertTx(tx, order); err != nil {
+//			return err
+//		}
+//		return sqlh.SetTx(tx, balance, sqlh.Where{"id=", balance.ID})
+//	})
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+
+	// Start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	// Rollback transaction and re-panic on panic
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Run function
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	// Commit transaction and return
+	err = tx.Commit()
+	return
+}
+
+// InsertTx inserts rows into the T database table within the given
+// transaction. It works the same way as the Insert function but does not
+// begin and commit transaction.
+func InsertTx[T any](tx *sql.Tx, rows ...T) error {
+	return insertTx(tx, query.Name[T](), rows...)
+}
+
+// UpdateTx updates rows in T database table within the given transaction. It
+// works the same way as the Update function but does not begin and commit
+// transaction.
+func UpdateTx[T any](tx *sql.Tx, attrs ...UpdateAttr[T]) error {
+	return updateTx(tx, query.Name[T](), attrs...)
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed")
+	newUser := testUser{6, "eve", "eve@example.com", 20}
+
+	tests := []struct {
+		name      string
+		fn        func(tx *sql.Tx) error
+		wantErr   bool
+		wantIs    error // Returned error, nil to skip check
+		wantPanic any
+		wantIDs   []int64
+	}{
+		{"commit on success", func(tx *sql.Tx) error {
+			if err := InsertTx(tx, newUser); err != nil {
+				return err
+			}
+			return UpdateTx(tx, UpdateAttr[testUser]{
+				Row:    testUser{1, "alice", "a@", 31},
+				Wheres: []Where{Eq("id", 1)},
+			})
+		}, false, nil, nil, []int64{1, 2, 3, 4, 5, 6}},
+		{"rollback on error", func(tx *sql.Tx) error {
+			if err := InsertTx(tx, newUser); err != nil {
+				return err
+			}
+			return errFailed
+		}, true, errFailed, nil, []int64{1, 2, 3, 4, 5}},
+		{"rollback on failed statement", func(tx *sql.Tx) error {
+			if err := InsertTx(tx, newUser); err != nil {
+				return err
+			}
+			return InsertTx(tx, testUsers[0])
+		}, true, nil, nil, []int64{1, 2, 3, 4, 5}},
+		{"rollback and repanic", func(tx *sql.Tx) error {
+			if err := InsertTx(tx, newUser); err != nil {
+				return err
+			}
+			panic("boom")
+		}, false, nil, "boom", []int64{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			var err error
+			p := func() (p any) {
+				defer func() { p = recover() }()
+				err = WithTx(db, tt.fn)
+				return
+			}()
+			if p != tt.wantPanic {
+				t.Fatalf("got panic %v, want %v", p, tt.wantPanic)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Fatalf("got error %v, want %v", err, tt.wantIs)
+			}
+
+			// The connection is released, so the next statement succeeds
+			if ids := allUserIDs(t, db); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Where conditions.
+
+package sqlh
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+// Where struct contains where condition as field and value.
+//
+// The Field is added to the SQL statement as is, so it should not contain user
+// input. Use the Where constructors: Eq, Ne, Gt, Gte, Lt, Lte, Like, In,
+// InSelect, TimeRange, Since and Until, which validate the column name and use
+// safe condition operators. The column name is validated syntactically only,
+// it is not checked against the struct fields, so the unknown column returns
+// the database error when the condition is used.
+type Where struct {
+
+	// Database table field Name and Condition Operator, f.e. "id="
+	// 	=	Equal
+	// 	>	Greater than
+	// 	<	Less than
+	// 	>=	Greater than or equal
+	// 	<=	Less than or equal
+	// 	<>	Not equal. In some versions of SQL it may be written as !=
+	// 	BETWEEN	Between a certain range
+	// 	LIKE	Search for a pattern
+	// 	IN	To specify multiple possible values for a column
+	Field string
+
+	// Field value
+	Value any
+}
+
+func (Where) isListAttr() {}
+
+// whereError is the Where Value returned by the Where constructors when the
+// condition is invalid. The error is returned when the condition is used.
+type whereError struct{ err error }
+
+// whereOr is the Where Value of the Or conditions group.
+type whereOr []Where
+
+// Or returns the Where conditions group joined with OR. The group is added to
+// the where clause in parentheses and is joined with other conditions with
+// AND, f.e.:
+//
+//	sqlh.List[User](db, 0, "",
+//		sqlh.Where{"active=", true},
+//		sqlh.Or(sqlh.Where{"role=", "admin"}, sqlh.Where{"role=", "owner"}),
+//	)
+//
+// produces "active = ? and (role = ? OR role = ?)". The empty group is skipped.
+// The group with the empty member, f.e. TimeRange with zero times, selects
+// all rows and is skipped too.
+func Or(wheres ...Where) Where {
+	return Where{Value: whereOr(wheres)}
+}
+
+// whereAnd is the Where Value of the conditions group joined with AND.
+type whereAnd []Where
+
+// TimeRange returns the "column >= from and column < to" Where condition
+// which selects the column times in the half-open range from the from time
+// inclusive to the to time exclusive. The zero from or to time means the open
+// range bound, f.e. TimeRange("created_at", from, time.Time{}) is the same as
+// Since("created_at", from). Both zero times select all rows.
+func TimeRange(column string, from, to time.Time) Where {
+	var wheres whereAnd
+	if !from.IsZero() {
+		wheres = append(wheres, Gte(column, from))
+	}
+	if !to.IsZero() {
+		wheres = append(wheres, Lt(column, to))
+	}
+	return Where{Value: wheres}
+}
+
+// Since returns the "column >= t" Where condition. The zero t selects all
+// rows.
+func Since(column string, t time.Time) Where {
+	return TimeRange(column, t, time.Time{})
+}
+
+// Until returns the "column < t" Where condition. The zero t selects all
+// rows.
+func Until(column string, t time.Time) Where {
+	return TimeRange(column, time.Time{}, t)
+}
+
+// whereRaw is the Where Value of the raw where fragment arguments.
+type whereRaw struct{ args []any }
+
+// Raw returns the Where condition with the raw where clause fragment which is
+// added to the where clause as is, f.e.:
+//
+//	sqlh.Raw("json_extract(data,'$.x')=?", 5)
+//
+// The fragment placeholders arguments are added in order with the other
+// conditions arguments. The fragment should not contain user input.
+func Raw(fragment string, args ...any) Where {
+	return Where{fragment, whereRaw{args}}
+}
+
+// whereSubquery is the Where Value of the IN subquery arguments.
+type whereSubquery struct{ args []any }
+
+// InSelect returns the "column IN (subquery)" Where condition, f.e.:
+//
+//	sqlh.InSelect("id", "SELECT user_id FROM admins WHERE level > ?", 2)
+//
+// The subquery should use "?" placeholders, its arguments are added in the
+// condition position, so they are ordered with the other conditions arguments.
+// The column name is validated, the subquery is added as is and should not
+// contain user input.
+func InSelect(column, subquery string, args ...any) Where {
+	if !columnRe.MatchString(column) {
+		return Where{column, whereError{
+			fmt.Errorf("invalid where column name: %q", column),
+		}}
+	}
+	subquery = strings.TrimRight(strings.TrimSpace(subquery), ";")
+	return Where{column + " IN (" + subquery + ")", whereSubquery{args}}
+}
+
+// columnRe is the valid column name regular expression. The column name may be
+// qualified with table name or alias, f.e. "t.id".
+var columnRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Eq returns the "column = value" Where condition.
+func Eq(column string, value any) Where { return whereOp(column, "=", value) }
+
+// Ne returns the "column <> value" Where condition.
+func Ne(column string, value any) Where { return whereOp(column, "<>", value) }
+
+// Gt returns the "column > value" Where condition.
+func Gt(column string, value any) Where { return whereOp(column, ">", value) }
+
+// Gte returns the "column >= value" Where condition.
+func Gte(column string, value any) Where { return whereOp(column, ">=", value) }
+
+// Lt returns the "column < value" Where condition.
+func Lt(column string, value any) Where { return whereOp(column, "<", value) }
+
+// Lte returns the "column <= value" Where condition.
+func Lte(column string, value any) Where { return whereOp(column, "<=", value) }
+
+// Like returns the "column LIKE value" Where condition.
+func Like(column string, value any) Where {
+	return whereOp(column, "LIKE", value)
+}
+
+// In returns the "column IN (values...)" Where condition. The values parameter
+// should be a slice, but not []byte which is the single value. The empty slice
+// selects no rows, its condition is "1=0".
+func In(column string, values any) Where {
+	v := reflect.ValueOf(values)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) ||
+		v.Type().Elem().Kind() == reflect.Uint8 {
+		return Where{column, whereError{
+			fmt.Errorf("values of IN condition should be a slice, got %T", values),
+		}}
+	}
+	return whereOp(column, "IN", values)
+}
+
+// whereOp returns the Where condition with the given column, operator and
+// value. The column name is validated syntactically to prevent SQL injection. The nil value
+// is allowed in "=" and "<>" conditions only and compared with IS [NOT] NULL.
+func whereOp(column, op string, value any) Where {
+	if !columnRe.MatchString(column) {
+		return Where{column, whereError{
+			fmt.Errorf("invalid where column name: %q", column),
+		}}
+	}
+
+	// Compare with NULL
+	if value == nil {
+		switch op {
+		case "=":
+			return Where{column + " IS NULL", nil}
+		case "<>":
+			return Where{column + " IS NOT NULL", nil}
+		}
+		return Where{column, whereError{
+			fmt.Errorf("invalid nil value in %s condition", op),
+		}}
+	}
+
+	return Where{column + " " + op + " ", value}
+}
+
+// whereClauses returns where clauses and its arguments for the given Where
+// conditions. The Where with nil Value is added as is without placeholder,
+// f.e. Where{Field: "name IS NULL"}.
+//
+// The Where with IN or NOT IN operator and slice Value (except []byte) is
+// expanded to the list of placeholders, f.e. Where{"id IN ", []int{1, 2, 3}}
+// is "id IN (?,?,?)". The empty IN list is "1=0" and the empty NOT IN list is
+// "1=1". The slice Value of other operators is bound as one argument.
+func whereClauses(wheres ...Where) (clauses []string, args []any, err error) {
+	for _, w := range wheres {
+		switch v := w.Value.(type) {
+		case whereError:
+			err = v.err
+			return
+		case whereRaw:
+			clauses = append(clauses, w.Field)
+			args = append(args, v.args...)
+			continue
+		case whereSubquery:
+			clauses = append(clauses, w.Field)
+			args = append(args, v.args...)
+			continue
+		case whereOr:
+			// The group member without clauses, f.e. the empty group, is
+			// always true, so the whole group is skipped
+			var orClauses []string
+			var orArgs []any
+			always := false
+			for _, or := range v {
+				c, a, e := whereClauses(or)
+				if e != nil {
+					err = e
+					return
+				}
+				if len(c) == 0 {
+					always = true
+				}
+				orClauses = append(orClauses, c...)
+				orArgs = append(orArgs, a...)
+			}
+			if len(orClauses) > 0 && !always {
+				clauses = append(clauses,
+					"("+strings.Join(orClauses, " OR ")+")")
+				args = append(args, orArgs...)
+			}
+			continue
+		case whereAnd:
+			andClauses, andArgs, e := whereClauses(v...)
+			if e != nil {
+				err = e
+				return
+			}
+			if len(andClauses) > 0 {
+				clauses = append(clauses,
+					"("+strings.Join(andClauses, " and ")+")")
+				args = append(args, andArgs...)
+			}
+			continue
+		}
+		if w.Value == nil {
+			clauses = append(clauses, w.Field)
+			continue
+		}
+		if v := reflect.ValueOf(w.Value); (v.Kind() == reflect.Slice ||
+			v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+			m := inOperatorRe.FindStringSubmatch(w.Field)
+			switch {
+			case m == nil:
+				// Not IN operator, bind the slice as one argument
+				clauses = append(clauses, query.WhereField(w.Field)+"?")
+				args = append(args, w.Value)
+				continue
+			case v.Len() == 0 && m[1] == "":
+				clauses = append(clauses, "1=0")
+				continue
+			case v.Len() == 0:
+				clauses = append(clauses, "1=1")
+				continue
+			}
+			clauses = append(clauses, query.WhereField(w.Field)+"("+
+				strings.TrimRight(strings.Repeat("?,", v.Len()), ",")+")")
+			for i := 0; i < v.Len(); i++ {
+				args = append(args, v.Index(i).Interface())
+			}
+			continue
+		}
+		clauses = append(clauses, query.WhereField(w.Field)+"?")
+		args = append(args, w.Value)
+	}
+	return
+}
+
+// aliasRe is the valid table alias regular expression.
+var aliasRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// leadingColumnRe matches the leading column name of the Where condition field
+// and the character after it.
+var leadingColumnRe = regexp.MustCompile(`^(\s*)([A-Za-z_][A-Za-z0-9_]*)(\.?)`)
+
+// aliasWheres returns the Where conditions with the fields which start with
+// not qualified column from the columns list qualified with the table alias.
+// The already qualified fields, f.e. "o.name=", are not changed.
+func aliasWheres(alias string, columns []string, wheres []Where) []Where {
+
+	// Make columns map
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[strings.ToLower(column)] = true
+	}
+
+	aliased := make([]Where, len(wheres))
+	for i, w := range wheres {
+		switch v := w.Value.(type) {
+		case whereRaw:
+			// Raw fragments are added as is
+		case whereOr:
+			w.Value = whereOr(aliasWheres(alias, columns, v))
+		case whereAnd:
+			w.Value = whereAnd(aliasWheres(alias, columns, v))
+		default:
+			m := leadingColumnRe.FindStringSubmatch(w.Field)
+			if m != nil && m[3] == "" && known[strings.ToLower(m[2])] {
+				w.Field = m[1] + alias + "." + w.Field[len(m[1]):]
+			}
+		}
+		aliased[i] = w
+	}
+
+	return aliased
+}
+
+// inOperatorRe matches the Where condition field with the trailing IN or NOT
+// IN operator, f.e. "id IN " or "id NOT IN".
+var inOperatorRe = regexp.MustCompile(`(?is)\b(not\s+)?in\s*$`)
+
+// splitIn splits the Where conditions with IN lists longer than
+// query.MaxInParams into the conditions sets with IN lists chunks. The union of
+// the conditions sets results is equal to the result of the given conditions.
+// The duplicate values of the split lists are removed, so the sets select
+// disjoint rows. It returns the given conditions as the only set if no
+// splitting is needed.
+//
+// Only the conditions with the IN operator are split. The NOT IN list can't be
+// split into the union of results, so it returns an error if the NOT IN list is
+// longer than query.MaxInParams. The conditions groups, f.e. Or, are never
+// split.
+func splitIn(wheres []Where) (sets [][]Where, err error) {
+	limit := query.MaxInParams()
+	for i, w := range wheres {
+		switch w.Value.(type) {
+		case whereError, whereOr, whereAnd, whereRaw, whereSubquery:
+			continue
+		}
+		v := reflect.ValueOf(w.Value)
+		if limit <= 0 || w.Value == nil || (v.Kind() != reflect.Slice &&
+			v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 ||
+			v.Len() <= limit {
+			continue
+		}
+
+		// Check the IN operator
+		m := inOperatorRe.FindStringSubmatch(w.Field)
+		switch {
+		case m == nil:
+			continue
+		case m[1] != "":
+			err = fmt.Errorf("NOT IN list of %d values exceeds the maximum "+
+				"of %d parameters: %q", v.Len(), limit, w.Field)
+			return
+		}
+
+		// Split the rest conditions
+		var rests [][]Where
+		if rests, err = splitIn(wheres[i+1:]); err != nil {
+			return
+		}
+
+		// Remove duplicate values, the not comparable values are kept
+		values := make([]any, 0, v.Len())
+		seen := make(map[any]bool, v.Len())
+		for j := range v.Len() {
+			value := v.Index(j).Interface()
+			if reflect.ValueOf(value).Comparable() {
+				if seen[value] {
+					continue
+				}
+				seen[value] = true
+			}
+			values = append(values, value)
+		}
+
+		// Split the IN list and combine it with the rest conditions
+		for start := 0; start < len(values); start += limit {
+			chunk := values[start:min(start+limit, len(values))]
+			for _, rest := range rests {
+				set := append([]Where{}, wheres[:i]...)
+				set = append(set, Where{w.Field, chunk})
+				sets = append(sets, append(set, rest...))
+			}
+		}
+		return
+	}
+	return [][]Where{wheres}, nil
+}
+
+// splitInAttrs splits the Where attributes of the List functions attributes
+// the same way as the splitIn function. The other attributes are added to each
+// attributes set.
+func splitInAttrs(attrs []ListAttr) (sets [][]ListAttr, err error) {
+	var wheres []Where
+	var others []ListAttr
+	for _, a := range attrs {
+		if w, ok := a.(Where); ok {
+			wheres = append(wheres, w)
+			continue
+		}
+		others = append(others, a)
+	}
+	whereSets, err := splitIn(wheres)
+	if err != nil {
+		return
+	}
+	for _, set := range whereSets {
+		sets = append(sets, append(whereAttrs(set), others...))
+	}
+	return
+}
+
+// whereAttrs converts Where conditions to the List functions attributes.
+func whereAttrs(wheres []Where) (attrs []ListAttr) {
+	for _, w := range wheres {
+		attrs = append(attrs, w)
+	}
+	return
+}
@@ -0,0 +1,650 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlh
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirill-scherba/sqlh/query"
+)
+
+func TestWhereClauses(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		wheres      []Where
+		wantClauses []string
+		wantArgs    []any
+		wantErr     bool
+	}{
+		{"eq", []Where{Eq("id", 1)}, []string{"id = ?"}, []any{1}, false},
+		{"ne", []Where{Ne("name", "bob")}, []string{"name <> ?"},
+			[]any{"bob"}, false},
+		{"gt and lte", []Where{Gt("age", 20), Lte("age", 30)},
+			[]string{"age > ?", "age <= ?"}, []any{20, 30}, false},
+		{"qualified column", []Where{Gte("a.age", 20)},
+			[]string{"a.age >= ?"}, []any{20}, false},
+		{"like", []Where{Like("name", "a%")}, []string{"name LIKE ?"},
+			[]any{"a%"}, false},
+		{"in", []Where{In("id", []int{1, 2, 3})}, []string{"id IN (?,?,?)"},
+			[]any{1, 2, 3}, false},
+		{"in empty", []Where{In("id", []int{})}, []string{"1=0"}, nil,
+			false},
+		{"not in empty", []Where{{"id NOT IN ", []int{}}}, []string{"1=1"},
+			nil, false},
+		{"not in", []Where{{"id not in", []any{1, 2}}},
+			[]string{"id not in (?,?)"}, []any{1, 2}, false},
+		{"eq slice", []Where{Eq("tags", []string{"a"})}, []string{"tags = ?"},
+			[]any{[]string{"a"}}, false},
+		{"nil is null", []Where{Eq("email", nil)},
+			[]string{"email IS NULL"}, nil, false},
+		{"nil is not null", []Where{Ne("email", nil)},
+			[]string{"email IS NOT NULL"}, nil, false},
+		{"or", []Where{Or(Eq("id", 1), Eq("id", 2))},
+			[]string{"(id = ? OR id = ?)"}, []any{1, 2}, false},
+		{"time range", []Where{TimeRange("created_at", from, to)},
+			[]string{"(created_at >= ? and created_at < ?)"},
+			[]any{from, to}, false},
+		{"raw", []Where{Raw("age % ? = 0", 2)}, []string{"age % ? = 0"},
+			[]any{2}, false},
+		{"invalid column", []Where{Eq("id; DROP TABLE testuser", 1)},
+			nil, nil, true},
+		{"nil in gt", []Where{Gt("age", nil)}, nil, nil, true},
+		{"in not slice", []Where{In("id", 1)}, nil, nil, true},
+		{"in bytes", []Where{In("id", []byte{1, 2})}, nil, nil, true},
+		{"error in or", []Where{Or(Eq("id", 1), Eq("1=1 --", 2))},
+			nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses, args, err := whereClauses(tt.wheres...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !slices.Equal(clauses, tt.wantClauses) {
+				t.Errorf("got clauses %q, want %q", clauses, tt.wantClauses)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestUpdateWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(db *sql.DB) error
+		wantIDs []int64 // Rows with updated age
+		wantErr bool
+	}{
+		{"update in", func(db *sql.DB) error {
+			return Update(db, UpdateAttr[testUser]{
+				Row:    testUser{ID: 2, Name: "bob", Age: 99},
+				Wheres: []Where{In("id", []int64{2})},
+			})
+		}, []int64{2}, false},
+		{"update fields or", func(db *sql.DB) error {
+			return UpdateFields(db, testUser{Age: 99}, []string{"age"},
+				Or(Eq("name", "bob"), Eq("name", "carol")))
+		}, []int64{2, 3}, false},
+		{"update fields raw", func(db *sql.DB) error {
+			return UpdateFields(db, testUser{Age: 99}, []string{"age"},
+				Raw("age > ?", 32))
+		}, []int64{3, 5}, false},
+		{"update expr is null", func(db *sql.DB) error {
+			return UpdateExpr[testUser](db,
+				map[string]Expression{"age": Expr("? + 0", 99)},
+				Eq("email", nil))
+		}, nil, false},
+		{"update invalid column", func(db *sql.DB) error {
+			return Update(db, UpdateAttr[testUser]{
+				Row:    testUser{Age: 99},
+				Wheres: []Where{Eq("id = 1 OR 1", 1)},
+			})
+		}, nil, true},
+		{"update fields invalid in", func(db *sql.DB) error {
+			return UpdateFields(db, testUser{Age: 99}, []string{"age"},
+				In("id", 1))
+		}, nil, true},
+		{"update expr nil gt", func(db *sql.DB) error {
+			return UpdateExpr[testUser](db,
+				map[string]Expression{"age": Expr("99")}, Gt("age", nil))
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			err := tt.update(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// Check updated rows
+			ids, err := Collect(db, func(u testUser) int64 { return u.ID },
+				0, "id", Eq("age", 99))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got updated ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestOr(t *testing.T) {
+	tests := []struct {
+		name     string
+		wheres   []Where
+		wantStmt string
+		wantArgs []any
+		wantIDs  []int64
+	}{
+		{"and with or group", []Where{{"age=", 30},
+			Or(Where{"name=", "alice"}, Where{"name=", "bob"})},
+			"SELECT * from testuser where age = ? and " +
+				"(name = ? OR name = ?) ORDER BY id LIMIT 10;",
+			[]any{30, "alice", "bob"}, []int64{1}},
+		{"or group only", []Where{Or(Eq("id", 2), Eq("id", 5))},
+			"SELECT * from testuser where (id = ? OR id = ?) ORDER BY id " +
+				"LIMIT 10;", []any{2, 5}, []int64{2, 5}},
+		{"nested and group", []Where{Or(Eq("id", 1),
+			Raw("(age > ? and age < ?)", 30, 40))},
+			"SELECT * from testuser where (id = ? OR (age > ? and age < ?)) " +
+				"ORDER BY id LIMIT 10;", []any{1, 30, 40}, []int64{1, 3}},
+		{"always true member", []Where{Eq("age", 30), Or(Eq("id", 1),
+			TimeRange("created_at", time.Time{}, time.Time{}))},
+			"SELECT * from testuser where age = ? ORDER BY id LIMIT 10;",
+			[]any{30}, []int64{1, 4}},
+		{"empty group skipped", []Where{Or(), Eq("age", 30)},
+			"SELECT * from testuser where age = ? ORDER BY id LIMIT 10;",
+			[]any{30}, []int64{1, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, args, err := ListSQL[testUser](0, "id", whereAttrs(tt.wheres)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+
+			// Check selected rows
+			db := openTestDB(t)
+			rows, _, err := List[testUser](db, 0, "id", tt.wheres...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := userIDs(rows); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSplitIn(t *testing.T) {
+	t.Cleanup(query.ResetDefaults)
+	query.SetMaxInParams(2)
+
+	tests := []struct {
+		name    string
+		wheres  []Where
+		want    [][]Where
+		wantErr bool
+	}{
+		{"short list not split", []Where{In("id", []int{1, 2}),
+			Eq("age", 30)}, [][]Where{{In("id", []int{1, 2}),
+			Eq("age", 30)}}, false},
+		{"long list split", []Where{Eq("age", 30),
+			In("id", []int{1, 2, 3, 4, 5})}, [][]Where{
+			{Eq("age", 30), {"id IN ", []any{1, 2}}},
+			{Eq("age", 30), {"id IN ", []any{3, 4}}},
+			{Eq("age", 30), {"id IN ", []any{5}}},
+		}, false},
+		{"two long lists", []Where{In("id", []int{1, 2, 3}),
+			Where{"name in", []string{"a", "b", "c"}}}, [][]Where{
+			{{"id IN ", []any{1, 2}}, {"name in", []any{"a", "b"}}},
+			{{"id IN ", []any{1, 2}}, {"name in", []any{"c"}}},
+			{{"id IN ", []any{3}}, {"name in", []any{"a", "b"}}},
+			{{"id IN ", []any{3}}, {"name in", []any{"c"}}},
+		}, false},
+		{"duplicates removed", []Where{In("id", []int{1, 2, 1, 3, 2})},
+			[][]Where{{{"id IN ", []any{1, 2}}}, {{"id IN ", []any{3}}}},
+			false},
+		{"bytes not split", []Where{{"data=", []byte("abc")}},
+			[][]Where{{{"data=", []byte("abc")}}}, false},
+		{"or group not split", []Where{Or(In("id", []int{1, 2, 3}),
+			Eq("age", 30))}, [][]Where{{Or(In("id", []int{1, 2, 3}),
+			Eq("age", 30))}}, false},
+		{"not in list error", []Where{Where{"id NOT IN ", []int{1, 2, 3}}},
+			nil, true},
+		{"short not in list", []Where{Where{"id not in", []int{1, 2}}},
+			[][]Where{{{"id not in", []int{1, 2}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitIn(tt.wheres)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInChunks(t *testing.T) {
+	const numRows = 2500
+
+	// Make rows and ids
+	rows := make([]testItem, numRows)
+	ids := make([]int64, numRows)
+	for i := range rows {
+		rows[i] = testItem{int64(i + 1), "item"}
+		ids[i] = int64(i + 1)
+	}
+
+	tests := []struct {
+		name    string
+		fn      func(db *sql.DB) (int, error) // Returns the rows number left
+		want    int
+		wantErr bool
+	}{
+		{"delete all ids", func(db *sql.DB) (int, error) {
+			if err := Delete[testItem](db, In("id", ids)); err != nil {
+				return 0, err
+			}
+			return Count[testItem](db)
+		}, 0, false},
+		{"delete ids with other condition", func(db *sql.DB) (int, error) {
+			err := Delete[testItem](db, In("id", ids), Lte("id", 1000))
+			if err != nil {
+				return 0, err
+			}
+			return Count[testItem](db)
+		}, numRows - 1000, false},
+		{"list all ids", func(db *sql.DB) (int, error) {
+			rows, _, err := ListRows[testItem](db, 0, "", 0, In("id", ids))
+			return len(rows), err
+		}, numRows, false},
+		{"count ids", func(db *sql.DB) (int, error) {
+			return Count[testItem](db, In("id", append(ids, ids[:10]...)),
+				Gt("id", 10))
+		}, numRows - 10, false},
+		{"list ids with order error", func(db *sql.DB) (int, error) {
+			rows, _, err := ListRows[testItem](db, 0, "id", 0, In("id", ids))
+			return len(rows), err
+		}, 0, true},
+		{"list ids with number of rows error", func(db *sql.DB) (int, error) {
+			rows, _, err := List[testItem](db, 0, "", In("id", ids))
+			return len(rows), err
+		}, 0, true},
+		{"list all ids with limit attribute", func(db *sql.DB) (int, error) {
+			rows, _, err := ListAttrs[testItem](db, 0, "", Limit(0),
+				In("id", ids))
+			return len(rows), err
+		}, numRows, false},
+		{"list page error", func(db *sql.DB) (int, error) {
+			rows, _, err := ListPage[testItem](db, 1, 10, "id", In("id", ids))
+			return len(rows), err
+		}, 0, true},
+		{"list page window error", func(db *sql.DB) (int, error) {
+			rows, _, err := ListPageWindow[testItem](db, 1, 10, "id",
+				In("id", ids))
+			return len(rows), err
+		}, 0, true},
+		{"get by ids", func(db *sql.DB) (int, error) {
+			anyIDs := make([]any, len(ids))
+			for i, id := range ids {
+				anyIDs[i] = id
+			}
+			rows, err := GetByIDs[testItem](db, "id", anyIDs)
+			return len(rows), err
+		}, numRows, false},
+		{"count empty ids", func(db *sql.DB) (int, error) {
+			return Count[testItem](db, In("id", []int64{}))
+		}, 0, false},
+		{"delete not in error", func(db *sql.DB) (int, error) {
+			err := Delete[testItem](db, Where{"id NOT IN ", ids})
+			if err != nil {
+				return 0, err
+			}
+			return Count[testItem](db)
+		}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openItemsDB(t)
+			if err := Insert(db, rows...); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tt.fn(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+
+			// No rows are deleted on error
+			if n, err := Count[testItem](db); err != nil {
+				t.Fatal(err)
+			} else if tt.wantErr && n != numRows {
+				t.Errorf("got %d rows after error, want %d", n, numRows)
+			}
+		})
+	}
+}
+
+func TestAliasWheres(t *testing.T) {
+	columns := []string{"id", "name", "age"}
+
+	tests := []struct {
+		name   string
+		wheres []Where
+		want   []Where
+	}{
+		{"known column", []Where{{"name=", "alice"}},
+			[]Where{{"t.name=", "alice"}}},
+		{"leading spaces and operator", []Where{Eq("age", 30),
+			{"  id IN ", []int{1}}},
+			[]Where{{"t.age = ", 30}, {"  t.id IN ", []int{1}}}},
+		{"qualified column unchanged", []Where{{"o.name=", "book"}},
+			[]Where{{"o.name=", "book"}}},
+		{"unknown column unchanged", []Where{{"total>", 1}},
+			[]Where{{"total>", 1}}},
+		{"column prefix is not column", []Where{{"names=", "a"}},
+			[]Where{{"names=", "a"}}},
+		{"groups", []Where{Or(Eq("id", 1), Eq("o.id", 2))},
+			[]Where{Or(Eq("t.id", 1), Eq("o.id", 2))}},
+		{"raw unchanged", []Where{Raw("name = ?", "a")},
+			[]Where{Raw("name = ?", "a")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aliasWheres("t", columns, tt.wheres)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaw(t *testing.T) {
+	tests := []struct {
+		name     string
+		wheres   []Where
+		wantStmt string
+		wantArgs []any
+		wantIDs  []int64
+	}{
+		{"structured and raw", []Where{{"id>", 0},
+			Raw("json_extract(json_object('x', age), '$.x') = ?", 30)},
+			"SELECT * from testuser where id > ? and json_extract(" +
+				"json_object('x', age), '$.x') = ? ORDER BY id LIMIT 10;",
+			[]any{0, 30}, []int64{1, 4}},
+		{"raw between structured", []Where{Gt("id", 1),
+			Raw("age BETWEEN ? AND ?", 25, 35), Lt("id", 4)},
+			"SELECT * from testuser where id > ? and age BETWEEN ? AND ? " +
+				"and id < ? ORDER BY id LIMIT 10;",
+			[]any{1, 25, 35, 4}, []int64{2, 3}},
+		{"raw without args", []Where{Raw("length(name) = 3")},
+			"SELECT * from testuser where length(name) = 3 ORDER BY id " +
+				"LIMIT 10;", nil, []int64{2}},
+		{"raw in or group", []Where{Or(Raw("age % ? = 0", 20), Eq("id", 3))},
+			"SELECT * from testuser where (age % ? = 0 OR id = ?) " +
+				"ORDER BY id LIMIT 10;", []any{20, 3}, []int64{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, args, err := ListSQL[testUser](0, "id",
+				whereAttrs(tt.wheres)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+
+			db := openTestDB(t)
+			rows, _, err := List[testUser](db, 0, "id", tt.wheres...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := userIDs(rows); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// recordQuerier is the querier which records the executed queries.
+type recordQuerier struct {
+	*sql.DB
+	queries []string
+}
+
+func (q *recordQuerier) QueryContext(ctx context.Context, query string,
+	args ...any) (*sql.Rows, error) {
+	q.queries = append(q.queries, query)
+	return q.DB.QueryContext(ctx, query, args...)
+}
+
+func TestWhereSpacing(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name       string
+		where      Where
+		wantClause string
+		wantCount  int
+	}{
+		{"equal", Where{"id=", 1}, "id = ?", 1},
+		{"spaced greater", Where{"id >", 1}, "id > ?", 4},
+		{"glued greater", Where{"id>", 1}, "id > ?", 4},
+		{"two chars operator", Where{"age<>", 30}, "age <> ?", 3},
+		{"like", Where{"name LIKE", "%a%"}, "name LIKE ?", 4},
+		{"not like", Where{"name NOT LIKE ", "%a%"}, "name NOT LIKE ?", 1},
+		{"in list", Where{"id IN", []int{1, 2}}, "id IN (?,?)", 2},
+		{"eq helper", Eq("name", "bob"), "name = ?", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses, _, err := whereClauses(tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clauses) != 1 || clauses[0] != tt.wantClause {
+				t.Errorf("got clauses %q, want %q", clauses, tt.wantClause)
+			}
+
+			// The List and Count statements use the spaced clause
+			stmt, _, err := ListSQL[testUser](0, "", tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stmt, " where "+tt.wantClause+" ") {
+				t.Errorf("got list statement %q, want where %q", stmt,
+					tt.wantClause)
+			}
+			q := &recordQuerier{DB: db}
+			count, err := Count[testUser](q, tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("got count %d, want %d", count, tt.wantCount)
+			}
+			if len(q.queries) != 1 || !strings.Contains(q.queries[0],
+				" where "+tt.wantClause) {
+				t.Errorf("got count queries %q, want where %q", q.queries,
+					tt.wantClause)
+			}
+		})
+	}
+}
+
+func TestInSelect(t *testing.T) {
+	db := openOrdersDB(t)
+
+	tests := []struct {
+		name     string
+		dialect  query.Dialect
+		attrs    []ListAttr
+		wantStmt string
+		wantArgs []any
+		wantIDs  []int64
+		wantErr  bool
+	}{
+		{"subquery without args", query.SQLite, []ListAttr{
+			InSelect("id", "SELECT user_id FROM testorder")},
+			"SELECT * from testuser where id IN (SELECT user_id FROM " +
+				"testorder) ORDER BY id LIMIT 10;", nil, []int64{1, 2, 3},
+			false},
+		{"interleaved args", query.SQLite, []ListAttr{Gt("age", 20),
+			InSelect("id", "SELECT user_id FROM testorder WHERE amount > ?;",
+				6), Lt("id", 3)},
+			"SELECT * from testuser where age > ? and id IN (SELECT user_id " +
+				"FROM testorder WHERE amount > ?) and id < ? ORDER BY id " +
+				"LIMIT 10;", []any{20, 6, 3}, []int64{1, 2}, false},
+		{"postgres placeholders", query.Postgres, []ListAttr{Gt("age", 20),
+			InSelect("id", "SELECT user_id FROM testorder WHERE amount "+
+				"BETWEEN ? AND ?", 6, 20), Ne("name", "bob")},
+			"SELECT * from testuser where age > $1 and id IN (SELECT " +
+				"user_id FROM testorder WHERE amount BETWEEN $2 AND $3) and " +
+				"name <> $4 ORDER BY id LIMIT 10;", []any{20, 6, 20, "bob"},
+			nil, false},
+		{"in or group", query.SQLite, []ListAttr{Or(Eq("id", 5),
+			InSelect("id", "SELECT user_id FROM testorder WHERE name = ?",
+				"lamp"))},
+			"SELECT * from testuser where (id = ? OR id IN (SELECT user_id " +
+				"FROM testorder WHERE name = ?)) ORDER BY id LIMIT 10;",
+			[]any{5, "lamp"}, []int64{3, 5}, false},
+		{"invalid column", query.SQLite, []ListAttr{
+			InSelect("id; --", "SELECT 1")}, "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query.SetDialect(tt.dialect)
+			stmt, args, err := ListSQL[testUser](0, "id", tt.attrs...)
+			query.SetDialect(query.SQLite)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stmt != tt.wantStmt {
+				t.Errorf("got statement %q, want %q", stmt, tt.wantStmt)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+			if tt.wantErr || tt.dialect.Name != "sqlite" {
+				return
+			}
+
+			rows, _, err := ListAttrs[testUser](db, 0, "id", tt.attrs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := userIDs(rows); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	type testEvent struct {
+		ID int64     `db:"id"`
+		At time.Time `db:"at"`
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Hour)
+	}
+
+	tests := []struct {
+		name        string
+		where       Where
+		wantClauses []string
+		wantArgs    []any
+		wantIDs     []int64
+	}{
+		{"closed range", TimeRange("at", hour(1), hour(3)),
+			[]string{"(at >= ? and at < ?)"}, []any{hour(1), hour(3)},
+			[]int64{2, 3}},
+		{"zero to is open", TimeRange("at", hour(2), time.Time{}),
+			[]string{"(at >= ?)"}, []any{hour(2)}, []int64{3, 4}},
+		{"zero from is open", TimeRange("at", time.Time{}, hour(2)),
+			[]string{"(at < ?)"}, []any{hour(2)}, []int64{1, 2}},
+		{"since", Since("at", hour(3)), []string{"(at >= ?)"},
+			[]any{hour(3)}, []int64{4}},
+		{"until", Until("at", hour(1)), []string{"(at < ?)"},
+			[]any{hour(1)}, []int64{1}},
+		{"both zero", TimeRange("at", time.Time{}, time.Time{}), nil, nil,
+			[]int64{1, 2, 3, 4}},
+		{"empty range", TimeRange("at", hour(2), hour(2)),
+			[]string{"(at >= ? and at < ?)"}, []any{hour(2), hour(2)}, nil},
+	}
+
+	db := openTestDB(t)
+	if err := CreateTable[testEvent](db); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 4 {
+		if err := Insert(db, testEvent{int64(i + 1), hour(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses, args, err := whereClauses(tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(clauses, tt.wantClauses) {
+				t.Errorf("got clauses %q, want %q", clauses, tt.wantClauses)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+
+			// Check selected rows
+			rows, _, err := List[testEvent](db, 0, "id", tt.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, row := range rows {
+				ids = append(ids, row.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}